@@ -0,0 +1,541 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupFormatVersion dinaikkan setiap kali struktur arsip berubah.
+// Restore menolak arsip dengan versi yang lebih baru.
+const backupFormatVersion = 1
+
+const backupFilePrefix = "kontrakanku-backup-"
+
+// Nama kolom dari arsip disisipkan ke SQL, jadi hanya identifier sederhana
+// yang diterima.
+var backupColumnPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// backupManifest disimpan sebagai manifest.json di dalam arsip.
+type backupManifest struct {
+	FormatVersion int                `json:"format_version"`
+	CreatedAt     string             `json:"created_at"`
+	Driver        string             `json:"driver"`
+	Tables        []backupTableEntry `json:"tables"`
+	Files         []backupFileEntry  `json:"files"`
+}
+
+type backupTableEntry struct {
+	Name   string `json:"name"`
+	Rows   int    `json:"rows"`
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+type backupFileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func runBackupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	outDir := fs.String("out", "./backups", "folder tujuan arsip backup")
+	uploadsDir := fs.String("uploads", "./uploads", "folder upload (KTP, kwitansi, foto properti)")
+	privateDir := fs.String("dokumen", dokumenDir, "folder dokumen pribadi (tanda tangan, surat perjanjian)")
+	keep := fs.Int("keep", 7, "jumlah arsip terbaru yang disimpan, sisanya dihapus (0 = simpan semua)")
+	every := fs.Duration("every", 0, "ulangi backup dengan interval ini, misalnya 24h (0 = sekali jalan)")
+	fs.Parse(args)
+
+	for {
+		path, err := createBackup(*outDir, *uploadsDir, *privateDir)
+		if err != nil {
+			if *every == 0 {
+				return err
+			}
+			log.Printf("Backup gagal: %v", err)
+		} else {
+			log.Printf("Backup tersimpan: %s", path)
+			if err := rotateBackups(*outDir, *keep); err != nil {
+				log.Printf("Rotasi backup gagal: %v", err)
+			}
+		}
+
+		if *every == 0 {
+			return nil
+		}
+		time.Sleep(*every)
+	}
+}
+
+func runRestoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	file := fs.String("file", "", "arsip backup yang akan di-restore")
+	uploadsDir := fs.String("uploads", "./uploads", "folder tujuan file upload")
+	privateDir := fs.String("dokumen", dokumenDir, "folder tujuan dokumen pribadi")
+	verify := fs.Bool("verify", false, "dry-run: cek checksum dan coba restore ke database kosong lalu rollback")
+	force := fs.Bool("force", false, "hapus data yang sudah ada di database sebelum restore")
+	fs.Parse(args)
+
+	if *file == "" {
+		return fmt.Errorf("-file wajib diisi")
+	}
+	return restoreBackup(*file, *uploadsDir, *privateDir, *verify, *force)
+}
+
+// createBackup menulis dump logis semua tabel (JSON lines, tidak tergantung
+// dialect) beserta isi folder upload dan dokumen pribadi ke satu arsip
+// tar.gz.
+func createBackup(outDir, uploadsDir, privateDir string) (string, error) {
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	createdAt := time.Now()
+	path := filepath.Join(outDir, backupFilePrefix+createdAt.Format("20060102-150405")+".tar.gz")
+	tmpPath := path + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	manifest := backupManifest{
+		FormatVersion: backupFormatVersion,
+		CreatedAt:     createdAt.Format(time.RFC3339),
+		Driver:        db.driver,
+	}
+
+	// Semua tabel dibaca dari satu snapshot supaya backup tetap konsisten
+	// walau server dan scheduler tagihan sedang berjalan
+	snapshot, err := db.BeginSnapshot()
+	if err != nil {
+		return "", err
+	}
+	defer snapshot.Rollback()
+
+	for _, table := range tableOrder {
+		entry, err := backupTable(snapshot, tw, table)
+		if err != nil {
+			return "", fmt.Errorf("dump %s: %w", table, err)
+		}
+		manifest.Tables = append(manifest.Tables, entry)
+	}
+
+	files, err := backupUploads(tw, uploadsDir, "uploads/")
+	if err != nil {
+		return "", fmt.Errorf("backup uploads: %w", err)
+	}
+	private, err := backupUploads(tw, privateDir, "dokumen/")
+	if err != nil {
+		return "", fmt.Errorf("backup dokumen: %w", err)
+	}
+	manifest.Files = append(files, private...)
+
+	raw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := writeTarEntry(tw, "manifest.json", raw); err != nil {
+		return "", err
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmpPath, path)
+}
+
+func backupTable(q querier, tw *tar.Writer, table string) (backupTableEntry, error) {
+	entry := backupTableEntry{Name: table, Path: "db/" + table + ".jsonl"}
+
+	rows, err := q.Query("SELECT * FROM " + table + " ORDER BY id")
+	if err != nil {
+		return entry, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return entry, err
+	}
+
+	var buf strings.Builder
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return entry, err
+		}
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			record[column] = normalizeBackupValue(values[i])
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			return entry, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		entry.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return entry, err
+	}
+
+	data := []byte(buf.String())
+	entry.SHA256 = sha256Hex(data)
+	return entry, writeTarEntry(tw, entry.Path, data)
+}
+
+// normalizeBackupValue mengubah nilai dari driver menjadi bentuk JSON yang
+// bisa di-insert ulang ke MySQL maupun PostgreSQL.
+func normalizeBackupValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.In(time.Local).Format("2006-01-02 15:04:05")
+	default:
+		return v
+	}
+}
+
+// backupUploads menulis isi satu folder ke arsip dengan awalan prefix.
+func backupUploads(tw *tar.Writer, uploadsDir, prefix string) ([]backupFileEntry, error) {
+	var files []backupFileEntry
+
+	err := filepath.Walk(uploadsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == uploadsDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(uploadsDir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		name := prefix + filepath.ToSlash(rel)
+		files = append(files, backupFileEntry{Path: name, Size: info.Size(), SHA256: sha256Hex(data)})
+		return writeTarEntry(tw, name, data)
+	})
+	return files, err
+}
+
+func writeTarEntry(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// rotateBackups menyisakan keep arsip terbaru di outDir.
+func rotateBackups(outDir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(outDir, backupFilePrefix+"*.tar.gz"))
+	if err != nil {
+		return err
+	}
+	// Nama file memakai timestamp, jadi urutan nama = urutan waktu
+	sort.Strings(matches)
+	for len(matches) > keep {
+		log.Printf("Menghapus backup lama: %s", matches[0])
+		if err := os.Remove(matches[0]); err != nil {
+			return err
+		}
+		matches = matches[1:]
+	}
+	return nil
+}
+
+// readBackup mengekstrak arsip ke folder sementara dan memastikan setiap
+// file cocok dengan checksum di manifest.
+func readBackup(file string) (*backupManifest, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, "", err
+	}
+	defer gz.Close()
+
+	dir, err := os.MkdirTemp("", "kontrakanku-restore-")
+	if err != nil {
+		return nil, "", err
+	}
+
+	checksums := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", err
+		}
+
+		name := filepath.Clean(header.Name)
+		if strings.HasPrefix(name, "..") || filepath.IsAbs(name) {
+			os.RemoveAll(dir)
+			return nil, "", fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+
+		target := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			os.RemoveAll(dir)
+			return nil, "", err
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", err
+		}
+		hash := sha256.New()
+		_, err = io.Copy(io.MultiWriter(out, hash), tr)
+		out.Close()
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, "", err
+		}
+		checksums[filepath.ToSlash(name)] = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", fmt.Errorf("manifest.json not found: %w", err)
+	}
+	var manifest backupManifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		os.RemoveAll(dir)
+		return nil, "", fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.FormatVersion > backupFormatVersion {
+		os.RemoveAll(dir)
+		return nil, "", fmt.Errorf("backup format version %d is newer than supported version %d", manifest.FormatVersion, backupFormatVersion)
+	}
+
+	var mismatched []string
+	for _, t := range manifest.Tables {
+		if checksums[t.Path] != t.SHA256 {
+			mismatched = append(mismatched, t.Path)
+		}
+	}
+	for _, file := range manifest.Files {
+		if checksums[file.Path] != file.SHA256 {
+			mismatched = append(mismatched, file.Path)
+		}
+	}
+	if len(mismatched) > 0 {
+		os.RemoveAll(dir)
+		return nil, "", fmt.Errorf("checksum mismatch: %s", strings.Join(mismatched, ", "))
+	}
+
+	return &manifest, dir, nil
+}
+
+func restoreBackup(file, uploadsDir, privateDir string, verify, force bool) error {
+	manifest, dir, err := readBackup(file)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	log.Printf("Arsip %s valid: format v%d, dibuat %s dari %s, %d tabel, %d file",
+		file, manifest.FormatVersion, manifest.CreatedAt, manifest.Driver, len(manifest.Tables), len(manifest.Files))
+	if manifest.Driver != db.driver {
+		log.Printf("Peringatan: backup dari %s di-restore ke %s", manifest.Driver, db.driver)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Restore hanya ke database kosong, kecuali -force
+	for _, table := range tableOrder {
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 && (verify || !force) {
+			return fmt.Errorf("table %s is not empty (%d rows); restore needs an empty database (use -force to overwrite)", table, count)
+		}
+	}
+	if force && !verify {
+		for i := len(tableOrder) - 1; i >= 0; i-- {
+			if _, err := tx.Exec("DELETE FROM " + tableOrder[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	restored := map[string]bool{}
+	for _, table := range tableOrder {
+		for _, entry := range manifest.Tables {
+			if entry.Name != table {
+				continue
+			}
+			count, err := restoreTable(tx, table, filepath.Join(dir, filepath.FromSlash(entry.Path)))
+			if err != nil {
+				return fmt.Errorf("restore %s: %w", table, err)
+			}
+			if count != entry.Rows {
+				return fmt.Errorf("restore %s: restored %d rows, manifest says %d", table, count, entry.Rows)
+			}
+			restored[table] = true
+			log.Printf("- %s: %d baris", table, count)
+		}
+	}
+	for _, entry := range manifest.Tables {
+		if !restored[entry.Name] {
+			log.Printf("Peringatan: tabel %s di arsip tidak dikenal, dilewati", entry.Name)
+		}
+	}
+
+	if verify {
+		log.Printf("Verifikasi berhasil: arsip bisa di-restore ke database kosong (transaksi di-rollback)")
+		return nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, f := range manifest.Files {
+		target := filepath.Join(uploadsDir, filepath.FromSlash(strings.TrimPrefix(f.Path, "uploads/")))
+		if rel, ok := strings.CutPrefix(f.Path, "dokumen/"); ok {
+			target = filepath.Join(privateDir, filepath.FromSlash(rel))
+		}
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Restore selesai: %d file dipulihkan ke %s dan %s", len(manifest.Files), uploadsDir, privateDir)
+	return nil
+}
+
+func restoreTable(tx *Tx, table, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		decoder := json.NewDecoder(strings.NewReader(scanner.Text()))
+		decoder.UseNumber()
+		var record map[string]interface{}
+		if err := decoder.Decode(&record); err != nil {
+			return count, err
+		}
+
+		columns := make([]string, 0, len(record))
+		for column := range record {
+			if !backupColumnPattern.MatchString(column) {
+				return count, fmt.Errorf("invalid column name %q", column)
+			}
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+
+		args := make([]interface{}, len(columns))
+		for i, column := range columns {
+			if n, ok := record[column].(json.Number); ok {
+				args[i] = n.String()
+			} else {
+				args[i] = record[column]
+			}
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			table, strings.Join(columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+		if _, err := tx.Exec(query, args...); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return count, err
+	}
+
+	// PostgreSQL tidak memajukan sequence saat id di-insert manual
+	if tx.driver == "postgres" && count > 0 {
+		if _, err := tx.Exec(fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence('%s', 'id'), (SELECT MAX(id) FROM %s))", table, table,
+		)); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeBackupValue(t *testing.T) {
+	waktu := time.Date(2026, time.January, 15, 9, 30, 0, 0, time.Local)
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"bytes", []byte("Budi"), "Budi"},
+		{"time", waktu, "2026-01-15 09:30:00"},
+		{"int", int64(12), int64(12)},
+		{"nil", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeBackupValue(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("normalizeBackupValue(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSha256Hex(t *testing.T) {
+	want := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if got := sha256Hex(nil); got != want {
+		t.Fatalf("sha256Hex(nil) = %s, want %s", got, want)
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	tests := []struct {
+		name string
+		keep int
+		want []string
+	}{
+		{"sisakan dua terbaru", 2, []string{"20260103-000000", "20260104-000000"}},
+		{"keep 0 tidak menghapus", 0, []string{"20260101-000000", "20260102-000000", "20260103-000000", "20260104-000000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, stamp := range []string{"20260102-000000", "20260104-000000", "20260101-000000", "20260103-000000"} {
+				os.WriteFile(filepath.Join(dir, backupFilePrefix+stamp+".tar.gz"), nil, 0o644)
+			}
+			// File lain di folder yang sama tidak disentuh
+			os.WriteFile(filepath.Join(dir, "catatan.txt"), nil, 0o644)
+
+			if err := rotateBackups(dir, tt.keep); err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, stamp := range tt.want {
+				want = append(want, filepath.Join(dir, backupFilePrefix+stamp+".tar.gz"))
+			}
+			got, _ := filepath.Glob(filepath.Join(dir, backupFilePrefix+"*.tar.gz"))
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("sisa backup = %v, want %v", got, want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "catatan.txt")); err != nil {
+				t.Fatal("file lain ikut terhapus")
+			}
+		})
+	}
+}
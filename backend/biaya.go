@@ -0,0 +1,599 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JenisBiaya adalah biaya tambahan di luar sewa (kebersihan, keamanan,
+// wifi, parkir, ...). Tanpa properti_id berlaku untuk semua unit; biaya unit
+// dengan nama yang sama menggantikan biaya global. Pengulangan bulanan
+// ditagih setiap periode, sekali hanya di tagihan pertama kontrak.
+type JenisBiaya struct {
+	ID          int64   `json:"id"`
+	Nama        string  `json:"nama"`
+	PropertiID  int64   `json:"properti_id"`
+	NamaUnit    string  `json:"nama_unit"`
+	Nominal     float64 `json:"nominal"`
+	Pengulangan string  `json:"pengulangan"`
+	Status      string  `json:"status"`
+	Keterangan  string  `json:"keterangan"`
+}
+
+var pengulanganBiayaValid = []string{"bulanan", "sekali"}
+
+// durasiBulan menghitung lama tagihan dalam bulan, sama dengan perhitungan
+// form kontrak: sisa hari setelah bulan penuh dibulatkan ke atas, minimal
+// satu bulan. Tanpa tanggal akhir dianggap satu bulan.
+func durasiBulan(mulai, akhir time.Time) int {
+	if akhir.IsZero() || !akhir.After(mulai) {
+		return 1
+	}
+	bulan := (akhir.Year()-mulai.Year())*12 + int(akhir.Month()-mulai.Month())
+	if akhir.Day() > mulai.Day() {
+		bulan++
+	}
+	if bulan < 1 {
+		bulan = 1
+	}
+	return bulan
+}
+
+// loadBiayaBerlaku memuat biaya aktif untuk sebuah unit. Unit kosong
+// (propertiID tidak valid) hanya mendapat biaya global.
+func loadBiayaBerlaku(q querier, propertiID sql.NullInt64) ([]JenisBiaya, error) {
+	rows, err := q.Query(`
+		SELECT b.id, b.nama, COALESCE(b.properti_id, 0), b.nominal, b.pengulangan
+		FROM jenis_biaya b
+		WHERE b.status='aktif' AND (b.properti_id IS NULL OR b.properti_id=?)
+		ORDER BY b.properti_id IS NULL, b.id`, propertiID.Int64)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []JenisBiaya
+	dipakai := map[string]bool{}
+	for rows.Next() {
+		var b JenisBiaya
+		if err := rows.Scan(&b.ID, &b.Nama, &b.PropertiID, &b.Nominal, &b.Pengulangan); err != nil {
+			return nil, err
+		}
+		// Biaya unit dibaca lebih dulu dan menggantikan biaya global bernama sama
+		key := strings.ToLower(strings.TrimSpace(b.Nama))
+		if dipakai[key] {
+			continue
+		}
+		dipakai[key] = true
+		list = append(list, b)
+	}
+	return list, rows.Err()
+}
+
+// tambahBiayaTagihan menambahkan biaya yang berlaku sebagai rincian
+// tagihan. Biaya bulanan dikali jumlah bulan tagihan; biaya sekali hanya
+// ditambahkan jika ini tagihan pertama kontrak.
+func tambahBiayaTagihan(q querier, pembayaranID int64, propertiID sql.NullInt64, bulan int, pertama bool) error {
+	biaya, err := loadBiayaBerlaku(q, propertiID)
+	if err != nil {
+		return err
+	}
+	for _, b := range biaya {
+		jumlah := float64(bulan)
+		if b.Pengulangan == "sekali" {
+			if !pertama {
+				continue
+			}
+			jumlah = 1
+		}
+		if _, err := q.Exec(`
+			INSERT INTO tagihan_item (pembayaran_id, jenis, deskripsi, jumlah, harga_satuan, nominal, jenis_biaya_id)
+			VALUES (?, 'biaya', ?, ?, ?, ?, ?)`,
+			pembayaranID, b.Nama, jumlah, b.Nominal, jumlah*b.Nominal, b.ID,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagihanPertama: belum ada tagihan lain untuk kontrak ini.
+func tagihanPertama(q querier, kontrakID, pembayaranID int64) (bool, error) {
+	var lain int
+	err := q.QueryRow("SELECT COUNT(*) FROM pembayaran WHERE kontrak_id=? AND id <> ?", kontrakID, pembayaranID).Scan(&lain)
+	return lain == 0, err
+}
+
+// hitungTotalTagihan menyamakan pembayaran.nominal dengan jumlah
+// rinciannya. Total tagihan selalu dihitung di server dari rincian.
+func hitungTotalTagihan(q querier, pembayaranID int64) (float64, error) {
+	var total float64
+	err := q.QueryRow("SELECT COALESCE(SUM(nominal), 0) FROM tagihan_item WHERE pembayaran_id=?", pembayaranID).Scan(&total)
+	if err != nil {
+		return 0, err
+	}
+	total = math.Round(total*100) / 100
+	if _, err := q.Exec("UPDATE pembayaran SET nominal=? WHERE id=?", total, pembayaranID); err != nil {
+		return 0, err
+	}
+	// Nominal berubah, status lunas/sebagian ikut dihitung ulang
+	return total, sinkronPembayaran(q, pembayaranID)
+}
+
+// simpanItemSewa membuat atau mengganti rincian sewa sebuah tagihan.
+func simpanItemSewa(q querier, pembayaranID int64, deskripsi string, jumlah, harga, nominal float64) error {
+	result, err := q.Exec(`
+		UPDATE tagihan_item SET deskripsi=?, jumlah=?, harga_satuan=?, nominal=?
+		WHERE pembayaran_id=? AND jenis='sewa'`,
+		deskripsi, jumlah, harga, nominal, pembayaranID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	_, err = q.Exec(`
+		INSERT INTO tagihan_item (pembayaran_id, jenis, deskripsi, jumlah, harga_satuan, nominal)
+		VALUES (?, 'sewa', ?, ?, ?, ?)`,
+		pembayaranID, deskripsi, jumlah, harga, nominal)
+	return err
+}
+
+// simpanItemSewaProrata menyimpan rincian sewa periode parsial: jumlah
+// dalam hari dan harga satuan per hari.
+func simpanItemSewaProrata(q querier, pembayaranID int64, mulai time.Time, bulan, hari, hariPenuh int, sewa float64) error {
+	deskripsi := deskripsiSewa(mulai, bulan) + fmt.Sprintf(" (prorata %d/%d hari)", hari, hariPenuh)
+	return simpanItemSewa(q, pembayaranID, deskripsi, float64(hari), math.Round(sewa/float64(hari)*100)/100, sewa)
+}
+
+// deskripsiSewa: "Sewa Januari 2026" atau "Sewa 3 bulan (Januari 2026)".
+func deskripsiSewa(mulai time.Time, bulan int) string {
+	if bulan > 1 {
+		return fmt.Sprintf("Sewa %d bulan (%s)", bulan, formatBulan(mulai))
+	}
+	return "Sewa " + formatBulan(mulai)
+}
+
+// JENIS BIAYA HANDLERS
+func getJenisBiaya(c *gin.Context) {
+	rows, err := db.Query(`
+		SELECT b.id, b.nama, COALESCE(b.properti_id, 0), COALESCE(pr.nama_unit, ''), b.nominal, b.pengulangan,
+		       b.status, COALESCE(b.keterangan, '')
+		FROM jenis_biaya b
+		LEFT JOIN properti pr ON pr.id = b.properti_id
+		ORDER BY b.properti_id IS NULL DESC, b.nama, b.id`)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	biaya := []JenisBiaya{}
+	for rows.Next() {
+		var b JenisBiaya
+		if err := rows.Scan(&b.ID, &b.Nama, &b.PropertiID, &b.NamaUnit, &b.Nominal, &b.Pengulangan, &b.Status, &b.Keterangan); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		biaya = append(biaya, b)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, biaya)
+}
+
+func validateJenisBiaya(in *requestInput, partial bool) []FieldError {
+	var fieldErrors []FieldError
+	for _, field := range []string{"nama", "nominal"} {
+		if !partial || in.Has(field) {
+			fieldErrors = append(fieldErrors, requiredFields(in, field)...)
+		}
+	}
+	fieldErrors = append(fieldErrors, numericFields(in, "properti_id", "nominal")...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "pengulangan", pengulanganBiayaValid)...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "status", statusAturanDendaValid)...)
+	return fieldErrors
+}
+
+func createJenisBiaya(c *gin.Context) {
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateJenisBiaya(in, false); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	pengulangan := in.Get("pengulangan")
+	if pengulangan == "" {
+		pengulangan = "bulanan"
+	}
+	status := in.Get("status")
+	if status == "" {
+		status = "aktif"
+	}
+
+	id, err := db.InsertID(`
+		INSERT INTO jenis_biaya (nama, properti_id, nominal, pengulangan, status, keterangan)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		in.Get("nama"), nullIfEmpty(in.Get("properti_id")), in.Get("nominal"), pengulangan, status, nullIfEmpty(in.Get("keterangan")),
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Jenis biaya berhasil dibuat"})
+}
+
+func patchJenisBiaya(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateJenisBiaya(in, true); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "jenis_biaya", id) {
+		return
+	}
+
+	sets, args := buildPatch(in, []patchField{
+		{Field: "nama", Column: "nama"},
+		{Field: "properti_id", Column: "properti_id", Nullable: true},
+		{Field: "nominal", Column: "nominal"},
+		{Field: "pengulangan", Column: "pengulangan"},
+		{Field: "status", Column: "status"},
+		{Field: "keterangan", Column: "keterangan", Nullable: true},
+	})
+	if len(sets) == 0 {
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Tidak ada field yang diubah", nil)
+		return
+	}
+
+	sets = append(sets, "updated_at=CURRENT_TIMESTAMP")
+	args = append(args, id)
+	if _, err := db.Exec("UPDATE jenis_biaya SET "+strings.Join(sets, ", ")+" WHERE id=?", args...); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Jenis biaya berhasil diupdate"})
+}
+
+// deleteJenisBiaya tidak mengubah tagihan yang sudah dibuat; rinciannya
+// tetap ada tanpa jenis_biaya_id.
+func deleteJenisBiaya(c *gin.Context) {
+	result, err := db.Exec("DELETE FROM jenis_biaya WHERE id=?", c.Param("id"))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	respondDeleted(c, result, "jenis biaya", "Jenis biaya berhasil dihapus")
+}
+
+// GET /api/tagihan/:id/item mengembalikan rincian sebuah tagihan.
+func getTagihanItem(c *gin.Context) {
+	id := c.Param("id")
+	if !ensureExists(c, "pembayaran", id) {
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT id, jenis, deskripsi, jumlah, harga_satuan, nominal, COALESCE(meter_bacaan_id, 0), COALESCE(jenis_biaya_id, 0)
+		FROM tagihan_item WHERE pembayaran_id=?
+		ORDER BY id`, id)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	items := []gin.H{}
+	for rows.Next() {
+		var itemID, meterID, biayaID int64
+		var jenis, deskripsi string
+		var jumlah, harga, nominal float64
+		if err := rows.Scan(&itemID, &jenis, &deskripsi, &jumlah, &harga, &nominal, &meterID, &biayaID); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		items = append(items, gin.H{
+			"id":              itemID,
+			"jenis":           jenis,
+			"deskripsi":       deskripsi,
+			"jumlah":          jumlah,
+			"harga_satuan":    harga,
+			"nominal":         nominal,
+			"meter_bacaan_id": meterID,
+			"jenis_biaya_id":  biayaID,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// POST /api/tagihan/:id/item menambah rincian ke tagihan, dari jenis biaya
+// (jenis_biaya_id) atau biaya lain-lain (deskripsi + harga_satuan).
+// Nominal rincian dan total tagihan dihitung di server.
+func addTagihanItem(c *gin.Context) {
+	pembayaranID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondNotFound(c, "Data pembayaran tidak ditemukan")
+		return
+	}
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	fieldErrors := numericFields(in, "jenis_biaya_id", "jumlah", "harga_satuan")
+	if in.Get("jenis_biaya_id") == "" {
+		fieldErrors = append(fieldErrors, requiredFields(in, "deskripsi", "harga_satuan")...)
+	}
+	if len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "pembayaran", c.Param("id")) {
+		return
+	}
+
+	jumlah := 1.0
+	if in.Get("jumlah") != "" {
+		jumlah, _ = strconv.ParseFloat(in.Get("jumlah"), 64)
+	}
+	jenis, deskripsi := "lainnya", in.Get("deskripsi")
+	harga, _ := strconv.ParseFloat(in.Get("harga_satuan"), 64)
+	var jenisBiayaID interface{}
+	if id := in.Get("jenis_biaya_id"); id != "" {
+		var nama string
+		var nominal float64
+		err := db.QueryRow("SELECT nama, nominal FROM jenis_biaya WHERE id=?", id).Scan(&nama, &nominal)
+		if err == sql.ErrNoRows {
+			respondNotFound(c, "Data jenis_biaya tidak ditemukan")
+			return
+		}
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		jenis, jenisBiayaID = "biaya", id
+		if deskripsi == "" {
+			deskripsi = nama
+		}
+		if in.Get("harga_satuan") == "" {
+			harga = nominal
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	itemID, err := tx.InsertID(`
+		INSERT INTO tagihan_item (pembayaran_id, jenis, deskripsi, jumlah, harga_satuan, nominal, jenis_biaya_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		pembayaranID, jenis, deskripsi, jumlah, harga, math.Round(jumlah*harga*100)/100, jenisBiayaID,
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	total, err := hitungTotalTagihan(tx, pembayaranID)
+	if err == nil {
+		err = recalcJatuhTempoPembayaran(tx, pembayaranID)
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": itemID, "total": total, "message": "Rincian tagihan berhasil ditambahkan"})
+}
+
+// DELETE /api/tagihan/:id/item/:itemId menghapus rincian biaya tambahan.
+func deleteTagihanItem(c *gin.Context) {
+	pembayaranID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondNotFound(c, "Data rincian tagihan tidak ditemukan")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var jenis string
+	var meterID sql.NullInt64
+	err = tx.QueryRow("SELECT jenis, meter_bacaan_id FROM tagihan_item WHERE id=? AND pembayaran_id=?", c.Param("itemId"), pembayaranID).
+		Scan(&jenis, &meterID)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data rincian tagihan tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	// Rincian sewa, meter, dan denda dibuat sistem, ubah lewat
+	// tagihan/bacaan meternya atau hapuskan dendanya
+	if jenis == "sewa" || jenis == "denda" || meterID.Valid {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Rincian sewa, meter, dan denda tidak bisa dihapus", nil)
+		return
+	}
+
+	result, err := tx.Exec("DELETE FROM tagihan_item WHERE id=?", c.Param("itemId"))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	total, err := hitungTotalTagihan(tx, pembayaranID)
+	if err == nil {
+		err = recalcJatuhTempoPembayaran(tx, pembayaranID)
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondNotFound(c, "Data rincian tagihan tidak ditemukan")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": total, "message": "Rincian tagihan berhasil dihapus"})
+}
+
+// hitungUlangSewa menyusun ulang rincian sewa dari harga per bulan dan
+// rentang tanggal tagihan. hargaSewa kosong berarti memakai harga_sewa
+// kontrak, atau harga rincian sewa untuk tagihan tanpa kontrak. Periode
+// parsial tagihan otomatis tetap diprorata per hari seperti saat dibuat.
+func hitungUlangSewa(q querier, pembayaranID int64, hargaSewa string) (int, error) {
+	var kontrakID sql.NullInt64
+	var periodeMulai, mulai, akhir sql.NullTime
+	err := q.QueryRow("SELECT kontrak_id, periode_mulai, COALESCE(tanggal_mulai, tanggal_bayar), tanggal_akhir FROM pembayaran WHERE id=?", pembayaranID).
+		Scan(&kontrakID, &periodeMulai, &mulai, &akhir)
+	if err != nil {
+		return 0, err
+	}
+
+	harga, err := strconv.ParseFloat(hargaSewa, 64)
+	if hargaSewa == "" || err != nil {
+		err = q.QueryRow(`
+			SELECT COALESCE(
+			         (SELECT harga_sewa FROM kontrak WHERE id=?),
+			         (SELECT MAX(harga_satuan) FROM tagihan_item WHERE pembayaran_id=? AND jenis='sewa'),
+			         0)`, kontrakID.Int64, pembayaranID).Scan(&harga)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if periodeMulai.Valid && kontrakID.Valid && akhir.Valid {
+		bulan, hariPenuh, err := periodeTagihanKontrak(q, kontrakID.Int64, periodeMulai.Time)
+		if err != nil {
+			return 0, err
+		}
+		if hari := selisihHari(dateOnly(mulai.Time), dateOnly(akhir.Time)) + 1; hari > 0 && hari < hariPenuh {
+			sewa := prorata(harga*float64(bulan), hari, hariPenuh)
+			return bulan, simpanItemSewaProrata(q, pembayaranID, mulai.Time, bulan, hari, hariPenuh, sewa)
+		}
+	}
+
+	bulan := durasiBulan(dateOnly(mulai.Time), dateOnly(akhir.Time))
+	if !akhir.Valid {
+		bulan = 1
+	}
+	if err := simpanItemSewa(q, pembayaranID, deskripsiSewa(mulai.Time, bulan), float64(bulan), harga, float64(bulan)*harga); err != nil {
+		return 0, err
+	}
+	return bulan, nil
+}
+
+// periodeTagihanKontrak mencari periode kontrak yang dimulai di
+// periodeMulai dengan aturan yang sama seperti generateTagihan, lalu
+// mengembalikan lama periode dalam bulan dan jumlah hari periode utuhnya.
+// hariPenuh 0 berarti periode tidak ditemukan.
+func periodeTagihanKontrak(q querier, kontrakID int64, periodeMulai time.Time) (int, int, error) {
+	var mulai time.Time
+	var periode string
+	var hariTagihan int
+	err := q.QueryRow("SELECT tanggal_mulai, COALESCE(periode_tagihan, ''), COALESCE(hari_tagihan, 0) FROM kontrak WHERE id=?", kontrakID).
+		Scan(&mulai, &periode, &hariTagihan)
+	if err != nil {
+		return 0, 0, err
+	}
+	bulan := periodeBulan[periode]
+	if bulan == 0 {
+		bulan = 1
+	}
+
+	periodeMulai = dateOnly(periodeMulai)
+	for n := 0; ; n++ {
+		awal, _, hariPenuh := periodeKontrak(dateOnly(mulai), hariTagihan, bulan, n)
+		if awal.Equal(periodeMulai) {
+			return bulan, hariPenuh, nil
+		}
+		if awal.After(periodeMulai) {
+			return bulan, 0, nil
+		}
+	}
+}
+
+// buatRincianTagihan mengisi rincian tagihan manual (sewa x durasi, biaya
+// tambahan unit kontrak, dan diskon) lalu mengembalikan totalnya.
+func buatRincianTagihan(q querier, pembayaranID, kontrakID int64, hargaSewa string) (float64, error) {
+	bulan, err := hitungUlangSewa(q, pembayaranID, hargaSewa)
+	if err != nil {
+		return 0, err
+	}
+
+	var propertiID sql.NullInt64
+	if err := q.QueryRow("SELECT properti_id FROM kontrak WHERE id=?", kontrakID).Scan(&propertiID); err != nil {
+		return 0, err
+	}
+	pertama, err := tagihanPertama(q, kontrakID, pembayaranID)
+	if err != nil {
+		return 0, err
+	}
+	if err := tambahBiayaTagihan(q, pembayaranID, propertiID, bulan, pertama); err != nil {
+		return 0, err
+	}
+	if err := terapkanDiskon(q, pembayaranID); err != nil {
+		return 0, err
+	}
+	return hitungTotalTagihan(q, pembayaranID)
+}
+
+// hitungUlangTotal dipakai PUT/PATCH pembayaran setelah tanggal atau harga
+// sewa berubah, di transaksi yang sama; diskon persen ikut dihitung ulang.
+func hitungUlangTotal(q querier, id string, hargaSewa string) error {
+	pembayaranID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return err
+	}
+	if _, err := hitungUlangSewa(q, pembayaranID, hargaSewa); err != nil {
+		return err
+	}
+	if err := terapkanDiskon(q, pembayaranID); err != nil {
+		return err
+	}
+	_, err = hitungTotalTagihan(q, pembayaranID)
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// commands adalah subcommand CLI yang dijalankan lewat
+// "./main <nama> [flag...]". Tanpa argumen, binary menjalankan server API.
+var commands = map[string]struct {
+	usage string
+	run   func(args []string) error
+}{
+	"seed":            {"isi database dengan data demo", runSeedCommand},
+	"backup":          {"backup database dan folder upload ke satu arsip", runBackupCommand},
+	"restore":         {"restore arsip backup (atau -verify untuk dry-run)", runRestoreCommand},
+	"import":          {"impor properti atau penyewa dari file CSV/XLSX", runImportCommand},
+	"generate-bills":  {"buat tagihan untuk semua kontrak aktif yang periodenya sudah dimulai", runGenerateBillsCommand},
+	"apply-penalties": {"hitung denda untuk tagihan yang lewat jatuh tempo", runApplyPenaltiesCommand},
+	"reconcile":       {"samakan uang_dibayar dan status tagihan dengan riwayat cicilan", runReconcileCommand},
+}
+
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		printCommandUsage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+	return cmd.run(args)
+}
+
+func printCommandUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nTanpa command: menjalankan server API.\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].usage)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Database membungkus *sql.DB supaya query yang ditulis dengan placeholder
+// "?" (gaya MySQL) tetap jalan di PostgreSQL.
+type Database struct {
+	*sql.DB
+	driver string
+}
+
+// Tx adalah transaksi dengan perilaku placeholder yang sama seperti Database.
+type Tx struct {
+	*sql.Tx
+	driver string
+}
+
+var db *Database
+
+// querier dipenuhi oleh *Database dan *Tx, untuk helper yang dipanggil di
+// dalam maupun di luar transaksi.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	InsertID(query string, args ...interface{}) (int64, error)
+}
+
+// openDatabase membuka koneksi sesuai driver ("mysql" atau "postgres").
+func openDatabase(driver, dsn string) (*Database, error) {
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Database{DB: conn, driver: driver}, nil
+}
+
+// connectDB membaca konfigurasi dari environment. DATABASE_URL berarti
+// PostgreSQL (Render/Supabase), selain itu MySQL lokal.
+func connectDB() (*Database, error) {
+	var dsn string
+	var dbDriver string
+
+	// Cek apakah menggunakan DATABASE_URL (PostgreSQL di Render) atau MySQL lokal
+	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
+		// PostgreSQL (Render)
+		dsn = databaseURL
+		dbDriver = "postgres"
+		log.Printf("Using PostgreSQL (Render)")
+	} else {
+		// MySQL (Development) - gunakan environment variables terpisah
+		dbHost := os.Getenv("DB_HOST")
+		dbPort := os.Getenv("DB_PORT")
+		dbUser := os.Getenv("DB_USER")
+		dbPassword := os.Getenv("DB_PASSWORD")
+		dbName := os.Getenv("DB_NAME")
+
+		if dbHost == "" {
+			dbHost = "localhost"
+		}
+		if dbPort == "" {
+			dbPort = "3306"
+		}
+		if dbUser == "" {
+			dbUser = "root"
+		}
+		if dbName == "" {
+			dbName = "kontrakanku"
+		}
+
+		dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			dbUser, dbPassword, dbHost, dbPort, dbName)
+		dbDriver = "mysql"
+		log.Printf("Using MySQL (Development)")
+	}
+
+	log.Printf("Connecting to database...")
+	return openDatabase(dbDriver, dsn)
+}
+
+func (d *Database) isPostgres() bool {
+	return d.driver == "postgres"
+}
+
+func (d *Database) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return d.DB.Exec(rebind(d.driver, query), args...)
+}
+
+func (d *Database) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return d.DB.Query(rebind(d.driver, query), args...)
+}
+
+func (d *Database) QueryRow(query string, args ...interface{}) *sql.Row {
+	return d.DB.QueryRow(rebind(d.driver, query), args...)
+}
+
+func (d *Database) Begin() (*Tx, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, driver: d.driver}, nil
+}
+
+// BeginSnapshot membuka transaksi baca saja dengan isolasi REPEATABLE READ,
+// sehingga semua query di dalamnya melihat data pada satu titik waktu.
+func (d *Database) BeginSnapshot() (*Tx, error) {
+	tx, err := d.DB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, driver: d.driver}, nil
+}
+
+// InsertID menjalankan INSERT dan mengembalikan id baris baru. PostgreSQL
+// tidak mendukung LastInsertId, jadi di sana dipakai RETURNING id.
+func (d *Database) InsertID(query string, args ...interface{}) (int64, error) {
+	return insertID(d.driver, d.DB.Exec, d.DB.QueryRow, query, args...)
+}
+
+func (t *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.Exec(rebind(t.driver, query), args...)
+}
+
+func (t *Tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.Query(rebind(t.driver, query), args...)
+}
+
+func (t *Tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRow(rebind(t.driver, query), args...)
+}
+
+func (t *Tx) InsertID(query string, args ...interface{}) (int64, error) {
+	return insertID(t.driver, t.Tx.Exec, t.Tx.QueryRow, query, args...)
+}
+
+func insertID(
+	driver string,
+	exec func(string, ...interface{}) (sql.Result, error),
+	queryRow func(string, ...interface{}) *sql.Row,
+	query string,
+	args ...interface{},
+) (int64, error) {
+	if driver == "postgres" {
+		var id int64
+		err := queryRow(rebind(driver, query)+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := exec(rebind(driver, query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// rebind mengubah placeholder "?" menjadi "$1", "$2", ... untuk PostgreSQL.
+// Tanda tanya di dalam string literal tidak ikut diubah.
+func rebind(driver, query string) string {
+	if driver != "postgres" || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for _, ch := range query {
+		switch {
+		case ch == '\'':
+			inString = !inString
+			b.WriteRune(ch)
+		case ch == '?' && !inString:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		default:
+			b.WriteRune(ch)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,648 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AturanDenda menentukan denda keterlambatan. Aturan dengan properti_id
+// berlaku untuk unit itu saja; aturan tanpa properti_id berlaku global.
+type AturanDenda struct {
+	ID           int64   `json:"id"`
+	PropertiID   int64   `json:"properti_id"`
+	NamaUnit     string  `json:"nama_unit"`
+	Jenis        string  `json:"jenis"`
+	Nilai        float64 `json:"nilai"`
+	MasaTenggang int     `json:"masa_tenggang"`
+	Akrual       string  `json:"akrual"`
+	Maksimal     float64 `json:"maksimal"`
+	Status       string  `json:"status"`
+	Keterangan   string  `json:"keterangan"`
+}
+
+var (
+	jenisDendaValid        = []string{"flat", "persen"}
+	akrualDendaValid       = []string{"harian", "bulanan"}
+	statusAturanDendaValid = []string{"aktif", "nonaktif"}
+)
+
+// hitungDenda mengembalikan nominal denda dan jumlah hari terlambat per
+// tanggal asOf. Denda mulai dihitung sehari setelah jatuh tempo + masa
+// tenggang. Akrual bulanan menghitung setiap bulan yang sudah dimulai,
+// jadi hari pertama terlambat langsung kena satu kali denda.
+func hitungDenda(a AturanDenda, nominalTagihan float64, jatuhTempo, asOf time.Time) (float64, int) {
+	batas := dateOnly(jatuhTempo).AddDate(0, 0, a.MasaTenggang)
+	hari := int(dateOnly(asOf).Sub(batas).Hours() / 24)
+	if hari <= 0 {
+		return 0, 0
+	}
+
+	kali := hari
+	if a.Akrual == "bulanan" {
+		kali = 1
+		for addMonths(batas, kali).Before(dateOnly(asOf)) {
+			kali++
+		}
+	}
+
+	per := a.Nilai
+	if a.Jenis == "persen" {
+		per = nominalTagihan * a.Nilai / 100
+	}
+	total := per * float64(kali)
+	if a.Maksimal > 0 && total > a.Maksimal {
+		total = a.Maksimal
+	}
+	return math.Round(total*100) / 100, hari
+}
+
+type dendaBaru struct {
+	DendaID       int64   `json:"denda_id,omitempty"`
+	PembayaranID  int64   `json:"pembayaran_id"`
+	NamaPenyewa   string  `json:"nama_penyewa"`
+	JatuhTempo    string  `json:"jatuh_tempo"`
+	HariTerlambat int     `json:"hari_terlambat"`
+	Nominal       float64 `json:"nominal"`
+}
+
+type dendaReport struct {
+	Tanggal    string      `json:"tanggal"`
+	DryRun     bool        `json:"dry_run"`
+	Terlambat  int         `json:"terlambat"`
+	Dibuat     int         `json:"dibuat"`
+	Diperbarui int         `json:"diperbarui"`
+	Denda      []dendaBaru `json:"denda"`
+}
+
+// loadAturanDenda mengembalikan aturan aktif per properti dan aturan
+// global. Jika ada lebih dari satu aturan untuk cakupan yang sama, aturan
+// terbaru yang dipakai.
+func loadAturanDenda() (map[int64]AturanDenda, *AturanDenda, error) {
+	rows, err := db.Query(`
+		SELECT id, COALESCE(properti_id, 0), jenis, nilai, masa_tenggang, akrual, COALESCE(maksimal, 0)
+		FROM aturan_denda WHERE status = 'aktif' ORDER BY id`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	perUnit := map[int64]AturanDenda{}
+	var global *AturanDenda
+	for rows.Next() {
+		var a AturanDenda
+		if err := rows.Scan(&a.ID, &a.PropertiID, &a.Jenis, &a.Nilai, &a.MasaTenggang, &a.Akrual, &a.Maksimal); err != nil {
+			return nil, nil, err
+		}
+		if a.PropertiID == 0 {
+			global = &a
+		} else {
+			perUnit[a.PropertiID] = a
+		}
+	}
+	return perUnit, global, rows.Err()
+}
+
+type tagihanTerlambat struct {
+	id, kontrakID int64
+	namaPenyewa   string
+	propertiID    int64
+	jatuhTempo    time.Time
+	nominal       float64
+	dendaID       sql.NullInt64
+	dendaStatus   string
+	dendaNominal  float64
+	dendaHari     int
+	itemDenda     sql.NullInt64
+}
+
+// terapkanDenda menambah atau memperbarui denda untuk setiap tagihan yang
+// belum lunas dan sudah lewat jatuh tempo per tanggal asOf. Nominal denda
+// tidak pernah turun, dan denda yang sudah dihapuskan tidak disentuh lagi.
+// Denda ditagihkan sebagai rincian tagihan; tagihan yang pokoknya sudah
+// terbayar berhenti diakrualkan, tetapi dendanya tetap harus dilunasi.
+func terapkanDenda(asOf time.Time, dryRun bool) (*dendaReport, error) {
+	asOf = dateOnly(asOf)
+	report := &dendaReport{Tanggal: asOf.Format("2006-01-02"), DryRun: dryRun, Denda: []dendaBaru{}}
+
+	perUnit, global, err := loadAturanDenda()
+	if err != nil {
+		return nil, err
+	}
+	if len(perUnit) == 0 && global == nil {
+		return report, nil
+	}
+
+	tagihan, err := loadTagihanTerlambat(asOf)
+	if err != nil {
+		return nil, err
+	}
+	report.Terlambat = len(tagihan)
+
+	for _, t := range tagihan {
+		if t.dendaStatus == "dihapuskan" {
+			continue
+		}
+		aturan, ok := perUnit[t.propertiID]
+		if !ok {
+			if global == nil {
+				continue
+			}
+			aturan = *global
+		}
+		nominal, hari := hitungDenda(aturan, t.nominal, t.jatuhTempo, asOf)
+		if t.dendaID.Valid && nominal <= t.dendaNominal {
+			if t.itemDenda.Valid {
+				continue
+			}
+			// Denda lama yang belum masuk rincian tagihan
+			nominal, hari = t.dendaNominal, t.dendaHari
+		}
+		if nominal <= 0 {
+			continue
+		}
+
+		denda := dendaBaru{
+			PembayaranID:  t.id,
+			NamaPenyewa:   t.namaPenyewa,
+			JatuhTempo:    t.jatuhTempo.Format("2006-01-02"),
+			HariTerlambat: hari,
+			Nominal:       nominal,
+		}
+		denda.DendaID = t.dendaID.Int64
+		if !dryRun {
+			id, err := simpanDenda(t, aturan.ID, nominal, hari, report.Tanggal)
+			if isUniqueViolation(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("denda tagihan %d: %w", t.id, err)
+			}
+			denda.DendaID = id
+		}
+		if t.dendaID.Valid {
+			report.Diperbarui++
+		} else {
+			report.Dibuat++
+		}
+		report.Denda = append(report.Denda, denda)
+	}
+
+	return report, nil
+}
+
+// simpanDenda menyimpan denda satu tagihan beserta rincian tagihannya
+// dalam satu transaksi, lalu menghitung ulang total dan jatuh tempo.
+func simpanDenda(t tagihanTerlambat, aturanID int64, nominal float64, hari int, tanggal string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var locked int64
+	if err := tx.QueryRow("SELECT id FROM pembayaran WHERE id=? FOR UPDATE", t.id).Scan(&locked); err != nil {
+		return 0, err
+	}
+
+	id := t.dendaID.Int64
+	if t.dendaID.Valid {
+		_, err = tx.Exec(`
+			UPDATE denda SET nominal=?, hari_terlambat=?, aturan_id=?, dihitung_sampai=?, updated_at=CURRENT_TIMESTAMP
+			WHERE id=? AND status='aktif'`,
+			nominal, hari, aturanID, tanggal, id)
+	} else {
+		id, err = tx.InsertID(`
+			INSERT INTO denda (pembayaran_id, kontrak_id, aturan_id, nominal, hari_terlambat, dihitung_sampai, status)
+			VALUES (?, ?, ?, ?, ?, ?, 'aktif')`,
+			t.id, nullIfZero(t.kontrakID), aturanID, nominal, hari, tanggal)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var itemID int64
+	err = tx.QueryRow("SELECT id FROM tagihan_item WHERE denda_id=?", id).Scan(&itemID)
+	deskripsi := fmt.Sprintf("Denda keterlambatan %d hari", hari)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.Exec(`
+			INSERT INTO tagihan_item (pembayaran_id, jenis, deskripsi, jumlah, harga_satuan, nominal, denda_id)
+			VALUES (?, 'denda', ?, 1, ?, ?, ?)`,
+			t.id, deskripsi, nominal, nominal, id)
+	case err == nil:
+		_, err = tx.Exec("UPDATE tagihan_item SET deskripsi=?, harga_satuan=?, nominal=? WHERE id=?", deskripsi, nominal, nominal, itemID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := hitungTotalTagihan(tx, t.id); err != nil {
+		return 0, err
+	}
+	if err := recalcJatuhTempoPembayaran(tx, t.id); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// loadTagihanTerlambat memakai aturan bayar yang sama dengan jatuh tempo:
+// uang_dibayar NULL (data lama) dianggap lunas, dan cicilan di riwayat
+// dihitung jika totalnya lebih besar dari uang_dibayar. Nominal yang
+// dikembalikan adalah pokok tagihan, tanpa rincian dendanya sendiri.
+func loadTagihanTerlambat(asOf time.Time) ([]tagihanTerlambat, error) {
+	rows, err := db.Query(`
+		SELECT pb.id, COALESCE(pb.kontrak_id, 0), COALESCE(py.nama, ''), COALESCE(k.properti_id, py.properti_id, 0),
+		       pb.jatuh_tempo, pb.nominal - COALESCE(i.nominal, 0), d.id, COALESCE(d.status, ''), COALESCE(d.nominal, 0),
+		       COALESCE(d.hari_terlambat, 0), i.id
+		FROM pembayaran pb
+		LEFT JOIN kontrak k ON k.id = pb.kontrak_id
+		LEFT JOIN penyewa py ON py.id = pb.penyewa_id
+		LEFT JOIN denda d ON d.pembayaran_id = pb.id
+		LEFT JOIN tagihan_item i ON i.denda_id = d.id
+		WHERE pb.jatuh_tempo IS NOT NULL AND pb.jatuh_tempo < ?
+		  AND GREATEST(COALESCE(pb.uang_dibayar, pb.nominal),
+		               (SELECT COALESCE(SUM(r.jumlah_dibayar - r.lebih_bayar), 0) FROM riwayat_pembayaran r WHERE r.pembayaran_id = pb.id)
+		      ) < pb.nominal - COALESCE(i.nominal, 0) - 0.005
+		ORDER BY pb.jatuh_tempo, pb.id`, asOf.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []tagihanTerlambat
+	for rows.Next() {
+		var t tagihanTerlambat
+		if err := rows.Scan(&t.id, &t.kontrakID, &t.namaPenyewa, &t.propertiID, &t.jatuhTempo, &t.nominal,
+			&t.dendaID, &t.dendaStatus, &t.dendaNominal, &t.dendaHari, &t.itemDenda); err != nil {
+			return nil, err
+		}
+		t.jatuhTempo = dateOnly(t.jatuhTempo)
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func nullIfZero(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func runApplyPenaltiesCommand(args []string) error {
+	fs := flag.NewFlagSet("apply-penalties", flag.ExitOnError)
+	date := fs.String("date", time.Now().Format("2006-01-02"), "hitung denda per tanggal ini (YYYY-MM-DD)")
+	dryRun := fs.Bool("dry-run", false, "tampilkan denda yang akan dibuat tanpa menyimpan")
+	fs.Parse(args)
+
+	asOf, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		return fmt.Errorf("-date harus berformat YYYY-MM-DD")
+	}
+
+	report, err := terapkanDenda(asOf, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TAGIHAN\tPENYEWA\tJATUH TEMPO\tTERLAMBAT\tDENDA")
+	for _, d := range report.Denda {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d hari\t%s\n", d.PembayaranID, d.NamaPenyewa, d.JatuhTempo, d.HariTerlambat, formatRupiah(d.Nominal))
+	}
+	w.Flush()
+	fmt.Printf("\n%d tagihan terlambat, %d denda baru, %d denda diperbarui (dry-run: %v)\n",
+		report.Terlambat, report.Dibuat, report.Diperbarui, report.DryRun)
+	return nil
+}
+
+// DENDA HANDLERS
+func getAturanDenda(c *gin.Context) {
+	rows, err := db.Query(`
+		SELECT a.id, COALESCE(a.properti_id, 0), COALESCE(pr.nama_unit, ''), a.jenis, a.nilai, a.masa_tenggang,
+		       a.akrual, COALESCE(a.maksimal, 0), a.status, COALESCE(a.keterangan, '')
+		FROM aturan_denda a
+		LEFT JOIN properti pr ON pr.id = a.properti_id
+		ORDER BY a.properti_id IS NULL DESC, a.id`)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	aturan := []AturanDenda{}
+	for rows.Next() {
+		var a AturanDenda
+		if err := rows.Scan(&a.ID, &a.PropertiID, &a.NamaUnit, &a.Jenis, &a.Nilai, &a.MasaTenggang,
+			&a.Akrual, &a.Maksimal, &a.Status, &a.Keterangan); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		aturan = append(aturan, a)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, aturan)
+}
+
+// validateAturanDenda memeriksa aturan baru (stored nil) atau PATCH atas
+// aturan tersimpan; batas persen dicek terhadap jenis dan nilai akhirnya.
+func validateAturanDenda(in *requestInput, stored *AturanDenda) []FieldError {
+	var fieldErrors []FieldError
+	for _, field := range []string{"jenis", "nilai"} {
+		if stored == nil || in.Has(field) {
+			fieldErrors = append(fieldErrors, requiredFields(in, field)...)
+		}
+	}
+	fieldErrors = append(fieldErrors, numericFields(in, "properti_id", "nilai", "maksimal")...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "jenis", jenisDendaValid)...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "akrual", akrualDendaValid)...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "status", statusAturanDendaValid)...)
+
+	if value := in.Get("masa_tenggang"); value != "" {
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			fieldErrors = append(fieldErrors, FieldError{Field: "masa_tenggang", Message: "masa_tenggang harus berupa jumlah hari (0 atau lebih)"})
+		}
+	}
+	jenis, nilai := in.Get("jenis"), 0.0
+	if stored != nil {
+		if !in.Has("jenis") {
+			jenis = stored.Jenis
+		}
+		nilai = stored.Nilai
+	}
+	if value, err := strconv.ParseFloat(in.Get("nilai"), 64); err == nil {
+		if value <= 0 {
+			fieldErrors = append(fieldErrors, FieldError{Field: "nilai", Message: "nilai harus lebih dari 0"})
+		}
+		nilai = value
+	}
+	if jenis == "persen" && nilai > 100 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "nilai", Message: "nilai persen tidak boleh lebih dari 100"})
+	}
+	return fieldErrors
+}
+
+func createAturanDenda(c *gin.Context) {
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateAturanDenda(in, nil); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	masaTenggang, _ := strconv.Atoi(in.Get("masa_tenggang"))
+	akrual := in.Get("akrual")
+	if akrual == "" {
+		akrual = "harian"
+	}
+	status := in.Get("status")
+	if status == "" {
+		status = "aktif"
+	}
+
+	id, err := db.InsertID(`
+		INSERT INTO aturan_denda (properti_id, jenis, nilai, masa_tenggang, akrual, maksimal, status, keterangan)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		nullIfEmpty(in.Get("properti_id")), in.Get("jenis"), in.Get("nilai"), masaTenggang, akrual,
+		nullIfEmpty(in.Get("maksimal")), status, nullIfEmpty(in.Get("keterangan")),
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Aturan denda berhasil dibuat"})
+}
+
+func patchAturanDenda(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	var stored AturanDenda
+	err = db.QueryRow("SELECT jenis, nilai FROM aturan_denda WHERE id=?", id).Scan(&stored.Jenis, &stored.Nilai)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data aturan denda tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if fieldErrors := validateAturanDenda(in, &stored); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	sets, args := buildPatch(in, []patchField{
+		{Field: "properti_id", Column: "properti_id", Nullable: true},
+		{Field: "jenis", Column: "jenis"},
+		{Field: "nilai", Column: "nilai"},
+		{Field: "masa_tenggang", Column: "masa_tenggang"},
+		{Field: "akrual", Column: "akrual"},
+		{Field: "maksimal", Column: "maksimal", Nullable: true},
+		{Field: "status", Column: "status"},
+		{Field: "keterangan", Column: "keterangan", Nullable: true},
+	})
+	if len(sets) == 0 {
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Tidak ada field yang diubah", nil)
+		return
+	}
+
+	sets = append(sets, "updated_at=CURRENT_TIMESTAMP")
+	args = append(args, id)
+	if _, err := db.Exec("UPDATE aturan_denda SET "+strings.Join(sets, ", ")+" WHERE id=?", args...); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Aturan denda berhasil diupdate"})
+}
+
+// deleteAturanDenda tidak menghapus denda yang sudah tercatat; aturan_id
+// pada denda itu menjadi NULL.
+func deleteAturanDenda(c *gin.Context) {
+	result, err := db.Exec("DELETE FROM aturan_denda WHERE id=?", c.Param("id"))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	respondDeleted(c, result, "aturan denda", "Aturan denda berhasil dihapus")
+}
+
+func getDenda(c *gin.Context) {
+	filter := dendaFilter(c)
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT d.id, d.pembayaran_id, COALESCE(d.kontrak_id, 0), pb.penyewa_id, COALESCE(py.nama, ''),
+		       pb.jatuh_tempo, pb.nominal, d.nominal, d.hari_terlambat, d.dihitung_sampai, d.status,
+		       COALESCE(d.alasan_penghapusan, ''), COALESCE(d.dihapuskan_oleh, ''), d.dihapuskan_pada
+		FROM denda d
+		JOIN pembayaran pb ON pb.id = d.pembayaran_id
+		LEFT JOIN penyewa py ON py.id = pb.penyewa_id`+filter.where()+`
+		ORDER BY d.dihitung_sampai DESC, d.id DESC`, filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	denda := []gin.H{}
+	for rows.Next() {
+		var id, pembayaranID, kontrakID, penyewaID int64
+		var nama, status, alasan, oleh string
+		var jatuhTempo, sampai sql.NullTime
+		var dihapuskanPada sql.NullTime
+		var nominalTagihan, nominal float64
+		var hari int
+		if err := rows.Scan(&id, &pembayaranID, &kontrakID, &penyewaID, &nama, &jatuhTempo, &nominalTagihan, &nominal,
+			&hari, &sampai, &status, &alasan, &oleh, &dihapuskanPada); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		item := gin.H{
+			"id":                 id,
+			"pembayaran_id":      pembayaranID,
+			"kontrak_id":         kontrakID,
+			"penyewa_id":         penyewaID,
+			"nama_penyewa":       nama,
+			"jatuh_tempo":        dateString(jatuhTempo),
+			"nominal_tagihan":    nominalTagihan,
+			"nominal":            nominal,
+			"hari_terlambat":     hari,
+			"dihitung_sampai":    dateString(sampai),
+			"status":             status,
+			"alasan_penghapusan": alasan,
+			"dihapuskan_oleh":    oleh,
+			"dihapuskan_pada":    "",
+		}
+		if dihapuskanPada.Valid {
+			item["dihapuskan_pada"] = dihapuskanPada.Time.Format(time.RFC3339)
+		}
+		denda = append(denda, item)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, denda)
+}
+
+// POST /api/denda/:id/hapuskan membebaskan penyewa dari denda dan
+// menghapus rinciannya dari tagihan. Alasan wajib diisi supaya keputusan
+// admin bisa ditelusuri.
+func hapuskanDenda(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := requiredFields(in, "alasan"); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var pembayaranID int64
+	var status string
+	err = tx.QueryRow("SELECT pembayaran_id, status FROM denda WHERE id=? FOR UPDATE", id).Scan(&pembayaranID, &status)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data denda tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if status == "dihapuskan" {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Denda sudah dihapuskan", nil)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE denda SET status='dihapuskan', alasan_penghapusan=?, dihapuskan_oleh=?,
+		       dihapuskan_pada=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP
+		WHERE id=?`,
+		in.Get("alasan"), nullIfEmpty(namaAktor(c, in)), id,
+	)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM tagihan_item WHERE denda_id=?", id)
+	}
+	if err == nil {
+		_, err = hitungTotalTagihan(tx, pembayaranID)
+	}
+	if err == nil {
+		err = recalcJatuhTempoPembayaran(tx, pembayaranID)
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Denda berhasil dihapuskan"})
+}
+
+// POST /api/denda/hitung menjalankan perhitungan denda secara manual
+// (tanggal opsional, dry_run=true untuk preview).
+func hitungDendaHandler(c *gin.Context) {
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := dateFields(in, "tanggal"); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	asOf := time.Now()
+	if tanggal := in.Get("tanggal"); tanggal != "" {
+		asOf, _ = time.Parse("2006-01-02", convertDateFormat(tanggal))
+	}
+
+	report, err := terapkanDenda(asOf, in.Get("dry_run") == "true")
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
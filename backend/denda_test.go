@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestHitungDenda(t *testing.T) {
+	harian := AturanDenda{Jenis: "flat", Nilai: 10000, Akrual: "harian", MasaTenggang: 3}
+	persen := AturanDenda{Jenis: "persen", Nilai: 1, Akrual: "harian", MasaTenggang: 3}
+	maksimal := AturanDenda{Jenis: "flat", Nilai: 10000, Akrual: "harian", MasaTenggang: 3, Maksimal: 50000}
+	bulanan := AturanDenda{Jenis: "flat", Nilai: 100000, Akrual: "bulanan", MasaTenggang: 3}
+
+	tests := []struct {
+		name      string
+		aturan    AturanDenda
+		asOf      string
+		wantDenda float64
+		wantHari  int
+	}{
+		{"masih masa tenggang", harian, "2026-03-04", 0, 0},
+		{"sebelum jatuh tempo", harian, "2026-02-20", 0, 0},
+		{"flat harian", harian, "2026-03-07", 30000, 3},
+		{"persen harian", persen, "2026-03-05", 10000, 1},
+		{"dibatasi maksimal", maksimal, "2026-03-24", 50000, 20},
+		{"bulanan hari pertama", bulanan, "2026-03-05", 100000, 1},
+		{"bulanan genap sebulan", bulanan, "2026-04-04", 100000, 31},
+		{"bulanan bulan kedua", bulanan, "2026-04-05", 200000, 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denda, hari := hitungDenda(tt.aturan, 1000000, tanggal("2026-03-01"), tanggal(tt.asOf))
+			if denda != tt.wantDenda || hari != tt.wantHari {
+				t.Fatalf("got %v, %d hari; want %v, %d hari", denda, hari, tt.wantDenda, tt.wantHari)
+			}
+		})
+	}
+}
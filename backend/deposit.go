@@ -0,0 +1,360 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DepositTransaksi adalah satu baris buku kas uang jaminan.
+type DepositTransaksi struct {
+	ID           int64   `json:"id"`
+	Jenis        string  `json:"jenis"`
+	Kategori     string  `json:"kategori"`
+	Nominal      float64 `json:"nominal"`
+	Tanggal      string  `json:"tanggal"`
+	MetodeBayar  string  `json:"metode_bayar"`
+	PembayaranID int64   `json:"pembayaran_id"`
+	Keterangan   string  `json:"keterangan"`
+}
+
+// DepositStatement adalah rekap deposit satu kontrak, dipakai sebagai
+// laporan untuk penyewa saat settlement.
+type DepositStatement struct {
+	KontrakID   int64              `json:"kontrak_id"`
+	NamaPenyewa string             `json:"nama_penyewa"`
+	NamaUnit    string             `json:"nama_unit"`
+	Disepakati  float64            `json:"disepakati"`
+	Diterima    float64            `json:"diterima"`
+	Potongan    float64            `json:"potongan"`
+	Refund      float64            `json:"refund"`
+	Saldo       float64            `json:"saldo"`
+	Tunggakan   float64            `json:"tunggakan"`
+	Selesai     string             `json:"selesai"`
+	Transaksi   []DepositTransaksi `json:"transaksi"`
+}
+
+var (
+	jenisDepositValid     = []string{"terima", "potong"}
+	kategoriPotongValid   = []string{"kerusakan", "tunggakan", "lainnya"}
+	errDepositSelesai     = errors.New("deposit kontrak sudah diselesaikan")
+	errSaldoDepositKurang = errors.New("potongan melebihi saldo deposit")
+)
+
+func respondDepositError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errDepositSelesai):
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Deposit kontrak sudah diselesaikan", nil)
+	case errors.Is(err, errSaldoDepositKurang):
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Potongan melebihi saldo deposit", nil)
+	default:
+		respondDBError(c, err)
+	}
+}
+
+// loadDepositStatement mengembalikan sql.ErrNoRows jika kontrak tidak ada.
+func loadDepositStatement(q querier, kontrakID int64) (*DepositStatement, error) {
+	s := &DepositStatement{KontrakID: kontrakID, Transaksi: []DepositTransaksi{}}
+	var selesai sql.NullTime
+	err := q.QueryRow(`
+		SELECT COALESCE(py.nama, ''), COALESCE(pr.nama_unit, ''), k.deposit, k.deposit_selesai
+		FROM kontrak k
+		LEFT JOIN penyewa py ON py.id = k.penyewa_id
+		LEFT JOIN properti pr ON pr.id = k.properti_id
+		WHERE k.id = ?`, kontrakID).Scan(&s.NamaPenyewa, &s.NamaUnit, &s.Disepakati, &selesai)
+	if err != nil {
+		return nil, err
+	}
+	s.Selesai = dateString(selesai)
+
+	rows, err := q.Query(`
+		SELECT id, jenis, COALESCE(kategori, ''), nominal, tanggal, COALESCE(metode_bayar, ''),
+		       COALESCE(pembayaran_id, 0), COALESCE(keterangan, '')
+		FROM deposit_transaksi WHERE kontrak_id = ?
+		ORDER BY tanggal, id`, kontrakID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t DepositTransaksi
+		var tanggal sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Jenis, &t.Kategori, &t.Nominal, &tanggal, &t.MetodeBayar, &t.PembayaranID, &t.Keterangan); err != nil {
+			return nil, err
+		}
+		t.Tanggal = dateString(tanggal)
+		switch t.Jenis {
+		case "terima":
+			s.Diterima += t.Nominal
+		case "potong":
+			s.Potongan += t.Nominal
+		case "refund":
+			s.Refund += t.Nominal
+		}
+		s.Transaksi = append(s.Transaksi, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.Saldo = s.Diterima - s.Potongan - s.Refund
+
+	tunggakan, err := loadTunggakanKontrak(q, kontrakID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tunggakan {
+		s.Tunggakan += t.sisa
+	}
+	return s, nil
+}
+
+type tunggakanTagihan struct {
+	pembayaranID int64
+	sisa         float64
+}
+
+// loadTunggakanKontrak mengembalikan tagihan yang belum lunas, urut dari
+// jatuh tempo terlama.
+func loadTunggakanKontrak(q querier, kontrakID int64) ([]tunggakanTagihan, error) {
+	rows, err := q.Query(`
+		SELECT pb.id, pb.nominal - GREATEST(COALESCE(pb.uang_dibayar, pb.nominal),
+		       (SELECT COALESCE(SUM(r.jumlah_dibayar - r.lebih_bayar), 0) FROM riwayat_pembayaran r WHERE r.pembayaran_id = pb.id))
+		FROM pembayaran pb
+		WHERE pb.kontrak_id = ?
+		ORDER BY COALESCE(pb.jatuh_tempo, pb.tanggal_mulai, pb.tanggal_bayar), pb.id`, kontrakID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []tunggakanTagihan
+	for rows.Next() {
+		var t tunggakanTagihan
+		if err := rows.Scan(&t.pembayaranID, &t.sisa); err != nil {
+			return nil, err
+		}
+		if t.sisa > 0.005 {
+			list = append(list, t)
+		}
+	}
+	return list, rows.Err()
+}
+
+// selesaikanDeposit memotong saldo deposit untuk tunggakan sewa (dicatat
+// juga sebagai cicilan dengan metode "Deposit" supaya tagihan ikut lunas),
+// lalu mengembalikan sisanya sebagai refund. Potongan kerusakan dicatat
+// lebih dulu lewat POST /api/kontrak/:id/deposit.
+func selesaikanDeposit(tx *Tx, kontrakID int64, tanggal, metodeRefund string) (*DepositStatement, error) {
+	s, err := loadDepositStatement(tx, kontrakID)
+	if err != nil {
+		return nil, err
+	}
+	if s.Selesai != "" {
+		return nil, errDepositSelesai
+	}
+
+	saldo := s.Saldo
+	tunggakan, err := loadTunggakanKontrak(tx, kontrakID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tunggakan {
+		if saldo <= 0.005 {
+			break
+		}
+		jumlah := math.Min(t.sisa, saldo)
+		if _, err := tx.Exec(`
+			INSERT INTO deposit_transaksi (kontrak_id, jenis, kategori, nominal, tanggal, pembayaran_id, keterangan)
+			VALUES (?, 'potong', 'tunggakan', ?, ?, ?, ?)`,
+			kontrakID, jumlah, tanggal, t.pembayaranID, "Potong tunggakan tagihan #"+strconv.FormatInt(t.pembayaranID, 10),
+		); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO riwayat_pembayaran (pembayaran_id, kontrak_id, jumlah_dibayar, tanggal_bayar, metode_bayar, keterangan)
+			VALUES (?, ?, ?, ?, 'Deposit', 'Dipotong dari deposit')`,
+			t.pembayaranID, kontrakID, jumlah, tanggal,
+		); err != nil {
+			return nil, err
+		}
+		if err := sinkronPembayaran(tx, t.pembayaranID); err != nil {
+			return nil, err
+		}
+		saldo -= jumlah
+	}
+
+	if saldo > 0.005 {
+		if metodeRefund == "" {
+			metodeRefund = "Transfer"
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO deposit_transaksi (kontrak_id, jenis, nominal, tanggal, metode_bayar, keterangan)
+			VALUES (?, 'refund', ?, ?, ?, 'Pengembalian sisa deposit')`,
+			kontrakID, saldo, tanggal, metodeRefund,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE kontrak SET deposit_selesai=?, updated_at=CURRENT_TIMESTAMP WHERE id=?", tanggal, kontrakID); err != nil {
+		return nil, err
+	}
+	if err := recalcJatuhTempo(tx, kontrakID); err != nil {
+		return nil, err
+	}
+	return loadDepositStatement(tx, kontrakID)
+}
+
+// DEPOSIT HANDLERS
+func getDeposit(c *gin.Context) {
+	kontrakID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondNotFound(c, "Data kontrak tidak ditemukan")
+		return
+	}
+
+	s, err := loadDepositStatement(db, kontrakID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func validateDepositTransaksi(in *requestInput) []FieldError {
+	fieldErrors := requiredFields(in, "jenis", "nominal")
+	fieldErrors = append(fieldErrors, numericFields(in, "nominal")...)
+	fieldErrors = append(fieldErrors, dateFields(in, "tanggal")...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "jenis", jenisDepositValid)...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "kategori", kategoriPotongValid)...)
+	if in.Get("jenis") == "potong" {
+		fieldErrors = append(fieldErrors, requiredFields(in, "kategori")...)
+	}
+	if nominal, err := strconv.ParseFloat(in.Get("nominal"), 64); err == nil && nominal <= 0 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "nominal", Message: "nominal harus lebih dari 0"})
+	}
+	return fieldErrors
+}
+
+// POST /api/kontrak/:id/deposit mencatat setoran deposit (jenis terima)
+// atau potongan kerusakan (jenis potong). Setoran deposit bukan pendapatan
+// sewa dan tidak masuk totalPendapatan dashboard.
+func addDepositTransaksi(c *gin.Context) {
+	kontrakID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondNotFound(c, "Data kontrak tidak ditemukan")
+		return
+	}
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateDepositTransaksi(in); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	tanggal := convertDateFormat(in.Get("tanggal"))
+	if tanggal == "" {
+		tanggal = time.Now().Format("2006-01-02")
+	}
+	nominal, _ := strconv.ParseFloat(in.Get("nominal"), 64)
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	s, err := loadDepositStatement(tx, kontrakID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if s.Selesai != "" {
+		respondDepositError(c, errDepositSelesai)
+		return
+	}
+	if in.Get("jenis") == "potong" && nominal > s.Saldo+0.005 {
+		respondDepositError(c, errSaldoDepositKurang)
+		return
+	}
+
+	kategori := ""
+	if in.Get("jenis") == "potong" {
+		kategori = in.Get("kategori")
+	}
+	id, err := tx.InsertID(`
+		INSERT INTO deposit_transaksi (kontrak_id, jenis, kategori, nominal, tanggal, metode_bayar, keterangan)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		kontrakID, in.Get("jenis"), nullIfEmpty(kategori), nominal, tanggal,
+		nullIfEmpty(in.Get("metode_bayar")), nullIfEmpty(in.Get("keterangan")),
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Transaksi deposit berhasil dicatat"})
+}
+
+// POST /api/kontrak/:id/deposit/settle menyelesaikan deposit: saldo
+// dipotong untuk tunggakan sewa dan sisanya dikembalikan. dry_run=true
+// mengembalikan statement tanpa menyimpan perubahan.
+func settleDeposit(c *gin.Context) {
+	kontrakID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondNotFound(c, "Data kontrak tidak ditemukan")
+		return
+	}
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := dateFields(in, "tanggal"); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	tanggal := convertDateFormat(in.Get("tanggal"))
+	if tanggal == "" {
+		tanggal = time.Now().Format("2006-01-02")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	s, err := selesaikanDeposit(tx, kontrakID, tanggal, in.Get("metode_bayar"))
+	if err != nil {
+		respondDepositError(c, err)
+		return
+	}
+	if in.Get("dry_run") == "true" {
+		c.JSON(http.StatusOK, s)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AturanDiskon memotong sewa sebuah tagihan. MinBulan untuk diskon bayar
+// beberapa bulan sekaligus ("bayar 6 bulan diskon 5%"), MinLamaBulan untuk
+// diskon penyewa lama. Tanpa properti_id berlaku untuk semua unit.
+type AturanDiskon struct {
+	ID           int64   `json:"id"`
+	Nama         string  `json:"nama"`
+	PropertiID   int64   `json:"properti_id"`
+	NamaUnit     string  `json:"nama_unit"`
+	Jenis        string  `json:"jenis"`
+	Nilai        float64 `json:"nilai"`
+	MinBulan     int     `json:"min_bulan"`
+	MinLamaBulan int     `json:"min_lama_bulan"`
+	Status       string  `json:"status"`
+	Keterangan   string  `json:"keterangan"`
+}
+
+var jenisDiskonValid = []string{"persen", "flat"}
+
+// bulanBerjalan menghitung bulan penuh dari dari sampai sampai.
+func bulanBerjalan(dari, sampai time.Time) int {
+	bulan := (sampai.Year()-dari.Year())*12 + int(sampai.Month()-dari.Month())
+	if sampai.Day() < dari.Day() {
+		bulan--
+	}
+	if bulan < 0 {
+		return 0
+	}
+	return bulan
+}
+
+// potonganDiskon: persen dihitung dari sewa, flat sekali per tagihan.
+func potonganDiskon(a AturanDiskon, sewa float64) float64 {
+	if a.Jenis == "persen" {
+		return math.Round(sewa*a.Nilai/100*100) / 100
+	}
+	return a.Nilai
+}
+
+// terapkanDiskon menyusun ulang rincian diskon otomatis sebuah tagihan
+// dari aturan yang berlaku. Total potongan tidak melebihi sewa.
+func terapkanDiskon(q querier, pembayaranID int64) error {
+	if _, err := q.Exec("DELETE FROM tagihan_item WHERE pembayaran_id=? AND aturan_diskon_id IS NOT NULL", pembayaranID); err != nil {
+		return err
+	}
+
+	var propertiID sql.NullInt64
+	var mulaiKontrak, mulai, akhir sql.NullTime
+	var sewa float64
+	err := q.QueryRow(`
+		SELECT k.properti_id, k.tanggal_mulai, COALESCE(pb.tanggal_mulai, pb.tanggal_bayar), pb.tanggal_akhir,
+		       (SELECT COALESCE(SUM(i.nominal), 0) FROM tagihan_item i WHERE i.pembayaran_id = pb.id AND i.jenis = 'sewa')
+		FROM pembayaran pb
+		JOIN kontrak k ON k.id = pb.kontrak_id
+		WHERE pb.id=?`, pembayaranID).Scan(&propertiID, &mulaiKontrak, &mulai, &akhir, &sewa)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if sewa <= 0 {
+		return nil
+	}
+
+	bulan := 1
+	if akhir.Valid {
+		bulan = durasiBulan(dateOnly(mulai.Time), dateOnly(akhir.Time))
+	}
+	lama := bulanBerjalan(dateOnly(mulaiKontrak.Time), dateOnly(mulai.Time))
+
+	rows, err := q.Query(`
+		SELECT id, nama, jenis, nilai
+		FROM aturan_diskon
+		WHERE status='aktif' AND (properti_id IS NULL OR properti_id=?) AND min_bulan <= ? AND min_lama_bulan <= ?
+		ORDER BY id`, propertiID.Int64, bulan, lama)
+	if err != nil {
+		return err
+	}
+	var aturan []AturanDiskon
+	for rows.Next() {
+		var a AturanDiskon
+		if err := rows.Scan(&a.ID, &a.Nama, &a.Jenis, &a.Nilai); err != nil {
+			rows.Close()
+			return err
+		}
+		aturan = append(aturan, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sisa := sewa
+	for _, a := range aturan {
+		potongan := math.Min(potonganDiskon(a, sewa), sisa)
+		if potongan <= 0 {
+			continue
+		}
+		sisa -= potongan
+
+		deskripsi := "Diskon " + a.Nama
+		if a.Jenis == "persen" {
+			deskripsi += fmt.Sprintf(" (%s%%)", strconv.FormatFloat(a.Nilai, 'f', -1, 64))
+		}
+		if _, err := q.Exec(`
+			INSERT INTO tagihan_item (pembayaran_id, jenis, deskripsi, jumlah, harga_satuan, nominal, aturan_diskon_id)
+			VALUES (?, 'diskon', ?, 1, ?, ?, ?)`,
+			pembayaranID, deskripsi, -potongan, -potongan, a.ID,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DISKON HANDLERS
+func getAturanDiskon(c *gin.Context) {
+	rows, err := db.Query(`
+		SELECT d.id, d.nama, COALESCE(d.properti_id, 0), COALESCE(pr.nama_unit, ''), d.jenis, d.nilai,
+		       d.min_bulan, d.min_lama_bulan, d.status, COALESCE(d.keterangan, '')
+		FROM aturan_diskon d
+		LEFT JOIN properti pr ON pr.id = d.properti_id
+		ORDER BY d.properti_id IS NULL DESC, d.id`)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	aturan := []AturanDiskon{}
+	for rows.Next() {
+		var a AturanDiskon
+		if err := rows.Scan(&a.ID, &a.Nama, &a.PropertiID, &a.NamaUnit, &a.Jenis, &a.Nilai,
+			&a.MinBulan, &a.MinLamaBulan, &a.Status, &a.Keterangan); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		aturan = append(aturan, a)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, aturan)
+}
+
+func validateAturanDiskon(in *requestInput, partial bool) []FieldError {
+	var fieldErrors []FieldError
+	for _, field := range []string{"nama", "jenis", "nilai"} {
+		if !partial || in.Has(field) {
+			fieldErrors = append(fieldErrors, requiredFields(in, field)...)
+		}
+	}
+	fieldErrors = append(fieldErrors, numericFields(in, "properti_id", "nilai", "min_bulan", "min_lama_bulan")...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "jenis", jenisDiskonValid)...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "status", statusAturanDendaValid)...)
+	if nilai, err := strconv.ParseFloat(in.Get("nilai"), 64); err == nil && in.Get("jenis") == "persen" && nilai > 100 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "nilai", Message: "nilai persen tidak boleh lebih dari 100"})
+	}
+	return fieldErrors
+}
+
+func createAturanDiskon(c *gin.Context) {
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateAturanDiskon(in, false); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	status := in.Get("status")
+	if status == "" {
+		status = "aktif"
+	}
+	angka := func(field string) string {
+		if v := in.Get(field); v != "" {
+			return v
+		}
+		return "0"
+	}
+
+	id, err := db.InsertID(`
+		INSERT INTO aturan_diskon (nama, properti_id, jenis, nilai, min_bulan, min_lama_bulan, status, keterangan)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		in.Get("nama"), nullIfEmpty(in.Get("properti_id")), in.Get("jenis"), in.Get("nilai"),
+		angka("min_bulan"), angka("min_lama_bulan"), status, nullIfEmpty(in.Get("keterangan")),
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Aturan diskon berhasil dibuat"})
+}
+
+func patchAturanDiskon(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateAturanDiskon(in, true); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "aturan_diskon", id) {
+		return
+	}
+
+	sets, args := buildPatch(in, []patchField{
+		{Field: "nama", Column: "nama"},
+		{Field: "properti_id", Column: "properti_id", Nullable: true},
+		{Field: "jenis", Column: "jenis"},
+		{Field: "nilai", Column: "nilai"},
+		{Field: "min_bulan", Column: "min_bulan"},
+		{Field: "min_lama_bulan", Column: "min_lama_bulan"},
+		{Field: "status", Column: "status"},
+		{Field: "keterangan", Column: "keterangan", Nullable: true},
+	})
+	if len(sets) == 0 {
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Tidak ada field yang diubah", nil)
+		return
+	}
+
+	sets = append(sets, "updated_at=CURRENT_TIMESTAMP")
+	args = append(args, id)
+	if _, err := db.Exec("UPDATE aturan_diskon SET "+strings.Join(sets, ", ")+" WHERE id=?", args...); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Aturan diskon berhasil diupdate"})
+}
+
+// deleteAturanDiskon tidak mengubah tagihan yang sudah dibuat.
+func deleteAturanDiskon(c *gin.Context) {
+	result, err := db.Exec("DELETE FROM aturan_diskon WHERE id=?", c.Param("id"))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	respondDeleted(c, result, "aturan diskon", "Aturan diskon berhasil dihapus")
+}
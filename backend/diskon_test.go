@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestBulanBerjalan(t *testing.T) {
+	tests := []struct {
+		dari, sampai string
+		want         int
+	}{
+		{"2025-01-15", "2026-01-15", 12},
+		{"2025-01-15", "2026-01-14", 11},
+		{"2026-01-01", "2026-01-31", 0},
+		{"2026-01-31", "2026-02-28", 0},
+		{"2026-01-31", "2026-03-31", 2},
+		{"2026-03-01", "2026-01-01", 0},
+	}
+	for _, tt := range tests {
+		if got := bulanBerjalan(tanggal(tt.dari), tanggal(tt.sampai)); got != tt.want {
+			t.Errorf("bulanBerjalan(%s, %s) = %d, want %d", tt.dari, tt.sampai, got, tt.want)
+		}
+	}
+}
+
+func TestPotonganDiskon(t *testing.T) {
+	tests := []struct {
+		name string
+		a    AturanDiskon
+		sewa float64
+		want float64
+	}{
+		{"persen", AturanDiskon{Jenis: "persen", Nilai: 5}, 6000000, 300000},
+		{"persen dibulatkan ke sen", AturanDiskon{Jenis: "persen", Nilai: 10}, 1234567, 123456.7},
+		{"flat tidak tergantung sewa", AturanDiskon{Jenis: "flat", Nilai: 100000}, 3000000, 100000},
+	}
+	for _, tt := range tests {
+		if got := potonganDiskon(tt.a, tt.sewa); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
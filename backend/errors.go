@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// Katalog kode error yang dikirim ke frontend. Kode bersifat stabil dan
+// boleh dipakai untuk logika di client, sedangkan message untuk ditampilkan.
+const (
+	ErrCodeInvalidRequest   = "INVALID_REQUEST"
+	ErrCodeValidationFailed = "VALIDATION_FAILED"
+	ErrCodeNotFound         = "NOT_FOUND"
+	ErrCodeConflict         = "CONFLICT"
+	ErrCodeUnauthorized     = "UNAUTHORIZED"
+	ErrCodeDemoAccessDenied = "DEMO_ACCESS_DENIED"
+	ErrCodeUploadFailed     = "UPLOAD_FAILED"
+	ErrCodeInternal         = "INTERNAL_ERROR"
+)
+
+// APIError adalah satu-satunya bentuk body error yang dikirim API.
+type APIError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id"`
+}
+
+// FieldError menjelaskan kesalahan validasi pada satu field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+const requestIDKey = "request_id"
+
+// requestIDMiddleware memberi setiap request ID yang ikut dikirim di
+// header X-Request-ID dan di body error, supaya mudah dicocokkan dengan log.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if requestID == "" || len(requestID) > 64 {
+			buf := make([]byte, 8)
+			rand.Read(buf)
+			requestID = hex.EncodeToString(buf)
+		}
+
+		c.Set(requestIDKey, requestID)
+		c.Writer.Header().Set("X-Request-ID", requestID)
+		c.Next()
+	}
+}
+
+func respondError(c *gin.Context, status int, code, message string, details interface{}) {
+	c.AbortWithStatusJSON(status, APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: c.GetString(requestIDKey),
+	})
+}
+
+func respondValidation(c *gin.Context, fieldErrors []FieldError) {
+	message := "Data tidak valid"
+	if len(fieldErrors) == 1 {
+		message = fieldErrors[0].Message
+	}
+	respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, message, fieldErrors)
+}
+
+func respondNotFound(c *gin.Context, message string) {
+	respondError(c, http.StatusNotFound, ErrCodeNotFound, message, nil)
+}
+
+func respondInvalidRequest(c *gin.Context, err error) {
+	log.Printf("[%s] invalid request: %v", c.GetString(requestIDKey), err)
+	respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Format request tidak valid", nil)
+}
+
+// respondInternal mencatat error asli di log server dan hanya mengirim
+// pesan umum ke client.
+func respondInternal(c *gin.Context, err error) {
+	log.Printf("[%s] internal error: %v", c.GetString(requestIDKey), err)
+	respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Terjadi kesalahan pada server", nil)
+}
+
+// respondDBError menerjemahkan error driver MySQL/PostgreSQL menjadi kode
+// API. Pesan SQL asli tidak pernah dikirim ke client.
+func respondDBError(c *gin.Context, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		respondNotFound(c, "Data tidak ditemukan")
+		return
+	}
+
+	log.Printf("[%s] database error: %v", c.GetString(requestIDKey), err)
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1062:
+			respondError(c, http.StatusConflict, ErrCodeConflict, "Data sudah ada", nil)
+			return
+		case 1451:
+			respondError(c, http.StatusConflict, ErrCodeConflict, "Data masih dipakai oleh data lain", nil)
+			return
+		case 1452:
+			respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Data referensi tidak ditemukan", nil)
+			return
+		case 1048, 1264, 1265, 1292, 1366, 3819:
+			respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Nilai field tidak valid", nil)
+			return
+		}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505":
+			respondError(c, http.StatusConflict, ErrCodeConflict, "Data sudah ada", nil)
+			return
+		case "23503":
+			if strings.HasPrefix(pqErr.Message, "update or delete") {
+				respondError(c, http.StatusConflict, ErrCodeConflict, "Data masih dipakai oleh data lain", nil)
+			} else {
+				respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Data referensi tidak ditemukan", nil)
+			}
+			return
+		case "22P02", "22007", "22008", "22003", "23502", "23514":
+			respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Nilai field tidak valid", nil)
+			return
+		}
+	}
+
+	respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Terjadi kesalahan pada server", nil)
+}
+
+// isUniqueViolation mendeteksi pelanggaran UNIQUE di MySQL maupun PostgreSQL.
+func isUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
+
+// recoveryHandler mengganti response panic bawaan Gin dengan envelope error.
+func recoveryHandler(c *gin.Context, recovered interface{}) {
+	log.Printf("[%s] panic: %v", c.GetString(requestIDKey), recovered)
+	respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Terjadi kesalahan pada server", nil)
+}
+
+func noRouteHandler(c *gin.Context) {
+	respondNotFound(c, "Endpoint tidak ditemukan")
+}
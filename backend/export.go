@@ -0,0 +1,444 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+type exportKind int
+
+const (
+	kolomTeks exportKind = iota
+	kolomAngka
+	kolomRupiah
+	kolomTanggal
+)
+
+type exportColumn struct {
+	Header string
+	Kind   exportKind
+	Width  float64
+}
+
+// exportWriter menulis baris satu per satu langsung ke response, jadi
+// export besar tidak perlu dimuat seluruhnya ke memori.
+type exportWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// csvFlushEvery menentukan berapa baris ditulis sebelum di-flush ke client.
+const csvFlushEvery = 200
+
+type csvExportWriter struct {
+	c       *gin.Context
+	w       *csv.Writer
+	columns []exportColumn
+	rows    int
+}
+
+func (e *csvExportWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = formatExportValue(e.columns[i].Kind, value)
+	}
+	if err := e.w.Write(record); err != nil {
+		return err
+	}
+	e.rows++
+	if e.rows%csvFlushEvery == 0 {
+		e.w.Flush()
+		e.c.Writer.Flush()
+	}
+	return e.w.Error()
+}
+
+func (e *csvExportWriter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// xlsxExportWriter memakai StreamWriter excelize yang menyimpan baris ke
+// file sementara begitu melewati batas memori.
+type xlsxExportWriter struct {
+	c       *gin.Context
+	f       *excelize.File
+	sw      *excelize.StreamWriter
+	columns []exportColumn
+	styles  map[exportKind]int
+	row     int
+}
+
+func (e *xlsxExportWriter) WriteRow(values []interface{}) error {
+	e.row++
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		kind := e.columns[i].Kind
+		cells[i] = excelize.Cell{StyleID: e.styles[kind], Value: excelValue(kind, value)}
+	}
+	cell, _ := excelize.CoordinatesToCellName(1, e.row)
+	return e.sw.SetRow(cell, cells)
+}
+
+func (e *xlsxExportWriter) Close() error {
+	defer e.f.Close()
+	if err := e.sw.Flush(); err != nil {
+		return err
+	}
+	return e.f.Write(e.c.Writer)
+}
+
+// newExportWriter menyiapkan header HTTP dan baris judul kolom. Panggil
+// setelah query berhasil: untuk CSV, response langsung mulai terkirim.
+func newExportWriter(c *gin.Context, format, name string, columns []exportColumn) (exportWriter, error) {
+	filename := fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = col.Header
+	}
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		// BOM supaya Excel membaca huruf non-ASCII dengan benar
+		c.Writer.WriteString("\xef\xbb\xbf")
+		w := csv.NewWriter(c.Writer)
+		if err := w.Write(headers); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{c: c, w: w, columns: columns}, nil
+	}
+
+	f := excelize.NewFile()
+	sheet := "Sheet1"
+	if err := f.SetSheetName(sheet, name); err == nil {
+		sheet = name
+	}
+
+	rupiahFmt := `"Rp "#,##0`
+	rupiahStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &rupiahFmt})
+	if err != nil {
+		return nil, err
+	}
+	tanggalFmt := "dd/mm/yyyy"
+	tanggalStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &tanggalFmt})
+	if err != nil {
+		return nil, err
+	}
+	headerStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, err
+	}
+
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+	for i, col := range columns {
+		width := col.Width
+		if width == 0 {
+			width = 16
+		}
+		if err := sw.SetColWidth(i+1, i+1, width); err != nil {
+			return nil, err
+		}
+	}
+
+	headerCells := make([]interface{}, len(headers))
+	for i, header := range headers {
+		headerCells[i] = excelize.Cell{StyleID: headerStyle, Value: header}
+	}
+	if err := sw.SetRow("A1", headerCells); err != nil {
+		return nil, err
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	return &xlsxExportWriter{
+		c:       c,
+		f:       f,
+		sw:      sw,
+		columns: columns,
+		styles:  map[exportKind]int{kolomRupiah: rupiahStyle, kolomTanggal: tanggalStyle},
+		row:     1,
+	}, nil
+}
+
+func formatExportValue(kind exportKind, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case sql.NullTime:
+		if !v.Valid {
+			return ""
+		}
+		return formatTanggal(v.Time)
+	case sql.NullFloat64:
+		if !v.Valid {
+			return ""
+		}
+		return formatExportValue(kind, v.Float64)
+	case sql.NullString:
+		return v.String
+	case float64:
+		if kind == kolomRupiah {
+			return formatRupiah(v)
+		}
+		return fmt.Sprint(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// excelValue menyimpan angka dan tanggal sebagai nilai asli supaya bisa
+// dijumlahkan dan difilter di Excel; formatnya diatur lewat style kolom.
+func excelValue(kind exportKind, value interface{}) interface{} {
+	switch v := value.(type) {
+	case sql.NullTime:
+		if !v.Valid {
+			return nil
+		}
+		return v.Time
+	case sql.NullFloat64:
+		if !v.Valid {
+			return nil
+		}
+		return v.Float64
+	case sql.NullString:
+		return v.String
+	default:
+		return v
+	}
+}
+
+// GET /api/export/:entity?format=csv|xlsx plus filter yang sama dengan
+// endpoint list.
+func exportData(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		respondValidation(c, []FieldError{{Field: "format", Message: "format harus csv atau xlsx"}})
+		return
+	}
+
+	switch c.Param("entity") {
+	case "pembayaran":
+		exportPembayaran(c, format)
+	case "penyewa":
+		exportPenyewa(c, format)
+	case "properti":
+		exportProperti(c, format)
+	default:
+		respondNotFound(c, "Export hanya tersedia untuk pembayaran, penyewa dan properti")
+	}
+}
+
+// exportPembayaran menulis satu baris per cicilan di riwayat_pembayaran.
+// Pembayaran tanpa riwayat tetap muncul satu baris dengan kolom cicilan kosong.
+func exportPembayaran(c *gin.Context, format string) {
+	filter := pembayaranFilter(c)
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT p.id, COALESCE(py.nama, 'Unknown'), COALESCE(pr.nama_unit, ''),
+		       COALESCE(p.tanggal_mulai, p.tanggal_bayar), p.tanggal_akhir,
+		       p.nominal, COALESCE(p.uang_dibayar, p.nominal), p.status, COALESCE(p.metode_bayar, ''),
+		       r.tanggal_bayar, r.jumlah_dibayar, r.metode_bayar, r.keterangan
+		FROM pembayaran p
+		LEFT JOIN penyewa py ON p.penyewa_id = py.id
+		LEFT JOIN kontrak k ON k.id = p.kontrak_id
+		LEFT JOIN properti pr ON pr.id = COALESCE(k.properti_id, py.properti_id)
+		LEFT JOIN riwayat_pembayaran r ON r.pembayaran_id = p.id`+filter.where()+`
+		ORDER BY p.created_at DESC, p.id DESC, r.tanggal_bayar ASC
+	`, filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	w, err := newExportWriter(c, format, "pembayaran", []exportColumn{
+		{Header: "ID Pembayaran", Kind: kolomAngka, Width: 14},
+		{Header: "Penyewa", Width: 24},
+		{Header: "Unit", Width: 16},
+		{Header: "Tanggal Mulai", Kind: kolomTanggal, Width: 14},
+		{Header: "Tanggal Akhir", Kind: kolomTanggal, Width: 14},
+		{Header: "Total Tagihan", Kind: kolomRupiah, Width: 16},
+		{Header: "Total Dibayar", Kind: kolomRupiah, Width: 16},
+		{Header: "Sisa", Kind: kolomRupiah, Width: 16},
+		{Header: "Status", Width: 12},
+		{Header: "Metode Bayar", Width: 14},
+		{Header: "Tanggal Cicilan", Kind: kolomTanggal, Width: 16},
+		{Header: "Jumlah Cicilan", Kind: kolomRupiah, Width: 16},
+		{Header: "Metode Cicilan", Width: 14},
+		{Header: "Keterangan Cicilan", Width: 30},
+	})
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+
+	for rows.Next() {
+		var id int64
+		var nama, unit, status, metode string
+		var mulai, akhir, tanggalCicilan sql.NullTime
+		var nominal, dibayar float64
+		var jumlahCicilan sql.NullFloat64
+		var metodeCicilan, keterangan sql.NullString
+		if err := rows.Scan(&id, &nama, &unit, &mulai, &akhir, &nominal, &dibayar, &status, &metode,
+			&tanggalCicilan, &jumlahCicilan, &metodeCicilan, &keterangan); err != nil {
+			abortExport(c, "pembayaran", err)
+			return
+		}
+		if err := w.WriteRow([]interface{}{
+			id, nama, unit, mulai, akhir, nominal, dibayar, nominal - dibayar, status, metode,
+			tanggalCicilan, jumlahCicilan, metodeCicilan, keterangan,
+		}); err != nil {
+			abortExport(c, "pembayaran", err)
+			return
+		}
+	}
+	finishExport(c, "pembayaran", w, rows.Err())
+}
+
+func exportPenyewa(c *gin.Context, format string) {
+	filter := penyewaFilter(c)
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT p.nama, COALESCE(p.nik, ''), COALESCE(p.email, ''), p.telepon,
+		       COALESCE(p.alamat, ''), COALESCE(pr.nama_unit, ''), p.mulai_kontrak,
+		       COALESCE(pb.nominal, 0), COALESCE(pb.uang_dibayar, pb.nominal, 0)
+		FROM penyewa p
+		LEFT JOIN properti pr ON p.properti_id = pr.id
+		LEFT JOIN (
+			SELECT penyewa_id, SUM(nominal) AS nominal, SUM(COALESCE(uang_dibayar, nominal)) AS uang_dibayar
+			FROM pembayaran GROUP BY penyewa_id
+		) pb ON p.id = pb.penyewa_id`+filter.where()+`
+		ORDER BY p.nama ASC
+	`, filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	w, err := newExportWriter(c, format, "penyewa", []exportColumn{
+		{Header: "Nama", Width: 24},
+		{Header: "NIK", Width: 20},
+		{Header: "Email", Width: 24},
+		{Header: "Telepon", Width: 16},
+		{Header: "Alamat", Width: 30},
+		{Header: "Unit", Width: 16},
+		{Header: "Mulai Kontrak", Kind: kolomTanggal, Width: 14},
+		{Header: "Status Bayar", Width: 18},
+		{Header: "Total Biaya", Kind: kolomRupiah, Width: 16},
+		{Header: "Uang Dibayar", Kind: kolomRupiah, Width: 16},
+	})
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+
+	for rows.Next() {
+		var nama, nik, email, telepon, alamat, unit string
+		var mulai sql.NullTime
+		var total, dibayar float64
+		if err := rows.Scan(&nama, &nik, &email, &telepon, &alamat, &unit, &mulai, &total, &dibayar); err != nil {
+			abortExport(c, "penyewa", err)
+			return
+		}
+		if err := w.WriteRow([]interface{}{
+			nama, nik, email, telepon, alamat, unit, mulai, statusBayarPenyewa(total, dibayar), total, dibayar,
+		}); err != nil {
+			abortExport(c, "penyewa", err)
+			return
+		}
+	}
+	finishExport(c, "penyewa", w, rows.Err())
+}
+
+func exportProperti(c *gin.Context, format string) {
+	filter := propertiFilter(c)
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT p.nama_unit, p.tipe, p.harga_sewa, p.status,
+		       COALESCE(py.nama, ''), py.jatuh_tempo
+		FROM properti p
+		LEFT JOIN penyewa py ON p.id = py.properti_id`+filter.where()+`
+		ORDER BY p.nama_unit ASC
+	`, filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	w, err := newExportWriter(c, format, "properti", []exportColumn{
+		{Header: "Nama Unit", Width: 20},
+		{Header: "Tipe", Width: 12},
+		{Header: "Harga Sewa", Kind: kolomRupiah, Width: 16},
+		{Header: "Status", Width: 12},
+		{Header: "Penyewa", Width: 24},
+		{Header: "Jatuh Tempo", Kind: kolomTanggal, Width: 14},
+	})
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+
+	for rows.Next() {
+		var nama, tipe, status, penyewa string
+		var harga float64
+		var jatuhTempo sql.NullTime
+		if err := rows.Scan(&nama, &tipe, &harga, &status, &penyewa, &jatuhTempo); err != nil {
+			abortExport(c, "properti", err)
+			return
+		}
+		if err := w.WriteRow([]interface{}{nama, tipe, harga, status, penyewa, jatuhTempo}); err != nil {
+			abortExport(c, "properti", err)
+			return
+		}
+	}
+	finishExport(c, "properti", w, rows.Err())
+}
+
+// abortExport melaporkan error di tengah export. XLSX baru ditulis saat
+// Close, jadi error masih bisa dikirim sebagai JSON; CSV yang sudah
+// terkirim sebagian hanya bisa dihentikan.
+func abortExport(c *gin.Context, name string, err error) {
+	log.Printf("export %s gagal: %v", name, err)
+	if c.Writer.Written() {
+		c.Abort()
+		return
+	}
+	c.Writer.Header().Del("Content-Disposition")
+	respondInternal(c, err)
+}
+
+func finishExport(c *gin.Context, name string, w exportWriter, err error) {
+	if err != nil {
+		abortExport(c, name, err)
+		return
+	}
+	if err := w.Close(); err != nil {
+		abortExport(c, name, err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFormatExportValue(t *testing.T) {
+	tanggal := time.Date(2026, time.February, 28, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		kind  exportKind
+		value interface{}
+		want  string
+	}{
+		{"nil", kolomTeks, nil, ""},
+		{"tanggal", kolomTanggal, sql.NullTime{Time: tanggal, Valid: true}, "28/02/2026"},
+		{"tanggal kosong", kolomTanggal, sql.NullTime{}, ""},
+		{"rupiah", kolomRupiah, 1500000.0, "Rp 1.500.000"},
+		{"rupiah null", kolomRupiah, sql.NullFloat64{}, ""},
+		{"rupiah nullable", kolomRupiah, sql.NullFloat64{Float64: 250000, Valid: true}, "Rp 250.000"},
+		{"angka", kolomAngka, 2.5, "2.5"},
+		{"teks null", kolomTeks, sql.NullString{}, ""},
+		{"id", kolomAngka, int64(12), "12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatExportValue(tt.kind, tt.value); got != tt.want {
+				t.Fatalf("formatExportValue(%v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcelValue(t *testing.T) {
+	tanggal := time.Date(2026, time.February, 28, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"tanggal", sql.NullTime{Time: tanggal, Valid: true}, tanggal},
+		{"tanggal kosong", sql.NullTime{}, nil},
+		{"angka", sql.NullFloat64{Float64: 1500000, Valid: true}, 1500000.0},
+		{"angka kosong", sql.NullFloat64{}, nil},
+		{"teks", sql.NullString{String: "Transfer", Valid: true}, "Transfer"},
+		{"float", 750000.0, 750000.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := excelValue(kolomTeks, tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("excelValue(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listFilter mengumpulkan kondisi WHERE dari query string. Dipakai bersama
+// oleh endpoint list dan export supaya hasilnya selalu sama.
+type listFilter struct {
+	conds  []string
+	args   []interface{}
+	errors []FieldError
+}
+
+func (f *listFilter) add(cond string, args ...interface{}) {
+	f.conds = append(f.conds, cond)
+	f.args = append(f.args, args...)
+}
+
+// where mengembalikan " WHERE ..." atau string kosong jika tidak ada filter.
+func (f *listFilter) where() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
+
+func (f *listFilter) equal(c *gin.Context, param, column string) {
+	if value := c.Query(param); value != "" {
+		f.add(column+" = ?", value)
+	}
+}
+
+func (f *listFilter) id(c *gin.Context, param, column string) {
+	value := c.Query(param)
+	if value == "" {
+		return
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+		f.errors = append(f.errors, FieldError{Field: param, Message: param + " harus berupa angka"})
+		return
+	}
+	f.add(column+" = ?", value)
+}
+
+func (f *listFilter) number(c *gin.Context, param, cond string) {
+	value := c.Query(param)
+	if value == "" {
+		return
+	}
+	if _, err := strconv.ParseFloat(value, 64); err != nil {
+		f.errors = append(f.errors, FieldError{Field: param, Message: param + " harus berupa angka"})
+		return
+	}
+	f.add(cond, value)
+}
+
+// date menerima tanggal YYYY-MM-DD, cond berisi satu placeholder.
+func (f *listFilter) date(c *gin.Context, param, cond string) {
+	value := c.Query(param)
+	if value == "" {
+		return
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		f.errors = append(f.errors, FieldError{Field: param, Message: param + " harus berformat YYYY-MM-DD"})
+		return
+	}
+	f.add(cond, value)
+}
+
+// search mencari teks (tidak case-sensitive) di salah satu kolom.
+func (f *listFilter) search(c *gin.Context, param string, columns ...string) {
+	value := strings.TrimSpace(c.Query(param))
+	if value == "" {
+		return
+	}
+	pattern := "%" + strings.ToLower(value) + "%"
+	var parts []string
+	var args []interface{}
+	for _, column := range columns {
+		parts = append(parts, "LOWER(COALESCE("+column+", '')) LIKE ?")
+		args = append(args, pattern)
+	}
+	f.add("("+strings.Join(parts, " OR ")+")", args...)
+}
+
+// pembayaranFilter: status, metode_bayar, penyewa_id, properti_id,
+// kontrak_id, dari/sampai (tanggal_bayar) dan q (nama penyewa). Unit
+// diambil dari kontrak tagihan; unit penyewa hanya untuk tagihan tanpa
+// kontrak.
+func pembayaranFilter(c *gin.Context) *listFilter {
+	f := &listFilter{}
+	f.equal(c, "status", "p.status")
+	f.equal(c, "metode_bayar", "p.metode_bayar")
+	f.id(c, "penyewa_id", "p.penyewa_id")
+	f.id(c, "properti_id", "COALESCE((SELECT k2.properti_id FROM kontrak k2 WHERE k2.id = p.kontrak_id), py.properti_id)")
+	f.id(c, "kontrak_id", "p.kontrak_id")
+	f.date(c, "dari", "p.tanggal_bayar >= ?")
+	f.date(c, "sampai", "p.tanggal_bayar <= ?")
+	f.search(c, "q", "py.nama")
+	return f
+}
+
+// penyewaFilter: properti_id dan q (nama, NIK, telepon, email).
+func penyewaFilter(c *gin.Context) *listFilter {
+	f := &listFilter{}
+	f.id(c, "properti_id", "p.properti_id")
+	f.search(c, "q", "p.nama", "p.nik", "p.telepon", "p.email")
+	return f
+}
+
+// propertiFilter: status, tipe, harga_min, harga_max dan q (nama unit).
+func propertiFilter(c *gin.Context) *listFilter {
+	f := &listFilter{}
+	f.equal(c, "status", "p.status")
+	f.equal(c, "tipe", "p.tipe")
+	f.number(c, "harga_min", "p.harga_sewa >= ?")
+	f.number(c, "harga_max", "p.harga_sewa <= ?")
+	f.search(c, "q", "p.nama_unit")
+	return f
+}
+
+// kontrakFilter: status, periode_tagihan, penyewa_id, properti_id dan q
+// (nama penyewa atau nama unit).
+func kontrakFilter(c *gin.Context) *listFilter {
+	f := &listFilter{}
+	f.equal(c, "status", "k.status")
+	f.equal(c, "periode_tagihan", "k.periode_tagihan")
+	f.id(c, "penyewa_id", "k.penyewa_id")
+	f.id(c, "properti_id", "k.properti_id")
+	f.search(c, "q", "py.nama", "pr.nama_unit")
+	return f
+}
+
+// tagihanFilter: status, kontrak_id, penyewa_id, properti_id, dari/sampai
+// (jatuh tempo) dan q (nama penyewa atau nama unit).
+func tagihanFilter(c *gin.Context) *listFilter {
+	f := &listFilter{}
+	f.equal(c, "status", "pb.status")
+	f.id(c, "kontrak_id", "pb.kontrak_id")
+	f.id(c, "penyewa_id", "pb.penyewa_id")
+	f.id(c, "properti_id", "k.properti_id")
+	f.date(c, "dari", "pb.jatuh_tempo >= ?")
+	f.date(c, "sampai", "pb.jatuh_tempo <= ?")
+	f.search(c, "q", "py.nama", "pr.nama_unit")
+	return f
+}
+
+// dendaFilter: status, pembayaran_id, kontrak_id, penyewa_id dan q (nama
+// penyewa).
+func dendaFilter(c *gin.Context) *listFilter {
+	f := &listFilter{}
+	f.equal(c, "status", "d.status")
+	f.id(c, "pembayaran_id", "d.pembayaran_id")
+	f.id(c, "kontrak_id", "d.kontrak_id")
+	f.id(c, "penyewa_id", "pb.penyewa_id")
+	f.search(c, "q", "py.nama")
+	return f
+}
+
+// meterFilter: properti_id, jenis, anomali=true (hanya bacaan beranomali)
+// dan dari/sampai (tanggal bacaan).
+func meterFilter(c *gin.Context) *listFilter {
+	f := &listFilter{}
+	f.id(c, "properti_id", "m.properti_id")
+	f.equal(c, "jenis", "m.jenis")
+	if c.Query("anomali") == "true" {
+		f.add("m.anomali IS NOT NULL")
+	}
+	f.date(c, "dari", "m.tanggal >= ?")
+	f.date(c, "sampai", "m.tanggal <= ?")
+	return f
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var namaBulan = []string{
+	"Januari", "Februari", "Maret", "April", "Mei", "Juni",
+	"Juli", "Agustus", "September", "Oktober", "November", "Desember",
+}
+
+// formatBulan menghasilkan "Januari 2026"
+func formatBulan(t time.Time) string {
+	return namaBulan[t.Month()-1] + " " + t.Format("2006")
+}
+
+// formatTanggalPanjang menghasilkan "15 Januari 2026"
+func formatTanggalPanjang(t time.Time) string {
+	return fmt.Sprintf("%d %s", t.Day(), formatBulan(t))
+}
+
+// parseRupiah membaca nominal yang biasa diketik di spreadsheet, misalnya
+// "Rp 1.500.000", "1,500,000", "1500000.00" atau "1.500.000,50".
+func parseRupiah(value string) (float64, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	s = strings.TrimPrefix(s, "rp")
+	s = strings.TrimSuffix(s, ",-")
+	s = strings.ReplaceAll(s, " ", "")
+	s = strings.TrimPrefix(s, ".")
+	if s == "" {
+		return 0, fmt.Errorf("nominal kosong")
+	}
+
+	lastDot := strings.LastIndex(s, ".")
+	lastComma := strings.LastIndex(s, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// Pemisah yang muncul terakhir adalah pemisah desimal
+		if lastComma > lastDot {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.Replace(s, ",", ".", 1)
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	case lastDot >= 0:
+		s = normalizeSingleSeparator(s, ".")
+	case lastComma >= 0:
+		s = normalizeSingleSeparator(s, ",")
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// normalizeSingleSeparator menentukan apakah sep dipakai sebagai pemisah
+// ribuan (1.500.000) atau desimal (1500.5).
+func normalizeSingleSeparator(s, sep string) string {
+	parts := strings.Split(s, sep)
+	if len(parts) > 2 || len(parts[len(parts)-1]) == 3 {
+		return strings.Join(parts, "")
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// formatRupiah menghasilkan "Rp 1.500.000" (sen ditampilkan jika ada,
+// misalnya "Rp 1.500.000,50").
+func formatRupiah(value float64) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	whole := strconv.FormatFloat(value, 'f', 2, 64)
+	whole, cents, _ := strings.Cut(whole, ".")
+
+	var b strings.Builder
+	for i, ch := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(ch)
+	}
+
+	result := sign + "Rp " + b.String()
+	if cents != "00" {
+		result += "," + cents
+	}
+	return result
+}
+
+var angkaSatuan = []string{
+	"", "satu", "dua", "tiga", "empat", "lima", "enam", "tujuh", "delapan", "sembilan", "sepuluh", "sebelas",
+}
+
+// terbilang menuliskan nominal dalam kata untuk kwitansi, misalnya
+// 1500000 menjadi "satu juta lima ratus ribu rupiah".
+func terbilang(value float64) string {
+	sign := ""
+	if value < 0 {
+		sign = "minus "
+		value = -value
+	}
+	sen := int64(math.Round(value*100)) % 100
+	rupiah := int64(math.Round(value*100)) / 100
+
+	kata := "nol"
+	if rupiah > 0 {
+		kata = terbilangBulat(rupiah)
+	}
+	result := sign + kata + " rupiah"
+	if sen > 0 {
+		result += " " + terbilangBulat(sen) + " sen"
+	}
+	return result
+}
+
+func terbilangBulat(n int64) string {
+	switch {
+	case n < 12:
+		return angkaSatuan[n]
+	case n < 20:
+		return angkaSatuan[n-10] + " belas"
+	case n < 100:
+		return strings.TrimSpace(angkaSatuan[n/10] + " puluh " + terbilangBulat(n%10))
+	case n < 200:
+		return strings.TrimSpace("seratus " + terbilangBulat(n-100))
+	case n < 1000:
+		return strings.TrimSpace(angkaSatuan[n/100] + " ratus " + terbilangBulat(n%100))
+	case n < 2000:
+		return strings.TrimSpace("seribu " + terbilangBulat(n-1000))
+	case n < 1000000:
+		return strings.TrimSpace(terbilangBulat(n/1000) + " ribu " + terbilangBulat(n%1000))
+	case n < 1000000000:
+		return strings.TrimSpace(terbilangBulat(n/1000000) + " juta " + terbilangBulat(n%1000000))
+	case n < 1000000000000:
+		return strings.TrimSpace(terbilangBulat(n/1000000000) + " miliar " + terbilangBulat(n%1000000000))
+	}
+	return strings.TrimSpace(terbilangBulat(n/1000000000000) + " triliun " + terbilangBulat(n%1000000000000))
+}
+
+// formatTanggal menghasilkan "15/01/2026"
+func formatTanggal(t time.Time) string {
+	return t.Format("02/01/2006")
+}
+
+// dateString menghasilkan "2006-01-02", atau string kosong untuk NULL.
+func dateString(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format("2006-01-02")
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestParseRupiah(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"Rp 1.500.000", 1500000},
+		{"rp1.500.000,-", 1500000},
+		{"1,500,000", 1500000},
+		{"1500000.00", 1500000},
+		{"1.500.000,50", 1500000.5},
+		{"1,500,000.50", 1500000.5},
+		{"1500.5", 1500.5},
+		{"1.500", 1500},
+		{"750000", 750000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseRupiah(tt.in)
+			if err != nil || got != tt.want {
+				t.Fatalf("parseRupiah(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+			}
+		})
+	}
+
+	for _, in := range []string{"", "Rp", "satu juta", "1.2.3,4,5"} {
+		if got, err := parseRupiah(in); err == nil {
+			t.Errorf("parseRupiah(%q) = %v, want error", in, got)
+		}
+	}
+}
+
+func TestFormatRupiah(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{0, "Rp 0"},
+		{1500000, "Rp 1.500.000"},
+		{1500000.5, "Rp 1.500.000,50"},
+		{-250000, "-Rp 250.000"},
+		{999, "Rp 999"},
+	}
+	for _, tt := range tests {
+		if got := formatRupiah(tt.value); got != tt.want {
+			t.Errorf("formatRupiah(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestTerbilang(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{0, "nol rupiah"},
+		{11, "sebelas rupiah"},
+		{15, "lima belas rupiah"},
+		{100, "seratus rupiah"},
+		{1000, "seribu rupiah"},
+		{1500000, "satu juta lima ratus ribu rupiah"},
+		{2750125, "dua juta tujuh ratus lima puluh ribu seratus dua puluh lima rupiah"},
+		{111111, "seratus sebelas ribu seratus sebelas rupiah"},
+		{3000000000, "tiga miliar rupiah"},
+		{2000000000000, "dua triliun rupiah"},
+		{1500000.5, "satu juta lima ratus ribu rupiah lima puluh sen"},
+		{-250000, "minus dua ratus lima puluh ribu rupiah"},
+	}
+	for _, tt := range tests {
+		if got := terbilang(tt.value); got != tt.want {
+			t.Errorf("terbilang(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -35,6 +39,39 @@ func convertDateFormat(dateStr string) string {
 	return dateStr
 }
 
+// nullIfEmpty mengirim NULL ke database untuk field opsional yang kosong
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// ensureExists mengirim NOT_FOUND jika baris dengan id tersebut tidak ada.
+// Nama tabel selalu berasal dari kode, bukan dari input user.
+func ensureExists(c *gin.Context, table, id string) bool {
+	var found int
+	err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE id=?", id).Scan(&found)
+	if err != nil {
+		respondDBError(c, err)
+		return false
+	}
+	if found == 0 {
+		respondNotFound(c, "Data "+table+" tidak ditemukan")
+		return false
+	}
+	return true
+}
+
+// respondDeleted mengirim NOT_FOUND jika DELETE tidak menghapus baris apa pun.
+func respondDeleted(c *gin.Context, result sql.Result, table, message string) {
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		respondNotFound(c, "Data "+table+" tidak ditemukan")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
 // Middleware untuk memeriksa apakah user adalah demo
 func checkDemoUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -52,11 +89,8 @@ func checkDemoUser() gin.HandlerFunc {
 		userRole := c.GetHeader("X-User-Role")
 		
 		if userRole == "demo" {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error": "Akses ditolak. Akun demo hanya dapat melihat data, tidak dapat menambah, mengubah, atau menghapus data.",
-				"code":  "DEMO_ACCESS_DENIED",
-			})
-			c.Abort()
+			respondError(c, http.StatusForbidden, ErrCodeDemoAccessDenied,
+				"Akses ditolak. Akun demo hanya dapat melihat data, tidak dapat menambah, mengubah, atau menghapus data.", nil)
 			return
 		}
 		
@@ -64,11 +98,28 @@ func checkDemoUser() gin.HandlerFunc {
 	}
 }
 
+// checkAdminUser menjaga endpoint yang membuka dokumen pribadi penyewa
+// atau menerbitkan nomor kwitansi, termasuk GET: hanya akun pemilik
+// (role admin dari login) yang boleh lewat.
+func checkAdminUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("X-User-Role") != "admin" {
+			respondError(c, http.StatusUnauthorized, ErrCodeUnauthorized,
+				"Login sebagai pemilik untuk membuka dokumen ini", nil)
+			return
+		}
+		c.Next()
+	}
+}
+
 type DashboardStats struct {
 	TotalPendapatan float64 `json:"totalPendapatan"`
 	UnitTerisi      int     `json:"unitTerisi"`
 	TotalUnit       int     `json:"totalUnit"`
 	JatuhTempo      int     `json:"jatuhTempo"`
+	TotalDenda      float64 `json:"totalDenda"`
+	DendaDihapuskan float64 `json:"dendaDihapuskan"`
+	DepositDitahan  float64 `json:"depositDitahan"`
 }
 
 type Properti struct {
@@ -113,31 +164,11 @@ func getDashboardStats(c *gin.Context) {
 	
 	fmt.Printf("=== CALCULATING DASHBOARD STATS ===\n")
 	
-	// Cek apakah kolom uang_dibayar ada
-	var columnExists int
-	db.QueryRow(`
-		SELECT COUNT(*) 
-		FROM INFORMATION_SCHEMA.COLUMNS 
-		WHERE TABLE_SCHEMA = DATABASE() 
-		AND TABLE_NAME = 'pembayaran' 
-		AND COLUMN_NAME = 'uang_dibayar'
-	`).Scan(&columnExists)
-	fmt.Printf("Column uang_dibayar exists: %d\n", columnExists)
-	
-	// 1. Total Pendapatan - sum dari uang_dibayar atau nominal jika uang_dibayar NULL
-	var query string
-	if columnExists > 0 {
-		query = `
-			SELECT CAST(COALESCE(SUM(
-				CASE 
-					WHEN uang_dibayar IS NOT NULL AND uang_dibayar > 0 THEN uang_dibayar 
-					ELSE nominal 
-				END
-			), 0) AS DECIMAL(15,2)) as total_pendapatan
-			FROM pembayaran`
-	} else {
-		query = `SELECT CAST(COALESCE(SUM(nominal), 0) AS DECIMAL(15,2)) FROM pembayaran`
-	}
+	// 1. Total Pendapatan - sum dari uang_dibayar (jumlah cicilan), atau
+	// nominal untuk data lama yang uang_dibayar-nya NULL
+	query := `
+		SELECT CAST(COALESCE(SUM(COALESCE(uang_dibayar, nominal)), 0) AS DECIMAL(15,2)) as total_pendapatan
+		FROM pembayaran`
 	
 	err := db.QueryRow(query).Scan(&stats.TotalPendapatan)
 	if err != nil {
@@ -166,17 +197,40 @@ func getDashboardStats(c *gin.Context) {
 	}
 	fmt.Printf("Total Unit: %d\n", stats.TotalUnit)
 
-	// 4. Jatuh Tempo (7 hari) - count pembayaran yang tanggal_akhir dalam 7 hari
+	// 4. Jatuh Tempo (7 hari) - count tagihan belum lunas yang jatuh tempo
+	// dalam 7 hari
+	today := time.Now()
 	err = db.QueryRow(`
 		SELECT COUNT(*) FROM pembayaran 
-		WHERE tanggal_akhir IS NOT NULL 
-		AND tanggal_akhir BETWEEN CURRENT_DATE() AND DATE_ADD(CURRENT_DATE(), INTERVAL 7 DAY)
-	`).Scan(&stats.JatuhTempo)
+		WHERE COALESCE(status, 'pending') <> 'lunas'
+		AND COALESCE(jatuh_tempo, tanggal_mulai, tanggal_bayar) BETWEEN ? AND ?
+	`, today.Format("2006-01-02"), today.AddDate(0, 0, 7).Format("2006-01-02")).Scan(&stats.JatuhTempo)
 	if err != nil {
 		fmt.Printf("Error getting jatuh tempo: %v\n", err)
 		stats.JatuhTempo = 0
 	}
 	fmt.Printf("Jatuh Tempo (7 hari): %d\n", stats.JatuhTempo)
+
+	// 5. Denda - denda berjalan dan yang sudah dihapuskan admin
+	err = db.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN status = 'aktif' THEN nominal ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN status = 'dihapuskan' THEN nominal ELSE 0 END), 0)
+		FROM denda
+	`).Scan(&stats.TotalDenda, &stats.DendaDihapuskan)
+	if err != nil {
+		log.Printf("Error getting denda: %v", err)
+		stats.TotalDenda, stats.DendaDihapuskan = 0, 0
+	}
+
+	// 6. Deposit Ditahan - saldo uang jaminan, terpisah dari pendapatan sewa
+	err = db.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN jenis = 'terima' THEN nominal ELSE -nominal END), 0)
+		FROM deposit_transaksi
+	`).Scan(&stats.DepositDitahan)
+	if err != nil {
+		log.Printf("Error getting deposit: %v", err)
+		stats.DepositDitahan = 0
+	}
 	
 	fmt.Printf("=== END DASHBOARD STATS ===\n")
 
@@ -185,17 +239,23 @@ func getDashboardStats(c *gin.Context) {
 
 // PROPERTI HANDLERS
 func getProperti(c *gin.Context) {
+	filter := propertiFilter(c)
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
 	rows, err := db.Query(`
 		SELECT p.id, p.nama_unit, p.tipe, p.harga_sewa, 
 		       COALESCE(p.foto_path, '') as foto_path, p.status,
 		       COALESCE(py.nama, '') as nama_penyewa,
-		       COALESCE(py.jatuh_tempo, '') as jatuh_tempo
+		       py.jatuh_tempo
 		FROM properti p
-		LEFT JOIN penyewa py ON p.id = py.properti_id
+		LEFT JOIN penyewa py ON p.id = py.properti_id`+filter.where()+`
 		ORDER BY p.id DESC
-	`)
+	`, filter.args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDBError(c, err)
 		return
 	}
 	defer rows.Close()
@@ -203,9 +263,11 @@ func getProperti(c *gin.Context) {
 	var propertiList []Properti
 	for rows.Next() {
 		var p Properti
-		if err := rows.Scan(&p.ID, &p.NamaUnit, &p.Tipe, &p.HargaSewa, &p.FotoPath, &p.Status, &p.NamaPenyewa, &p.JatuhTempo); err != nil {
+		var jatuhTempo sql.NullTime
+		if err := rows.Scan(&p.ID, &p.NamaUnit, &p.Tipe, &p.HargaSewa, &p.FotoPath, &p.Status, &p.NamaPenyewa, &jatuhTempo); err != nil {
 			continue
 		}
+		p.JatuhTempo = dateString(jatuhTempo)
 		propertiList = append(propertiList, p)
 	}
 
@@ -213,72 +275,99 @@ func getProperti(c *gin.Context) {
 }
 
 func createProperti(c *gin.Context) {
-	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateProperti(in, false); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
 		return
 	}
 
-	namaUnit := c.PostForm("nama_unit")
-	tipe := c.PostForm("tipe")
-	hargaSewa := c.PostForm("harga_sewa")
-	status := c.PostForm("status")
+	namaUnit := in.Get("nama_unit")
+	tipe := in.Get("tipe")
+	hargaSewa := in.Get("harga_sewa")
+	status := in.Get("status")
 
-	var fotoPath string
-	file, err := c.FormFile("foto")
-	if err == nil {
-		uploadDir := "./uploads/properti"
-		os.MkdirAll(uploadDir, os.ModePerm)
-		filename := time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
-		savePath := filepath.Join(uploadDir, filename)
-		if err := c.SaveUploadedFile(file, savePath); err == nil {
-			fotoPath = "/uploads/properti/" + filename
-		}
+	fotoPath, err := saveUpload(c, "foto", "properti")
+	if err != nil {
+		fmt.Printf("Failed to save foto: %v\n", err)
 	}
 
-	result, err := db.Exec(
+	if tipe == "" {
+		tipe = "Studio"
+	}
+	if hargaSewa == "" {
+		hargaSewa = "0"
+	}
+	if status == "" {
+		status = "kosong"
+	}
+
+	id, err := db.InsertID(
 		"INSERT INTO properti (nama_unit, tipe, harga_sewa, foto_path, status) VALUES (?, ?, ?, ?, ?)",
 		namaUnit, tipe, hargaSewa, fotoPath, status,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDBError(c, err)
 		return
 	}
 
-	id, _ := result.LastInsertId()
 	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Properti created successfully"})
 }
 
+// updateProperti (PUT) mewajibkan nama_unit; field lain yang tidak dikirim
+// tetap memakai nilai tersimpan, sama seperti PATCH.
 func updateProperti(c *gin.Context) {
+	ubahProperti(c, false)
+}
+
+// patchProperti hanya mengubah field yang dikirim client
+func patchProperti(c *gin.Context) {
+	ubahProperti(c, true)
+}
+
+func ubahProperti(c *gin.Context, partial bool) {
 	id := c.Param("id")
-	
-	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateProperti(in, partial); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "properti", id) {
 		return
 	}
 
-	namaUnit := c.PostForm("nama_unit")
-	tipe := c.PostForm("tipe")
-	hargaSewa := c.PostForm("harga_sewa")
-	status := c.PostForm("status")
+	sets, args := buildPatch(in, []patchField{
+		{Field: "nama_unit", Column: "nama_unit"},
+		{Field: "tipe", Column: "tipe"},
+		{Field: "harga_sewa", Column: "harga_sewa"},
+		{Field: "status", Column: "status"},
+	})
 
-	file, err := c.FormFile("foto")
-	if err == nil {
-		uploadDir := "./uploads/properti"
-		os.MkdirAll(uploadDir, os.ModePerm)
-		filename := time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
-		savePath := filepath.Join(uploadDir, filename)
-		if err := c.SaveUploadedFile(file, savePath); err == nil {
-			fotoPath := "/uploads/properti/" + filename
-			db.Exec("UPDATE properti SET foto_path=? WHERE id=?", fotoPath, id)
-		}
+	fotoPath, err := saveUpload(c, "foto", "properti")
+	if err != nil {
+		fmt.Printf("Failed to save foto: %v\n", err)
+	} else if fotoPath != "" {
+		sets = append(sets, "foto_path=?")
+		args = append(args, fotoPath)
 	}
 
-	_, err = db.Exec(
-		"UPDATE properti SET nama_unit=?, tipe=?, harga_sewa=?, status=? WHERE id=?",
-		namaUnit, tipe, hargaSewa, status, id,
-	)
+	if len(sets) == 0 {
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Tidak ada field yang diubah", nil)
+		return
+	}
+
+	args = append(args, id)
+	_, err = db.Exec("UPDATE properti SET "+strings.Join(sets, ", ")+" WHERE id=?", args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDBError(c, err)
 		return
 	}
 
@@ -288,35 +377,75 @@ func updateProperti(c *gin.Context) {
 func deleteProperti(c *gin.Context) {
 	id := c.Param("id")
 	
-	_, err := db.Exec("DELETE FROM properti WHERE id=?", id)
+	result, err := db.Exec("DELETE FROM properti WHERE id=?", id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDBError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Properti deleted successfully"})
+	respondDeleted(c, result, "properti", "Properti deleted successfully")
+}
+
+// validateProperti memeriksa field properti. Untuk PATCH (partial) hanya
+// field yang dikirim yang diperiksa.
+func validateProperti(in *requestInput, partial bool) []FieldError {
+	var fieldErrors []FieldError
+	if (!partial || in.Has("nama_unit")) && in.Get("nama_unit") == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "nama_unit", Message: "Nama unit wajib diisi"})
+	}
+	fieldErrors = append(fieldErrors, numericFields(in, "harga_sewa")...)
+	if status := in.Get("status"); status != "" && status != "kosong" && status != "terisi" && status != "maintenance" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "status", Message: "Status harus kosong, terisi, atau maintenance"})
+	}
+	return fieldErrors
 }
 
 // PENYEWA HANDLERS
+// statusBayarPenyewa menghitung status bayar dari tagihan dan uang masuk,
+// bukan dari kolom status_bayar yang bisa tertinggal.
+func statusBayarPenyewa(totalBiaya, uangDibayar float64) string {
+	if uangDibayar >= totalBiaya && totalBiaya > 0 {
+		return "Lunas"
+	} else if uangDibayar > 0 && totalBiaya > 0 {
+		return "Kurang Bayar"
+	} else if totalBiaya > 0 {
+		return "Belum Bayar"
+	}
+	return "Belum Ada Kontrak"
+}
+
+// getPenyewa mengembalikan satu baris per penyewa; total_biaya dan
+// uang_dibayar dijumlah dari semua tagihannya.
 func getPenyewa(c *gin.Context) {
+	filter := penyewaFilter(c)
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
 	rows, err := db.Query(`
 		SELECT p.id, p.nama, COALESCE(p.nik, '') as nik, p.email, p.telepon, 
 		       COALESCE(p.alamat, '') as alamat,
 		       COALESCE(p.properti_id, 0) as properti_id,
 		       COALESCE(pr.nama_unit, '') as nama_properti,
 		       COALESCE(pr.foto_path, '') as foto_properti,
-		       COALESCE(p.mulai_kontrak, '') as mulai_kontrak,
+		       p.mulai_kontrak, p.jatuh_tempo,
 		       COALESCE(p.status_bayar, 'belum_bayar') as status_bayar,
 		       COALESCE(p.ktp_path, '') as ktp_path,
 		       COALESCE(pb.nominal, 0) as total_biaya,
-		       COALESCE(pb.uang_dibayar, pb.nominal, 0) as uang_dibayar
+		       COALESCE(pb.uang_dibayar, pb.nominal, 0) as uang_dibayar,
+		       (SELECT COALESCE(SUM(CASE WHEN kt.jenis = 'masuk' THEN kt.nominal ELSE -kt.nominal END), 0)
+		        FROM kredit_transaksi kt WHERE kt.penyewa_id = p.id) as saldo_kredit
 		FROM penyewa p
 		LEFT JOIN properti pr ON p.properti_id = pr.id
-		LEFT JOIN pembayaran pb ON p.id = pb.penyewa_id
+		LEFT JOIN (
+			SELECT penyewa_id, SUM(nominal) AS nominal, SUM(COALESCE(uang_dibayar, nominal)) AS uang_dibayar
+			FROM pembayaran GROUP BY penyewa_id
+		) pb ON p.id = pb.penyewa_id`+filter.where()+`
 		ORDER BY p.id DESC
-	`)
+	`, filter.args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDBError(c, err)
 		return
 	}
 	defer rows.Close()
@@ -324,24 +453,16 @@ func getPenyewa(c *gin.Context) {
 	var penyewaList []map[string]interface{}
 	for rows.Next() {
 		var p Penyewa
-		var mulaiKontrak string
-		var totalBiaya, uangDibayar float64
+		var mulaiKontrak sql.NullString
+		var jatuhTempo sql.NullTime
+		var totalBiaya, uangDibayar, kredit float64
 		
-		if err := rows.Scan(&p.ID, &p.Nama, &p.NIK, &p.Email, &p.Telepon, &p.Alamat, &p.PropertiID, &p.NamaProperti, &p.FotoProperti, &mulaiKontrak, &p.StatusBayar, &p.KtpPath, &totalBiaya, &uangDibayar); err != nil {
+		if err := rows.Scan(&p.ID, &p.Nama, &p.NIK, &p.Email, &p.Telepon, &p.Alamat, &p.PropertiID, &p.NamaProperti, &p.FotoProperti, &mulaiKontrak, &jatuhTempo, &p.StatusBayar, &p.KtpPath, &totalBiaya, &uangDibayar, &kredit); err != nil {
 			continue
 		}
 		
 		// Calculate real payment status
-		var calculatedStatus string
-		if uangDibayar >= totalBiaya && totalBiaya > 0 {
-			calculatedStatus = "Lunas"
-		} else if uangDibayar > 0 && totalBiaya > 0 {
-			calculatedStatus = "Kurang Bayar"
-		} else if totalBiaya > 0 {
-			calculatedStatus = "Belum Bayar"
-		} else {
-			calculatedStatus = "Belum Ada Kontrak"
-		}
+		calculatedStatus := statusBayarPenyewa(totalBiaya, uangDibayar)
 		
 		// Convert to map for flexibility
 		penyewaItem := map[string]interface{}{
@@ -354,11 +475,13 @@ func getPenyewa(c *gin.Context) {
 			"properti_id":    p.PropertiID,
 			"nama_properti":  p.NamaProperti,
 			"foto_properti":  p.FotoProperti,
-			"mulai_kontrak":  mulaiKontrak,
+			"mulai_kontrak":  mulaiKontrak.String,
+			"jatuh_tempo":    dateString(jatuhTempo),
 			"status_bayar":   calculatedStatus, // Use calculated status
 			"ktp_path":       p.KtpPath,
 			"total_biaya":    totalBiaya,
 			"uang_dibayar":   uangDibayar,
+			"saldo_kredit":   kredit,
 		}
 		
 		penyewaList = append(penyewaList, penyewaItem)
@@ -368,24 +491,25 @@ func getPenyewa(c *gin.Context) {
 }
 
 func createPenyewa(c *gin.Context) {
-	// Parse multipart form
-	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-		fmt.Printf("Failed to parse form: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form: " + err.Error()})
+	// Parse body JSON atau multipart form
+	in, err := parseInput(c)
+	if err != nil {
+		fmt.Printf("Failed to parse request: %v\n", err)
+		respondInvalidRequest(c, err)
 		return
 	}
 
-	nama := c.PostForm("nama")
-	nik := c.PostForm("nik")
-	email := c.PostForm("email")
-	telepon := c.PostForm("telepon")
-	alamat := c.PostForm("alamat")
+	nama := in.Get("nama")
+	nik := in.Get("nik")
+	email := in.Get("email")
+	telepon := in.Get("telepon")
+	alamat := in.Get("alamat")
 	// Set default status bayar to valid ENUM value
 	statusBayar := "belum_bayar"
 
 	// Validasi input wajib
-	if nama == "" || telepon == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Nama dan telepon wajib diisi"})
+	if fieldErrors := requiredFields(in, "nama", "telepon"); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
 		return
 	}
 
@@ -398,40 +522,26 @@ func createPenyewa(c *gin.Context) {
 	fmt.Printf("Alamat: '%s'\n", alamat)
 	fmt.Printf("Status Bayar: '%s'\n", statusBayar)
 
-	var ktpPath string
-	file, err := c.FormFile("ktp")
-	if err == nil {
-		uploadDir := "./uploads/ktp"
-		if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-			fmt.Printf("Failed to create upload directory: %v\n", err)
-		} else {
-			filename := time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
-			savePath := filepath.Join(uploadDir, filename)
-			if err := c.SaveUploadedFile(file, savePath); err != nil {
-				fmt.Printf("Failed to save KTP file: %v\n", err)
-			} else {
-				ktpPath = "/uploads/ktp/" + filename
-				fmt.Printf("KTP file saved successfully: %s\n", ktpPath)
-			}
-		}
-	} else {
-		fmt.Printf("No KTP file uploaded: %v\n", err)
+	ktpPath, err := saveUpload(c, "ktp", "ktp")
+	if err != nil {
+		fmt.Printf("Failed to save KTP file: %v\n", err)
+	} else if ktpPath != "" {
+		fmt.Printf("KTP file saved successfully: %s\n", ktpPath)
 	}
 
 	// Insert ke database - properti_id akan NULL secara default
 	fmt.Printf("Executing SQL INSERT...\n")
-	result, err := db.Exec(`
+	id, err := db.InsertID(`
 		INSERT INTO penyewa (nama, nik, email, telepon, alamat, status_bayar, ktp_path) 
 		VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		nama, nik, email, telepon, alamat, statusBayar, ktpPath,
 	)
 	if err != nil {
 		fmt.Printf("Database INSERT error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+		respondDBError(c, err)
 		return
 	}
 
-	id, _ := result.LastInsertId()
 	fmt.Printf("Penyewa created successfully with ID: %d\n", id)
 	fmt.Printf("=== END DEBUG ===\n")
 	
@@ -445,22 +555,27 @@ func createPenyewa(c *gin.Context) {
 func updatePenyewa(c *gin.Context) {
 	id := c.Param("id")
 	
-	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-		fmt.Printf("Failed to parse form: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form: " + err.Error()})
+	in, err := parseInput(c)
+	if err != nil {
+		fmt.Printf("Failed to parse request: %v\n", err)
+		respondInvalidRequest(c, err)
 		return
 	}
 
-	nama := c.PostForm("nama")
-	nik := c.PostForm("nik")
-	email := c.PostForm("email")
-	telepon := c.PostForm("telepon")
-	alamat := c.PostForm("alamat")
+	nama := in.Get("nama")
+	nik := in.Get("nik")
+	email := in.Get("email")
+	telepon := in.Get("telepon")
+	alamat := in.Get("alamat")
 	// Removed status_bayar from form - it will be calculated based on payment data
 
 	// Validasi input wajib
-	if nama == "" || telepon == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Nama dan telepon wajib diisi"})
+	if fieldErrors := requiredFields(in, "nama", "telepon"); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	if !ensureExists(c, "penyewa", id) {
 		return
 	}
 
@@ -473,24 +588,12 @@ func updatePenyewa(c *gin.Context) {
 	fmt.Printf("Alamat: '%s'\n", alamat)
 
 	// Handle KTP file upload
-	file, err := c.FormFile("ktp")
-	if err == nil {
-		uploadDir := "./uploads/ktp"
-		if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-			fmt.Printf("Failed to create upload directory: %v\n", err)
-		} else {
-			filename := time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
-			savePath := filepath.Join(uploadDir, filename)
-			if err := c.SaveUploadedFile(file, savePath); err != nil {
-				fmt.Printf("Failed to save KTP file: %v\n", err)
-			} else {
-				ktpPath := "/uploads/ktp/" + filename
-				fmt.Printf("KTP file updated: %s\n", ktpPath)
-				db.Exec("UPDATE penyewa SET ktp_path=? WHERE id=?", ktpPath, id)
-			}
-		}
-	} else {
-		fmt.Printf("No new KTP file uploaded: %v\n", err)
+	ktpPath, err := saveUpload(c, "ktp", "ktp")
+	if err != nil {
+		fmt.Printf("Failed to save KTP file: %v\n", err)
+	} else if ktpPath != "" {
+		fmt.Printf("KTP file updated: %s\n", ktpPath)
+		db.Exec("UPDATE penyewa SET ktp_path=? WHERE id=?", ktpPath, id)
 	}
 
 	// Update data penyewa - removed status_bayar from update
@@ -501,7 +604,7 @@ func updatePenyewa(c *gin.Context) {
 	)
 	if err != nil {
 		fmt.Printf("Database UPDATE error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+		respondDBError(c, err)
 		return
 	}
 
@@ -512,73 +615,164 @@ func updatePenyewa(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Penyewa updated successfully"})
 }
 
+// patchPenyewa hanya mengubah field yang dikirim client
+func patchPenyewa(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		fmt.Printf("Failed to parse request: %v\n", err)
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	// Field wajib boleh tidak dikirim, tapi tidak boleh dikosongkan
+	var fieldErrors []FieldError
+	for _, field := range []string{"nama", "telepon"} {
+		if in.Has(field) {
+			fieldErrors = append(fieldErrors, requiredFields(in, field)...)
+		}
+	}
+	if len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "penyewa", id) {
+		return
+	}
+
+	sets, args := buildPatch(in, []patchField{
+		{Field: "nama", Column: "nama"},
+		{Field: "nik", Column: "nik"},
+		{Field: "email", Column: "email"},
+		{Field: "telepon", Column: "telepon"},
+		{Field: "alamat", Column: "alamat"},
+	})
+
+	ktpPath, err := saveUpload(c, "ktp", "ktp")
+	if err != nil {
+		fmt.Printf("Failed to save KTP file: %v\n", err)
+	} else if ktpPath != "" {
+		sets = append(sets, "ktp_path=?")
+		args = append(args, ktpPath)
+	}
+
+	if len(sets) == 0 {
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Tidak ada field yang diubah", nil)
+		return
+	}
+
+	args = append(args, id)
+	_, err = db.Exec("UPDATE penyewa SET "+strings.Join(sets, ", ")+" WHERE id=?", args...)
+	if err != nil {
+		fmt.Printf("Database UPDATE error: %v\n", err)
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Penyewa updated successfully"})
+}
+
 func deletePenyewa(c *gin.Context) {
 	id := c.Param("id")
-	
-	_, err := db.Exec("DELETE FROM penyewa WHERE id=?", id)
+
+	// Unit yang ditempati penyewa ini dilepas setelah penyewa (dan
+	// kontraknya) terhapus.
+	rows, err := db.Query(`
+		SELECT properti_id FROM penyewa WHERE id=? AND properti_id IS NOT NULL
+		UNION
+		SELECT properti_id FROM kontrak WHERE penyewa_id=? AND status='aktif' AND properti_id IS NOT NULL`, id, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondDBError(c, err)
+		return
+	}
+	var unitIDs []int64
+	for rows.Next() {
+		var unitID int64
+		if err := rows.Scan(&unitID); err != nil {
+			rows.Close()
+			respondDBError(c, err)
+			return
+		}
+		unitIDs = append(unitIDs, unitID)
+	}
+	rows.Close()
+
+	// Riwayat hunian tetap disimpan (penyewa_id menjadi NULL), masa
+	// tinggal yang masih terbuka ditutup hari ini.
+	if _, err := db.Exec("UPDATE riwayat_hunian SET tanggal_keluar=? WHERE penyewa_id=? AND tanggal_keluar IS NULL", hariIni(), id); err != nil {
+		respondDBError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Penyewa deleted successfully"})
+	result, err := db.Exec("DELETE FROM penyewa WHERE id=?", id)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	for _, unitID := range unitIDs {
+		if err := lepaskanUnit(db, unitID, "kosong"); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+
+	respondDeleted(c, result, "penyewa", "Penyewa deleted successfully")
+}
+
+// validatePembayaran memeriksa field kontrak/pembayaran. Untuk PATCH
+// (partial) field wajib hanya diperiksa jika dikirim.
+func validatePembayaran(in *requestInput, partial bool) []FieldError {
+	var fieldErrors []FieldError
+	for _, field := range []string{"penyewa_id", "tanggal_mulai"} {
+		if !partial || in.Has(field) {
+			fieldErrors = append(fieldErrors, requiredFields(in, field)...)
+		}
+	}
+	fieldErrors = append(fieldErrors, numericFields(in, "penyewa_id", "properti_id", "kontrak_id", "total_biaya", "uang_dibayar", "harga_sewa")...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "status", statusPembayaranValid)...)
+	return fieldErrors
 }
 
 // PEMBAYARAN HANDLERS
 func createPembayaran(c *gin.Context) {
 	fmt.Printf("=== CREATE PEMBAYARAN CALLED ===\n")
 	
-	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-		fmt.Printf("Failed to parse form: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form: " + err.Error()})
+	in, err := parseInput(c)
+	if err != nil {
+		fmt.Printf("Failed to parse request: %v\n", err)
+		respondInvalidRequest(c, err)
 		return
 	}
 
-	penyewaID := c.PostForm("penyewa_id")
-	propertiID := c.PostForm("properti_id")
-	nominal := c.PostForm("harga_sewa")
-	tanggalMulai := c.PostForm("tanggal_mulai")
-	tanggalAkhir := c.PostForm("tanggal_akhir")
-	metodeBayar := c.PostForm("metode_bayar")
-	totalBiaya := c.PostForm("total_biaya")
-	uangDibayar := c.PostForm("uang_dibayar")
+	penyewaID := in.Get("penyewa_id")
+	propertiID := in.Get("properti_id")
+	nominal := in.Get("harga_sewa")
+	tanggalMulai := in.Get("tanggal_mulai")
+	tanggalAkhir := in.Get("tanggal_akhir")
+	metodeBayar := in.Get("metode_bayar")
+	uangDibayar := in.Get("uang_dibayar")
 
 	fmt.Printf("Form data received:\n")
 	fmt.Printf("PenyewaID: %s\n", penyewaID)
 	fmt.Printf("PropertiID: %s\n", propertiID)
 	fmt.Printf("Nominal: %s\n", nominal)
-	fmt.Printf("TotalBiaya: %s\n", totalBiaya)
 	fmt.Printf("UangDibayar: %s\n", uangDibayar)
 	fmt.Printf("TanggalMulai: %s\n", tanggalMulai)
 	fmt.Printf("MetodeBayar: %s\n", metodeBayar)
 
 	// Validasi input
-	if penyewaID == "" || totalBiaya == "" || tanggalMulai == "" {
-		fmt.Printf("Validation failed: missing required fields\n")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Penyewa, total biaya, dan tanggal mulai wajib diisi"})
+	if fieldErrors := validatePembayaran(in, false); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
 		return
 	}
 
 	// Handle file upload
-	var kwitansiPath string
-	file, err := c.FormFile("kwitansi")
-	if err == nil {
-		fmt.Printf("File upload detected: %s\n", file.Filename)
-		uploadDir := "./uploads/kwitansi"
-		if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
-			fmt.Printf("Failed to create upload directory: %v\n", err)
-		} else {
-			filename := time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
-			savePath := filepath.Join(uploadDir, filename)
-			if err := c.SaveUploadedFile(file, savePath); err != nil {
-				fmt.Printf("Failed to save kwitansi file: %v\n", err)
-			} else {
-				kwitansiPath = "/uploads/kwitansi/" + filename
-				fmt.Printf("File saved successfully: %s\n", kwitansiPath)
-			}
-		}
-	} else {
-		fmt.Printf("No file uploaded: %v\n", err)
+	kwitansiPath, err := saveUpload(c, "kwitansi", "kwitansi")
+	if err != nil {
+		fmt.Printf("Failed to save kwitansi file: %v\n", err)
+	} else if kwitansiPath != "" {
+		fmt.Printf("File saved successfully: %s\n", kwitansiPath)
 	}
 
 	// Convert date formats from ISO to MySQL format
@@ -588,42 +782,115 @@ func createPembayaran(c *gin.Context) {
 	fmt.Printf("Converted TanggalMulai: %s -> %s\n", tanggalMulai, convertedTanggalMulai)
 	fmt.Printf("Converted TanggalAkhir: %s -> %s\n", tanggalAkhir, convertedTanggalAkhir)
 
-	// Insert pembayaran
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Tagihan selalu terikat ke kontrak: pakai kontrak_id yang dikirim,
+	// kontrak aktif penyewa, atau buat kontrak baru dari data form.
+	kontrakID, err := kontrakForPembayaran(tx, in.Get("kontrak_id"), kontrakData{
+		PenyewaID:    penyewaID,
+		PropertiID:   propertiID,
+		TanggalMulai: convertedTanggalMulai,
+		TanggalAkhir: convertedTanggalAkhir,
+		HargaSewa:    nominal,
+	})
+	if err != nil {
+		respondKontrakError(c, err)
+		return
+	}
+
+	keterangan := in.Get("keterangan")
+	if keterangan == "" {
+		keterangan = fmt.Sprintf("Tagihan kontrak #%d periode %s sampai %s", kontrakID, convertedTanggalMulai, convertedTanggalAkhir)
+	}
+
+	// Insert pembayaran; nominal dihitung ulang dari rincian setelah ini
 	fmt.Printf("Inserting to database...\n")
-	result, err := db.Exec(`
-		INSERT INTO pembayaran (penyewa_id, nominal, uang_dibayar, tanggal_bayar, tanggal_mulai, tanggal_akhir, metode_bayar, kwitansi_path, status, keterangan) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'pending', ?)`,
-		penyewaID, totalBiaya, uangDibayar, convertedTanggalMulai, convertedTanggalMulai, convertedTanggalAkhir, metodeBayar, kwitansiPath, 
-		fmt.Sprintf("Kontrak sewa dari %s sampai %s", convertedTanggalMulai, convertedTanggalAkhir),
+	id, err := tx.InsertID(`
+		INSERT INTO pembayaran (penyewa_id, kontrak_id, nominal, uang_dibayar, tanggal_bayar, tanggal_mulai, tanggal_akhir, metode_bayar, kwitansi_path, status, keterangan) 
+		VALUES (?, ?, 0, 0, ?, ?, ?, ?, ?, 'pending', ?)`,
+		penyewaID, kontrakID, convertedTanggalMulai, convertedTanggalMulai, nullIfEmpty(convertedTanggalAkhir), metodeBayar, kwitansiPath, 
+		keterangan,
 	)
 	if err != nil {
 		fmt.Printf("Database insert error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+		respondDBError(c, err)
+		return
+	}
+
+	// Uang muka dari form dicatat sebagai cicilan pertama; uang_dibayar dan
+	// status diturunkan dari riwayat saat total dihitung
+	var riwayatID int64
+	if jumlah, _ := strconv.ParseFloat(uangDibayar, 64); jumlah > 0 {
+		if riwayatID, err = tx.InsertID(`
+			INSERT INTO riwayat_pembayaran (pembayaran_id, kontrak_id, jumlah_dibayar, tanggal_bayar, metode_bayar, kwitansi_path, keterangan)
+			VALUES (?, ?, ?, ?, ?, ?, 'Pembayaran awal')`,
+			id, kontrakID, uangDibayar, convertedTanggalMulai, metodeBayar, kwitansiPath,
+		); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+
+	// Total tagihan dihitung di server: sewa x durasi ditambah biaya unit,
+	// total_biaya dari form tidak dipakai lagi.
+	totalBiaya, err := buatRincianTagihan(tx, id, kontrakID, nominal)
+	if err != nil {
+		respondDBError(c, err)
 		return
 	}
 
+	// Uang muka yang melebihi total tagihan menjadi saldo kredit
+	var kredit float64
+	if riwayatID > 0 {
+		if kredit, err = simpanLebihBayar(tx, id, riwayatID); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		if err := sinkronPembayaran(tx, id); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+
 	// Update properti status jika ada properti_id
 	if propertiID != "" {
 		fmt.Printf("Updating properti status for ID: %s\n", propertiID)
-		db.Exec("UPDATE properti SET status='terisi' WHERE id=?", propertiID)
+		tx.Exec("UPDATE properti SET status='terisi' WHERE id=?", propertiID)
 		// Update penyewa dengan properti_id dan tanggal kontrak
-		db.Exec(`
+		tx.Exec(`
 			UPDATE penyewa SET 
 				properti_id=?, 
 				mulai_kontrak=?, 
-				jatuh_tempo=DATE_ADD(?, INTERVAL 1 MONTH),
 				status_bayar='lunas'
 			WHERE id=?`, 
-			propertiID, tanggalMulai, tanggalMulai, penyewaID,
+			propertiID, convertedTanggalMulai, penyewaID,
 		)
 	}
 
-	id, _ := result.LastInsertId()
+	// Jatuh tempo dihitung dari siklus kontrak dan uang yang sudah masuk
+	if err := recalcJatuhTempo(tx, kontrakID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
 	fmt.Printf("Pembayaran created successfully with ID: %d\n", id)
 	fmt.Printf("=== END CREATE PEMBAYARAN ===\n")
 	
 	c.JSON(http.StatusCreated, gin.H{
 		"id": id,
+		"kontrak_id": kontrakID,
+		"total_biaya": totalBiaya,
+		"kredit": kredit,
 		"message": "Kontrak berhasil dibuat",
 		"kwitansi_path": kwitansiPath,
 	})
@@ -633,50 +900,46 @@ func updatePembayaran(c *gin.Context) {
 	id := c.Param("id")
 	fmt.Printf("=== UPDATE PEMBAYARAN ID: %s ===\n", id)
 	
-	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-		fmt.Printf("Failed to parse form: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form: " + err.Error()})
+	in, err := parseInput(c)
+	if err != nil {
+		fmt.Printf("Failed to parse request: %v\n", err)
+		respondInvalidRequest(c, err)
 		return
 	}
 
-	penyewaID := c.PostForm("penyewa_id")
-	propertiID := c.PostForm("properti_id")
-	totalBiaya := c.PostForm("total_biaya")
-	uangDibayar := c.PostForm("uang_dibayar")
-	tanggalMulai := c.PostForm("tanggal_mulai")
-	tanggalAkhir := c.PostForm("tanggal_akhir")
-	metodeBayar := c.PostForm("metode_bayar")
-	status := c.PostForm("status")
+	penyewaID := in.Get("penyewa_id")
+	propertiID := in.Get("properti_id")
+	tanggalMulai := in.Get("tanggal_mulai")
+	tanggalAkhir := in.Get("tanggal_akhir")
+	metodeBayar := in.Get("metode_bayar")
+	status := in.Get("status")
 	if status == "" {
 		status = "pending"
 	}
 
+	if fieldErrors := validatePembayaran(in, false); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "pembayaran", id) {
+		return
+	}
+
 	fmt.Printf("Update data received:\n")
 	fmt.Printf("PenyewaID: %s\n", penyewaID)
 	fmt.Printf("PropertiID: %s\n", propertiID)
-	fmt.Printf("TotalBiaya: %s\n", totalBiaya)
-	fmt.Printf("UangDibayar: %s\n", uangDibayar)
 	fmt.Printf("TanggalMulai: %s\n", tanggalMulai)
 	fmt.Printf("TanggalAkhir: %s\n", tanggalAkhir)
 	fmt.Printf("MetodeBayar: %s\n", metodeBayar)
 	fmt.Printf("Status: %s\n", status)
 
 	// Handle file upload
-	file, err := c.FormFile("kwitansi")
-	if err == nil {
-		fmt.Printf("File upload detected: %s\n", file.Filename)
-		uploadDir := "./uploads/kwitansi"
-		if err := os.MkdirAll(uploadDir, os.ModePerm); err == nil {
-			filename := time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
-			savePath := filepath.Join(uploadDir, filename)
-			if err := c.SaveUploadedFile(file, savePath); err == nil {
-				kwitansiPath := "/uploads/kwitansi/" + filename
-				fmt.Printf("File saved: %s\n", kwitansiPath)
-				db.Exec("UPDATE pembayaran SET kwitansi_path=? WHERE id=?", kwitansiPath, id)
-			}
-		}
-	} else {
-		fmt.Printf("No file uploaded: %v\n", err)
+	kwitansiPath, err := saveUpload(c, "kwitansi", "kwitansi")
+	if err != nil {
+		fmt.Printf("Failed to save kwitansi file: %v\n", err)
+	} else if kwitansiPath != "" {
+		fmt.Printf("File saved: %s\n", kwitansiPath)
+		db.Exec("UPDATE pembayaran SET kwitansi_path=? WHERE id=?", kwitansiPath, id)
 	}
 
 	// Convert date formats from ISO to MySQL format
@@ -686,35 +949,64 @@ func updatePembayaran(c *gin.Context) {
 	fmt.Printf("Converted TanggalMulai: %s -> %s\n", tanggalMulai, convertedTanggalMulai)
 	fmt.Printf("Converted TanggalAkhir: %s -> %s\n", tanggalAkhir, convertedTanggalAkhir)
 
-	// Update pembayaran
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Update pembayaran; uang_dibayar tidak diubah di sini karena
+	// diturunkan dari riwayat cicilan
 	fmt.Printf("Updating pembayaran in database...\n")
-	_, err = db.Exec(`
+	_, err = tx.Exec(`
 		UPDATE pembayaran SET 
-			penyewa_id=?, nominal=?, uang_dibayar=?, tanggal_bayar=?, tanggal_mulai=?, tanggal_akhir=?, 
+			penyewa_id=?, tanggal_bayar=?, tanggal_mulai=?, tanggal_akhir=?, 
 			metode_bayar=?, status=?, updated_at=CURRENT_TIMESTAMP 
 		WHERE id=?`,
-		penyewaID, totalBiaya, uangDibayar, convertedTanggalMulai, convertedTanggalMulai, convertedTanggalAkhir, metodeBayar, status, id,
+		penyewaID, convertedTanggalMulai, convertedTanggalMulai, nullIfEmpty(convertedTanggalAkhir), metodeBayar, status, id,
 	)
 	if err != nil {
 		fmt.Printf("Database UPDATE error: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+		respondDBError(c, err)
+		return
+	}
+
+	// Rincian sewa mengikuti tanggal dan harga_sewa baru; total_biaya
+	// dihitung dari rincian
+	if err := hitungUlangTotal(tx, id, in.Get("harga_sewa")); err != nil {
+		respondDBError(c, err)
 		return
 	}
 
 	// Update properti status jika ada properti_id
 	if propertiID != "" {
 		fmt.Printf("Updating properti status for ID: %s\n", propertiID)
-		db.Exec("UPDATE properti SET status='terisi' WHERE id=?", propertiID)
-		// Update penyewa dengan properti_id dan tanggal kontrak
-		db.Exec(`
-			UPDATE penyewa SET 
-				properti_id=?, 
-				mulai_kontrak=?, 
-				jatuh_tempo=DATE_ADD(?, INTERVAL 1 MONTH),
-				status_bayar='lunas'
-			WHERE id=?`, 
-			propertiID, convertedTanggalMulai, convertedTanggalMulai, penyewaID,
-		)
+		_, err = tx.Exec("UPDATE properti SET status='terisi' WHERE id=?", propertiID)
+		if err == nil {
+			// Update penyewa dengan properti_id dan tanggal kontrak
+			_, err = tx.Exec(`
+				UPDATE penyewa SET 
+					properti_id=?, 
+					mulai_kontrak=?, 
+					status_bayar='lunas'
+				WHERE id=?`, 
+				propertiID, convertedTanggalMulai, penyewaID,
+			)
+		}
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+
+	if err := recalcJatuhTempoPembayaran(tx, id); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
 	}
 
 	fmt.Printf("Pembayaran updated successfully\n")
@@ -723,22 +1015,163 @@ func updatePembayaran(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Pembayaran berhasil diupdate"})
 }
 
+// patchPembayaran hanya mengubah field yang dikirim client
+func patchPembayaran(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		fmt.Printf("Failed to parse request: %v\n", err)
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validatePembayaran(in, true); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "pembayaran", id) {
+		return
+	}
+
+	sets, args := buildPatch(in, []patchField{
+		{Field: "penyewa_id", Column: "penyewa_id"},
+		{Field: "kontrak_id", Column: "kontrak_id"},
+		{Field: "tanggal_mulai", Column: "tanggal_bayar", Convert: convertDateFormat},
+		{Field: "tanggal_mulai", Column: "tanggal_mulai", Convert: convertDateFormat, Nullable: true},
+		{Field: "tanggal_akhir", Column: "tanggal_akhir", Convert: convertDateFormat, Nullable: true},
+		{Field: "metode_bayar", Column: "metode_bayar"},
+		{Field: "status", Column: "status"},
+	})
+
+	kwitansiPath, err := saveUpload(c, "kwitansi", "kwitansi")
+	if err != nil {
+		fmt.Printf("Failed to save kwitansi file: %v\n", err)
+	} else if kwitansiPath != "" {
+		sets = append(sets, "kwitansi_path=?")
+		args = append(args, kwitansiPath)
+	}
+
+	if len(sets) == 0 && !in.Has("harga_sewa") {
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Tidak ada field yang diubah", nil)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Kontrak lama ikut dihitung ulang jika tagihan dipindah kontrak
+	var kontrakLama sql.NullInt64
+	if err := tx.QueryRow("SELECT kontrak_id FROM pembayaran WHERE id=?", id).Scan(&kontrakLama); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	sets = append(sets, "updated_at=CURRENT_TIMESTAMP")
+	args = append(args, id)
+	_, err = tx.Exec("UPDATE pembayaran SET "+strings.Join(sets, ", ")+" WHERE id=?", args...)
+	if err != nil {
+		fmt.Printf("Database UPDATE error: %v\n", err)
+		respondDBError(c, err)
+		return
+	}
+
+	// Pindah unit hanya jika properti_id ikut dikirim
+	if propertiID := in.Get("properti_id"); propertiID != "" {
+		_, err = tx.Exec("UPDATE properti SET status='terisi' WHERE id=?", propertiID)
+		if err == nil {
+			_, err = tx.Exec(`
+				UPDATE penyewa SET properti_id=?
+				WHERE id=(SELECT penyewa_id FROM pembayaran WHERE id=?)`,
+				propertiID, id,
+			)
+		}
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+
+	if in.Has("harga_sewa") || in.Has("tanggal_mulai") || in.Has("tanggal_akhir") {
+		if err := hitungUlangTotal(tx, id, in.Get("harga_sewa")); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	} else if in.Has("status") {
+		// Status selalu mengikuti cicilan
+		if err := sinkronPembayaran(tx, id); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+
+	if kontrakLama.Valid && in.Has("kontrak_id") {
+		if err := recalcJatuhTempo(tx, kontrakLama.Int64); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+	if err := recalcJatuhTempoPembayaran(tx, id); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pembayaran berhasil diupdate"})
+}
+
 func deletePembayaran(c *gin.Context) {
 	id := c.Param("id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Riwayat ikut terhapus (ON DELETE CASCADE), jadi jatuh tempo kontrak
+	// harus dihitung ulang setelahnya.
+	var kontrakID sql.NullInt64
+	if err := tx.QueryRow("SELECT kontrak_id FROM pembayaran WHERE id=?", id).Scan(&kontrakID); err != nil {
+		respondDBError(c, err)
+		return
+	}
 	
-	_, err := db.Exec("DELETE FROM pembayaran WHERE id=?", id)
+	result, err := tx.Exec("DELETE FROM pembayaran WHERE id=?", id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+		respondDBError(c, err)
+		return
+	}
+
+	if kontrakID.Valid {
+		if err := recalcJatuhTempo(tx, kontrakID.Int64); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		if err := hapusKontrakOtomatisKosong(tx, kontrakID.Int64); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Pembayaran berhasil dihapus"})
+	respondDeleted(c, result, "pembayaran", "Pembayaran berhasil dihapus")
 }
 
 func uploadKwitansi(c *gin.Context) {
 	file, err := c.FormFile("kwitansi")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File tidak ditemukan"})
+		respondValidation(c, []FieldError{{Field: "kwitansi", Message: "File tidak ditemukan"}})
 		return
 	}
 
@@ -749,7 +1182,8 @@ func uploadKwitansi(c *gin.Context) {
 	filepath := filepath.Join(uploadDir, filename)
 
 	if err := c.SaveUploadedFile(file, filepath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menyimpan file"})
+		fmt.Printf("Failed to save kwitansi file: %v\n", err)
+		respondError(c, http.StatusInternalServerError, ErrCodeUploadFailed, "Gagal menyimpan file", nil)
 		return
 	}
 
@@ -761,8 +1195,14 @@ func uploadKwitansi(c *gin.Context) {
 }
 
 func getPembayaran(c *gin.Context) {
+	filter := pembayaranFilter(c)
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
 	rows, err := db.Query(`
-		SELECT p.id, p.penyewa_id, COALESCE(py.nama, 'Unknown') as nama_penyewa, 
+		SELECT p.id, p.penyewa_id, COALESCE(p.kontrak_id, 0) as kontrak_id, COALESCE(py.nama, 'Unknown') as nama_penyewa, 
 		       COALESCE(py.nik, '') as nik, COALESCE(py.email, '') as email,
 		       COALESCE(py.telepon, '') as telepon, COALESCE(py.alamat, '') as alamat,
 		       COALESCE(py.ktp_path, '') as ktp_path,
@@ -772,13 +1212,14 @@ func getPembayaran(c *gin.Context) {
 		       p.tanggal_akhir,
 		       p.metode_bayar, 
 		       COALESCE(p.kwitansi_path, '') as kwitansi_path, 
-		       p.status, COALESCE(p.keterangan, '') as keterangan
+		       p.status, COALESCE(p.keterangan, '') as keterangan,
+		       COALESCE(p.diverifikasi_oleh, ''), p.diverifikasi_pada, COALESCE(p.alasan_penolakan, '')
 		FROM pembayaran p
-		LEFT JOIN penyewa py ON p.penyewa_id = py.id
+		LEFT JOIN penyewa py ON p.penyewa_id = py.id`+filter.where()+`
 		ORDER BY p.created_at DESC
-	`)
+	`, filter.args...)
 	if err != nil {
-		c.JSON(http.StatusOK, []map[string]interface{}{})
+		respondDBError(c, err)
 		return
 	}
 	defer rows.Close()
@@ -788,6 +1229,7 @@ func getPembayaran(c *gin.Context) {
 		var pb struct {
 			ID           int     `json:"id"`
 			PenyewaID    int     `json:"penyewa_id"`
+			KontrakID    int     `json:"kontrak_id"`
 			NamaPenyewa  string  `json:"nama_penyewa"`
 			NIK          string  `json:"nik"`
 			Email        string  `json:"email"`
@@ -804,9 +1246,13 @@ func getPembayaran(c *gin.Context) {
 			KwitansiPath string  `json:"kwitansi_path"`
 			Status       string  `json:"status"`
 			Keterangan   string  `json:"keterangan"`
+			DiverifikasiOleh string       `json:"diverifikasi_oleh"`
+			DiverifikasiPada sql.NullTime `json:"diverifikasi_pada"`
+			AlasanPenolakan  string       `json:"alasan_penolakan"`
 		}
 		
-		if err := rows.Scan(&pb.ID, &pb.PenyewaID, &pb.NamaPenyewa, &pb.NIK, &pb.Email, &pb.Telepon, &pb.Alamat, &pb.KtpPath, &pb.PropertiID, &pb.Nominal, &pb.UangDibayar, &pb.TanggalBayar, &pb.TanggalMulai, &pb.TanggalAkhir, &pb.MetodeBayar, &pb.KwitansiPath, &pb.Status, &pb.Keterangan); err != nil {
+		if err := rows.Scan(&pb.ID, &pb.PenyewaID, &pb.KontrakID, &pb.NamaPenyewa, &pb.NIK, &pb.Email, &pb.Telepon, &pb.Alamat, &pb.KtpPath, &pb.PropertiID, &pb.Nominal, &pb.UangDibayar, &pb.TanggalBayar, &pb.TanggalMulai, &pb.TanggalAkhir, &pb.MetodeBayar, &pb.KwitansiPath, &pb.Status, &pb.Keterangan,
+			&pb.DiverifikasiOleh, &pb.DiverifikasiPada, &pb.AlasanPenolakan); err != nil {
 			fmt.Printf("Error scanning row: %v\n", err)
 			continue
 		}
@@ -827,6 +1273,7 @@ func getPembayaran(c *gin.Context) {
 		item := map[string]interface{}{
 			"id":            pb.ID,
 			"penyewa_id":    pb.PenyewaID,
+			"kontrak_id":    pb.KontrakID,
 			"properti_id":   pb.PropertiID,
 			"nama_penyewa":  pb.NamaPenyewa,
 			"nik":           pb.NIK,
@@ -843,11 +1290,17 @@ func getPembayaran(c *gin.Context) {
 			"kwitansi_path": pb.KwitansiPath,
 			"status":        pb.Status,
 			"keterangan":    pb.Keterangan,
+			"diverifikasi_oleh": pb.DiverifikasiOleh,
+			"diverifikasi_pada": nil,
+			"alasan_penolakan":  pb.AlasanPenolakan,
 		}
 		
 		if pb.TanggalAkhir != nil {
 			item["tanggal_akhir"] = *pb.TanggalAkhir
 		}
+		if pb.DiverifikasiPada.Valid {
+			item["diverifikasi_pada"] = pb.DiverifikasiPada.Time.Format(time.RFC3339)
+		}
 		
 		pembayaranList = append(pembayaranList, item)
 	}
@@ -860,19 +1313,24 @@ func getRiwayatPembayaran(c *gin.Context) {
 	pembayaranID := c.Param("id")
 	
 	fmt.Printf("=== GET RIWAYAT PEMBAYARAN ID: %s ===\n", pembayaranID)
+	if !ensureExists(c, "pembayaran", pembayaranID) {
+		return
+	}
 	
 	rows, err := db.Query(`
-		SELECT id, jumlah_dibayar, tanggal_bayar, metode_bayar, 
-		       COALESCE(kwitansi_path, '') as kwitansi_path, 
-		       COALESCE(keterangan, '') as keterangan
-		FROM riwayat_pembayaran 
-		WHERE pembayaran_id = ? 
-		ORDER BY tanggal_bayar ASC
+		SELECT r.id, r.jumlah_dibayar, r.lebih_bayar, r.tanggal_bayar, r.metode_bayar, 
+		       COALESCE(r.kwitansi_path, '') as kwitansi_path, 
+		       COALESCE(r.keterangan, '') as keterangan,
+		       COALESCE(r.membatalkan_id, 0), COALESCE(r.alasan, ''), COALESCE(r.oleh, ''),
+		       COALESCE((SELECT b.id FROM riwayat_pembayaran b WHERE b.membatalkan_id = r.id), 0) as pembatalan_id
+		FROM riwayat_pembayaran r
+		WHERE r.pembayaran_id = ? 
+		ORDER BY r.tanggal_bayar ASC, r.id ASC
 	`, pembayaranID)
 	
 	if err != nil {
 		fmt.Printf("Error querying riwayat: %v\n", err)
-		c.JSON(http.StatusOK, []map[string]interface{}{})
+		respondDBError(c, err)
 		return
 	}
 	defer rows.Close()
@@ -884,27 +1342,43 @@ func getRiwayatPembayaran(c *gin.Context) {
 		var riwayat struct {
 			ID           int     `json:"id"`
 			JumlahDibayar float64 `json:"jumlah_dibayar"`
+			LebihBayar   float64 `json:"lebih_bayar"`
 			TanggalBayar string  `json:"tanggal_bayar"`
 			MetodeBayar  string  `json:"metode_bayar"`
 			KwitansiPath string  `json:"kwitansi_path"`
 			Keterangan   string  `json:"keterangan"`
+			MembatalkanID int64  `json:"membatalkan_id"`
+			Alasan       string  `json:"alasan"`
+			Oleh         string  `json:"oleh"`
+			PembatalanID int64   `json:"pembatalan_id"`
 		}
 		
-		if err := rows.Scan(&riwayat.ID, &riwayat.JumlahDibayar, &riwayat.TanggalBayar, &riwayat.MetodeBayar, &riwayat.KwitansiPath, &riwayat.Keterangan); err != nil {
+		if err := rows.Scan(&riwayat.ID, &riwayat.JumlahDibayar, &riwayat.LebihBayar, &riwayat.TanggalBayar, &riwayat.MetodeBayar, &riwayat.KwitansiPath, &riwayat.Keterangan,
+			&riwayat.MembatalkanID, &riwayat.Alasan, &riwayat.Oleh, &riwayat.PembatalanID); err != nil {
 			fmt.Printf("Error scanning riwayat row: %v\n", err)
 			continue
 		}
 		
-		totalDibayar += riwayat.JumlahDibayar
+		// Lebih bayar masuk saldo kredit, bukan ke tagihan ini
+		totalDibayar += riwayat.JumlahDibayar - riwayat.LebihBayar
 		
 		item := map[string]interface{}{
 			"id":             riwayat.ID,
+			"jenis":          "pembayaran",
 			"jumlah_dibayar": riwayat.JumlahDibayar,
+			"lebih_bayar":    riwayat.LebihBayar,
 			"tanggal_bayar":  riwayat.TanggalBayar,
 			"metode_bayar":   riwayat.MetodeBayar,
 			"kwitansi_path":  riwayat.KwitansiPath,
 			"keterangan":     riwayat.Keterangan,
 			"total_sampai_sini": totalDibayar,
+			// Pembatalan: baris pembalik menunjuk cicilan asal lewat
+			// membatalkan_id, cicilan asal menunjuk pembalik lewat pembatalan_id
+			"dibatalkan":     riwayat.PembatalanID > 0,
+			"pembatalan_id":  riwayat.PembatalanID,
+			"membatalkan_id": riwayat.MembatalkanID,
+			"alasan":         riwayat.Alasan,
+			"oleh":           riwayat.Oleh,
 		}
 		
 		riwayatList = append(riwayatList, item)
@@ -912,6 +1386,41 @@ func getRiwayatPembayaran(c *gin.Context) {
 		fmt.Printf("Riwayat #%d: Rp %.2f, Total: Rp %.2f\n", len(riwayatList), riwayat.JumlahDibayar, totalDibayar)
 	}
 	
+	// Denda tagihan ini ikut tampil di riwayat, tetapi tidak menambah
+	// total_sampai_sini karena bukan uang yang diterima.
+	var denda struct {
+		ID             int
+		Nominal        float64
+		HariTerlambat  int
+		DihitungSampai sql.NullTime
+		Status         string
+		Alasan         string
+	}
+	err = db.QueryRow(`
+		SELECT id, nominal, hari_terlambat, dihitung_sampai, status, COALESCE(alasan_penghapusan, '')
+		FROM denda WHERE pembayaran_id = ?
+	`, pembayaranID).Scan(&denda.ID, &denda.Nominal, &denda.HariTerlambat, &denda.DihitungSampai, &denda.Status, &denda.Alasan)
+	if err != nil && err != sql.ErrNoRows {
+		respondDBError(c, err)
+		return
+	}
+	if err == nil {
+		keterangan := fmt.Sprintf("Denda keterlambatan %d hari", denda.HariTerlambat)
+		if denda.Status == "dihapuskan" {
+			keterangan += " (dihapuskan: " + denda.Alasan + ")"
+		}
+		riwayatList = append(riwayatList, map[string]interface{}{
+			"id":                denda.ID,
+			"jenis":             "denda",
+			"jumlah_denda":      denda.Nominal,
+			"hari_terlambat":    denda.HariTerlambat,
+			"tanggal_bayar":     dateString(denda.DihitungSampai),
+			"status":            denda.Status,
+			"keterangan":        keterangan,
+			"total_sampai_sini": totalDibayar,
+		})
+	}
+
 	fmt.Printf("Total riwayat found: %d\n", len(riwayatList))
 	fmt.Printf("=== END GET RIWAYAT ===\n")
 	
@@ -922,90 +1431,89 @@ func getRiwayatPembayaran(c *gin.Context) {
 func addRiwayatPembayaran(c *gin.Context) {
 	pembayaranID := c.Param("id")
 	
-	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
 		return
 	}
 
-	jumlahDibayar := c.PostForm("jumlah_dibayar")
-	metodeBayar := c.PostForm("metode_bayar")
-	keterangan := c.PostForm("keterangan")
+	jumlahDibayar := in.Get("jumlah_dibayar")
+	metodeBayar := in.Get("metode_bayar")
+	keterangan := in.Get("keterangan")
+
+	fieldErrors := requiredFields(in, "jumlah_dibayar")
+	fieldErrors = append(fieldErrors, numericFields(in, "jumlah_dibayar")...)
+	if len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "pembayaran", pembayaranID) {
+		return
+	}
 
 	fmt.Printf("=== ADD RIWAYAT PEMBAYARAN ID: %s ===\n", pembayaranID)
 	fmt.Printf("Jumlah: %s, Metode: %s\n", jumlahDibayar, metodeBayar)
 
 	// Handle file upload
-	var kwitansiPath string
-	file, err := c.FormFile("kwitansi")
-	if err == nil {
-		uploadDir := "./uploads/kwitansi"
-		if err := os.MkdirAll(uploadDir, os.ModePerm); err == nil {
-			filename := time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
-			savePath := filepath.Join(uploadDir, filename)
-			if err := c.SaveUploadedFile(file, savePath); err == nil {
-				kwitansiPath = "/uploads/kwitansi/" + filename
-				fmt.Printf("Kwitansi saved: %s\n", kwitansiPath)
-			}
-		}
+	kwitansiPath, err := saveUpload(c, "kwitansi", "kwitansi")
+	if err != nil {
+		fmt.Printf("Failed to save kwitansi file: %v\n", err)
+	} else if kwitansiPath != "" {
+		fmt.Printf("Kwitansi saved: %s\n", kwitansiPath)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
 	}
+	defer tx.Rollback()
 
 	// Insert riwayat pembayaran
-	_, err = db.Exec(`
-		INSERT INTO riwayat_pembayaran (pembayaran_id, jumlah_dibayar, metode_bayar, kwitansi_path, keterangan) 
-		VALUES (?, ?, ?, ?, ?)`,
-		pembayaranID, jumlahDibayar, metodeBayar, kwitansiPath, keterangan,
+	riwayatID, err := tx.InsertID(`
+		INSERT INTO riwayat_pembayaran (pembayaran_id, kontrak_id, jumlah_dibayar, metode_bayar, kwitansi_path, keterangan) 
+		VALUES (?, (SELECT kontrak_id FROM pembayaran WHERE id=?), ?, ?, ?, ?)`,
+		pembayaranID, pembayaranID, jumlahDibayar, metodeBayar, kwitansiPath, keterangan,
 	)
 	if err != nil {
 		fmt.Printf("Error inserting riwayat: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error: " + err.Error()})
+		respondDBError(c, err)
+		return
+	}
+
+	// Kelebihan dari sisa tagihan masuk ke saldo kredit penyewa, lalu
+	// uang_dibayar dan status tagihan mengikuti jumlah cicilan
+	kredit, err := simpanLebihBayar(tx, pembayaranID, riwayatID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := sinkronPembayaran(tx, pembayaranID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	// Uang yang baru masuk perlu diverifikasi lagi
+	if err := resetVerifikasi(tx, pembayaranID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := recalcJatuhTempoPembayaran(tx, pembayaranID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
 		return
 	}
 
 	fmt.Printf("Riwayat pembayaran added successfully\n")
-	c.JSON(http.StatusCreated, gin.H{"message": "Riwayat pembayaran berhasil ditambahkan"})
+	c.JSON(http.StatusCreated, gin.H{"id": riwayatID, "kredit": kredit, "message": "Riwayat pembayaran berhasil ditambahkan"})
 }
 
 func createRiwayatTable(c *gin.Context) {
-	// Create riwayat_pembayaran table if it doesn't exist
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS riwayat_pembayaran (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		pembayaran_id INT NOT NULL,
-		jumlah_dibayar DECIMAL(12,2) NOT NULL,
-		tanggal_bayar DATETIME DEFAULT CURRENT_TIMESTAMP,
-		metode_bayar VARCHAR(50) DEFAULT 'Transfer',
-		kwitansi_path VARCHAR(255) NULL,
-		keterangan TEXT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		
-		FOREIGN KEY (pembayaran_id) REFERENCES pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE,
-		
-		INDEX idx_pembayaran_id (pembayaran_id),
-		INDEX idx_tanggal_bayar (tanggal_bayar)
-	);`
-	
-	_, err := db.Exec(createTableSQL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create table: " + err.Error()})
-		return
-	}
-	
-	// Migrate existing data
-	migrateSQL := `
-	INSERT IGNORE INTO riwayat_pembayaran (pembayaran_id, jumlah_dibayar, tanggal_bayar, metode_bayar, kwitansi_path, keterangan)
-	SELECT 
-		id as pembayaran_id,
-		COALESCE(uang_dibayar, nominal) as jumlah_dibayar,
-		tanggal_bayar,
-		metode_bayar,
-		kwitansi_path,
-		'Pembayaran awal'
-	FROM pembayaran
-	WHERE id NOT IN (SELECT DISTINCT pembayaran_id FROM riwayat_pembayaran);`
-	
-	_, err = db.Exec(migrateSQL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to migrate data: " + err.Error()})
+	// Create riwayat_pembayaran table if it doesn't exist, then migrate existing data
+	if err := createRiwayatPembayaranTable(); err != nil {
+		respondInternal(c, err)
 		return
 	}
 	
@@ -1020,7 +1528,7 @@ func login(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&loginData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Data login tidak valid"})
+		respondInvalidRequest(c, err)
 		return
 	}
 
@@ -1058,10 +1566,7 @@ func login(c *gin.Context) {
 		})
 	} else {
 		fmt.Printf("Login failed for user: %s\n", loginData.Nama)
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"success": false,
-			"error":   "Nama pengguna atau password salah",
-		})
+		respondError(c, http.StatusUnauthorized, ErrCodeUnauthorized, "Nama pengguna atau password salah", nil)
 	}
 }
 
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HunianPeriode adalah satu masa tinggal penyewa di satu unit.
+// TanggalKeluar kosong berarti penyewa masih tinggal.
+type HunianPeriode struct {
+	ID            int64   `json:"id"`
+	PropertiID    int64   `json:"properti_id"`
+	NamaUnit      string  `json:"nama_unit"`
+	PenyewaID     int64   `json:"penyewa_id"`
+	NamaPenyewa   string  `json:"nama_penyewa"`
+	KontrakID     int64   `json:"kontrak_id"`
+	TanggalMasuk  string  `json:"tanggal_masuk"`
+	TanggalKeluar string  `json:"tanggal_keluar"`
+	LamaHari      int     `json:"lama_hari"`
+	SewaDibayar   float64 `json:"sewa_dibayar"`
+
+	masuk, keluar time.Time
+}
+
+// HunianKosong adalah jeda ketika unit tidak ditempati. Sampai kosong
+// berarti unit masih kosong sampai hari ini.
+type HunianKosong struct {
+	Dari     string `json:"dari"`
+	Sampai   string `json:"sampai"`
+	LamaHari int    `json:"lama_hari"`
+}
+
+// sinkronHunian menyamakan riwayat_hunian dengan kondisi kontrak: masa
+// tinggal ditutup jika kontrak tidak aktif lagi atau pindah unit, dan
+// dibuka jika kontrak aktif belum tercatat di unitnya. tanggal dipakai
+// sebagai tanggal keluar/masuk jika kontrak tidak punya tanggal_keluar.
+func sinkronHunian(q querier, kontrakID int64, tanggal string) error {
+	var penyewaID int64
+	var propertiID sql.NullInt64
+	var status, nama string
+	var mulai, keluar sql.NullTime
+	err := q.QueryRow(`
+		SELECT k.penyewa_id, k.properti_id, k.status, k.tanggal_mulai, k.tanggal_keluar, COALESCE(py.nama, '')
+		FROM kontrak k LEFT JOIN penyewa py ON py.id = k.penyewa_id
+		WHERE k.id=?`, kontrakID).Scan(&penyewaID, &propertiID, &status, &mulai, &keluar, &nama)
+	if err != nil {
+		return err
+	}
+
+	tanggalKeluar := tanggal
+	if keluar.Valid {
+		tanggalKeluar = dateString(keluar)
+	}
+	aktif := status == "aktif" && propertiID.Valid
+	unit := int64(0)
+	if aktif {
+		unit = propertiID.Int64
+	}
+	_, err = q.Exec(`
+		UPDATE riwayat_hunian
+		SET tanggal_keluar = CASE WHEN ? < tanggal_masuk THEN tanggal_masuk ELSE ? END
+		WHERE kontrak_id=? AND tanggal_keluar IS NULL AND properti_id <> ?`,
+		tanggalKeluar, tanggalKeluar, kontrakID, unit)
+	if err != nil || !aktif {
+		return err
+	}
+
+	var terbuka, tercatat int
+	err = q.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM riwayat_hunian WHERE kontrak_id=? AND properti_id=? AND tanggal_keluar IS NULL),
+		       (SELECT COUNT(*) FROM riwayat_hunian WHERE kontrak_id=?)`,
+		kontrakID, propertiID.Int64, kontrakID).Scan(&terbuka, &tercatat)
+	if err != nil || terbuka > 0 {
+		return err
+	}
+
+	// Kontrak baru masuk di tanggal_mulai; kontrak yang pindah unit masuk
+	// ke unit barunya per tanggal perubahan.
+	masuk := dateString(mulai)
+	if tercatat > 0 {
+		masuk = tanggal
+	}
+	_, err = q.Exec(`
+		INSERT INTO riwayat_hunian (properti_id, penyewa_id, kontrak_id, nama_penyewa, tanggal_masuk)
+		VALUES (?, ?, ?, ?, ?)`,
+		propertiID.Int64, penyewaID, kontrakID, nama, masuk)
+	return err
+}
+
+func hariIni() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// loadHunian memuat masa tinggal urut dari yang paling lama. Sewa dibayar
+// adalah cicilan untuk tagihan kontrak yang periodenya jatuh di dalam masa
+// tinggal itu.
+func loadHunian(where string, args ...interface{}) ([]HunianPeriode, error) {
+	rows, err := db.Query(`
+		SELECT h.id, h.properti_id, COALESCE(pr.nama_unit, ''), COALESCE(h.penyewa_id, 0), h.nama_penyewa,
+		       COALESCE(h.kontrak_id, 0), h.tanggal_masuk, h.tanggal_keluar,
+		       (SELECT COALESCE(SUM(r.jumlah_dibayar - r.lebih_bayar), 0)
+		        FROM riwayat_pembayaran r JOIN pembayaran pb ON pb.id = r.pembayaran_id
+		        WHERE pb.kontrak_id = h.kontrak_id
+		          AND COALESCE(pb.tanggal_mulai, pb.tanggal_bayar) >= h.tanggal_masuk
+		          AND (h.tanggal_keluar IS NULL OR COALESCE(pb.tanggal_mulai, pb.tanggal_bayar) <= h.tanggal_keluar))
+		FROM riwayat_hunian h
+		LEFT JOIN properti pr ON pr.id = h.properti_id
+		WHERE `+where+`
+		ORDER BY h.tanggal_masuk, h.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	today := dateOnly(time.Now())
+	periode := []HunianPeriode{}
+	for rows.Next() {
+		var p HunianPeriode
+		var keluar sql.NullTime
+		if err := rows.Scan(&p.ID, &p.PropertiID, &p.NamaUnit, &p.PenyewaID, &p.NamaPenyewa,
+			&p.KontrakID, &p.masuk, &keluar, &p.SewaDibayar); err != nil {
+			return nil, err
+		}
+		p.masuk = dateOnly(p.masuk)
+		p.TanggalMasuk = p.masuk.Format("2006-01-02")
+		p.TanggalKeluar = dateString(keluar)
+		p.keluar = today
+		if keluar.Valid {
+			p.keluar = dateOnly(keluar.Time)
+		}
+		p.LamaHari = selisihHari(p.masuk, p.keluar) + 1
+		periode = append(periode, p)
+	}
+	return periode, rows.Err()
+}
+
+func selisihHari(dari, sampai time.Time) int {
+	return int(sampai.Sub(dari).Hours() / 24)
+}
+
+// hitungKosong mencari jeda di antara masa tinggal (periode sudah urut
+// tanggal masuk). Jeda terakhir terbuka jika unit kosong sampai hari ini.
+func hitungKosong(periode []HunianPeriode) []HunianKosong {
+	kosong := []HunianKosong{}
+	if len(periode) == 0 {
+		return kosong
+	}
+
+	today := dateOnly(time.Now())
+	akhir := periode[0].keluar
+	terbuka := periode[0].TanggalKeluar == ""
+	for _, p := range periode[1:] {
+		if !terbuka && p.masuk.After(akhir.AddDate(0, 0, 1)) {
+			dari, sampai := akhir.AddDate(0, 0, 1), p.masuk.AddDate(0, 0, -1)
+			kosong = append(kosong, HunianKosong{
+				Dari:     dari.Format("2006-01-02"),
+				Sampai:   sampai.Format("2006-01-02"),
+				LamaHari: selisihHari(dari, sampai) + 1,
+			})
+		}
+		if p.TanggalKeluar == "" {
+			terbuka = true
+		}
+		if p.keluar.After(akhir) {
+			akhir = p.keluar
+		}
+	}
+	if !terbuka && today.After(akhir) {
+		dari := akhir.AddDate(0, 0, 1)
+		kosong = append(kosong, HunianKosong{
+			Dari:     dari.Format("2006-01-02"),
+			LamaHari: selisihHari(dari, today) + 1,
+		})
+	}
+	return kosong
+}
+
+// GET /api/properti/:id/history: siapa saja yang pernah menempati unit,
+// sewa yang dibayar per masa tinggal, dan berapa lama unit kosong.
+func getPropertiHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	var propertiID int64
+	var namaUnit, status string
+	err := db.QueryRow("SELECT id, nama_unit, COALESCE(status, 'kosong') FROM properti WHERE id=?", id).Scan(&propertiID, &namaUnit, &status)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data properti tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	periode, err := loadHunian("h.properti_id = ?", id)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	kosong := hitungKosong(periode)
+
+	hariTerisi, hariKosong := 0, 0
+	sewaDibayar := 0.0
+	for _, p := range periode {
+		hariTerisi += p.LamaHari
+		sewaDibayar += p.SewaDibayar
+	}
+	for _, k := range kosong {
+		hariKosong += k.LamaHari
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"properti_id":  propertiID,
+		"nama_unit":    namaUnit,
+		"status":       status,
+		"periode":      periode,
+		"kosong":       kosong,
+		"hari_terisi":  hariTerisi,
+		"hari_kosong":  hariKosong,
+		"sewa_dibayar": sewaDibayar,
+	})
+}
+
+// GET /api/penyewa/:id/history: unit yang pernah ditempati penyewa.
+func getPenyewaHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	var penyewaID int64
+	var nama string
+	err := db.QueryRow("SELECT id, nama FROM penyewa WHERE id=?", id).Scan(&penyewaID, &nama)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data penyewa tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	periode, err := loadHunian("h.penyewa_id = ?", id)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	hariTinggal := 0
+	sewaDibayar := 0.0
+	for _, p := range periode {
+		hariTinggal += p.LamaHari
+		sewaDibayar += p.SewaDibayar
+	}
+
+	saldo, err := saldoKredit(db, penyewaID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"penyewa_id":   penyewaID,
+		"nama":         nama,
+		"periode":      periode,
+		"hari_tinggal": hariTinggal,
+		"sewa_dibayar": sewaDibayar,
+		"saldo_kredit": saldo,
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// tinggal membuat masa tinggal; keluar kosong berarti masih menempati.
+func tinggal(masuk, keluar string) HunianPeriode {
+	p := HunianPeriode{TanggalMasuk: masuk, TanggalKeluar: keluar, masuk: tanggal(masuk), keluar: dateOnly(time.Now())}
+	if keluar != "" {
+		p.keluar = tanggal(keluar)
+	}
+	return p
+}
+
+func TestHitungKosong(t *testing.T) {
+	sejak := func(dari string) int {
+		return selisihHari(tanggal(dari), dateOnly(time.Now())) + 1
+	}
+	tests := []struct {
+		name    string
+		periode []HunianPeriode
+		want    []HunianKosong
+	}{
+		{"belum pernah ditempati", nil, []HunianKosong{}},
+		{"masih ditempati", []HunianPeriode{tinggal("2025-01-01", "")}, []HunianKosong{}},
+		{
+			"langsung diganti penyewa baru",
+			[]HunianPeriode{tinggal("2025-01-01", "2025-03-31"), tinggal("2025-04-01", "")},
+			[]HunianKosong{},
+		},
+		{
+			"jeda di antara penyewa",
+			[]HunianPeriode{tinggal("2025-01-01", "2025-03-31"), tinggal("2025-04-11", "")},
+			[]HunianKosong{{Dari: "2025-04-01", Sampai: "2025-04-10", LamaHari: 10}},
+		},
+		{
+			"masa tinggal tumpang tindih",
+			[]HunianPeriode{tinggal("2025-01-01", "2025-06-30"), tinggal("2025-03-01", "2025-04-30"), tinggal("2025-07-01", "")},
+			[]HunianKosong{},
+		},
+		{
+			"kosong sampai hari ini",
+			[]HunianPeriode{tinggal("2025-01-01", "2025-03-31")},
+			[]HunianKosong{{Dari: "2025-04-01", LamaHari: sejak("2025-04-01")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hitungKosong(tt.periode)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelisihHari(t *testing.T) {
+	if got := selisihHari(tanggal("2026-02-01"), tanggal("2026-03-01")); got != 28 {
+		t.Errorf("Feb 2026: got %d, want 28", got)
+	}
+	if got := selisihHari(tanggal("2026-03-01"), tanggal("2026-03-01")); got != 0 {
+		t.Errorf("same day: got %d, want 0", got)
+	}
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// importEntity mendeskripsikan field yang bisa diimpor untuk satu tabel.
+type importEntity struct {
+	Table  string
+	Fields []string
+	// Aliases memetakan judul kolom umum di spreadsheet ke nama field
+	Aliases map[string]string
+}
+
+var importEntities = map[string]importEntity{
+	"properti": {
+		Table:  "properti",
+		Fields: []string{"nama_unit", "tipe", "harga_sewa", "status", "deskripsi"},
+		Aliases: map[string]string{
+			"nama":       "nama_unit",
+			"unit":       "nama_unit",
+			"nama_unit":  "nama_unit",
+			"tipe":       "tipe",
+			"tipe_unit":  "tipe",
+			"jenis":      "tipe",
+			"harga":      "harga_sewa",
+			"harga_sewa": "harga_sewa",
+			"sewa":       "harga_sewa",
+			"status":     "status",
+			"deskripsi":  "deskripsi",
+			"keterangan": "deskripsi",
+		},
+	},
+	"penyewa": {
+		Table:  "penyewa",
+		Fields: []string{"nama", "nik", "email", "telepon", "alamat"},
+		Aliases: map[string]string{
+			"nama":         "nama",
+			"nama_lengkap": "nama",
+			"nama_penyewa": "nama",
+			"nik":          "nik",
+			"no_ktp":       "nik",
+			"nomor_ktp":    "nik",
+			"ktp":          "nik",
+			"email":        "email",
+			"e-mail":       "email",
+			"telepon":      "telepon",
+			"no_telepon":   "telepon",
+			"no_hp":        "telepon",
+			"hp":           "telepon",
+			"nomor_hp":     "telepon",
+			"whatsapp":     "telepon",
+			"wa":           "telepon",
+			"alamat":       "alamat",
+			"alamat_asal":  "alamat",
+		},
+	},
+}
+
+// importRow adalah hasil validasi dan impor untuk satu baris file.
+type importRow struct {
+	Row       int               `json:"row"`
+	Data      map[string]string `json:"data"`
+	Status    string            `json:"status"` // valid, invalid, duplikat, berhasil, dilewati
+	Errors    []string          `json:"errors,omitempty"`
+	Duplicate string            `json:"duplicate,omitempty"`
+	ID        int64             `json:"id,omitempty"`
+}
+
+type importReport struct {
+	Entity     string            `json:"entity"`
+	DryRun     bool              `json:"dry_run"`
+	Mapping    map[string]string `json:"mapping"`
+	Total      int               `json:"total"`
+	Valid      int               `json:"valid"`
+	Invalid    int               `json:"invalid"`
+	Duplicates int               `json:"duplicates"`
+	Inserted   int               `json:"inserted"`
+	Rows       []importRow       `json:"rows"`
+}
+
+var nikPattern = regexp.MustCompile(`^[0-9]{16}$`)
+
+// importFile membaca CSV atau XLSX, memvalidasi setiap baris, lalu (jika
+// bukan dry-run) menyimpan semuanya dalam satu transaksi.
+func importFile(entityName string, r io.Reader, filename string, mapping map[string]string, dryRun, skipInvalid bool) (*importReport, error) {
+	entity, ok := importEntities[entityName]
+	if !ok {
+		return nil, importFileError{fmt.Errorf("entity %q tidak bisa diimpor (pilih properti atau penyewa)", entityName)}
+	}
+
+	records, err := readSpreadsheet(r, filename)
+	if err != nil {
+		return nil, importFileError{err}
+	}
+	if len(records) < 2 {
+		return nil, importFileError{fmt.Errorf("file kosong atau hanya berisi judul kolom")}
+	}
+
+	columns, usedMapping, err := mapImportColumns(entity, records[0], mapping)
+	if err != nil {
+		return nil, importFileError{err}
+	}
+
+	report := &importReport{Entity: entityName, DryRun: dryRun, Mapping: usedMapping}
+	for i, record := range records[1:] {
+		data := map[string]string{}
+		empty := true
+		for col, field := range columns {
+			if field == "" || col >= len(record) {
+				continue
+			}
+			value := strings.TrimSpace(record[col])
+			data[field] = value
+			if value != "" {
+				empty = false
+			}
+		}
+		if empty {
+			continue
+		}
+
+		row := importRow{Row: i + 2, Data: data}
+		row.Errors = validateImportRow(entityName, data)
+		report.Rows = append(report.Rows, row)
+	}
+
+	if err := markImportDuplicates(entityName, report.Rows); err != nil {
+		return nil, err
+	}
+
+	for i := range report.Rows {
+		row := &report.Rows[i]
+		switch {
+		case len(row.Errors) > 0:
+			row.Status = "invalid"
+			report.Invalid++
+		case row.Duplicate != "":
+			row.Status = "duplikat"
+			report.Duplicates++
+		default:
+			row.Status = "valid"
+			report.Valid++
+		}
+	}
+	report.Total = len(report.Rows)
+
+	if dryRun {
+		return report, nil
+	}
+	if (report.Invalid > 0 || report.Duplicates > 0) && !skipInvalid {
+		return report, errImportRejected
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i := range report.Rows {
+		row := &report.Rows[i]
+		if row.Status != "valid" {
+			row.Status = "dilewati"
+			continue
+		}
+
+		var fields []string
+		var args []interface{}
+		for _, field := range entity.Fields {
+			value, ok := row.Data[field]
+			if !ok || value == "" {
+				continue
+			}
+			fields = append(fields, field)
+			args = append(args, value)
+		}
+		if entityName == "penyewa" {
+			fields = append(fields, "status_bayar")
+			args = append(args, "belum_bayar")
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			entity.Table, strings.Join(fields, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(fields)), ", "))
+		id, err := tx.InsertID(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("baris %d: %w", row.Row, err)
+		}
+		row.ID = id
+		row.Status = "berhasil"
+		report.Inserted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+var errImportRejected = errors.New("import dibatalkan: ada baris yang tidak valid atau duplikat")
+
+// importFileError menandai kesalahan pada file atau mapping dari user,
+// bukan kesalahan database.
+type importFileError struct{ err error }
+
+func (e importFileError) Error() string { return e.err.Error() }
+func (e importFileError) Unwrap() error { return e.err }
+
+func readSpreadsheet(r io.Reader, filename string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		f, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("gagal membaca XLSX: %w", err)
+		}
+		defer f.Close()
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, fmt.Errorf("file XLSX tidak punya sheet")
+		}
+		return f.GetRows(sheets[0])
+	case ".csv", ".txt":
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+
+		reader := csv.NewReader(bytes.NewReader(raw))
+		// Excel dengan locale Indonesia menyimpan CSV dengan pemisah titik koma
+		firstLine, _, _ := strings.Cut(string(raw), "\n")
+		if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+			reader.Comma = ';'
+		}
+		reader.FieldsPerRecord = -1
+		return reader.ReadAll()
+	default:
+		return nil, fmt.Errorf("format file tidak didukung, gunakan .csv atau .xlsx")
+	}
+}
+
+// mapImportColumns mencocokkan judul kolom dengan field. Mapping dari user
+// (judul kolom -> field) diprioritaskan, sisanya memakai alias bawaan.
+func mapImportColumns(entity importEntity, header []string, mapping map[string]string) ([]string, map[string]string, error) {
+	userMapping := map[string]string{}
+	for column, field := range mapping {
+		userMapping[normalizeHeader(column)] = field
+	}
+
+	valid := map[string]bool{}
+	for _, field := range entity.Fields {
+		valid[field] = true
+	}
+
+	columns := make([]string, len(header))
+	used := map[string]string{}
+	seen := map[string]bool{}
+	for i, title := range header {
+		key := normalizeHeader(title)
+		field, ok := userMapping[key]
+		if !ok {
+			field = entity.Aliases[key]
+		}
+		if field == "" || field == "-" {
+			continue
+		}
+		if !valid[field] {
+			return nil, nil, fmt.Errorf("kolom %q dipetakan ke field %q yang tidak dikenal", title, field)
+		}
+		if seen[field] {
+			return nil, nil, fmt.Errorf("field %q dipetakan lebih dari satu kolom", field)
+		}
+		seen[field] = true
+		columns[i] = field
+		used[title] = field
+	}
+	return columns, used, nil
+}
+
+func normalizeHeader(title string) string {
+	title = strings.TrimPrefix(title, "\ufeff")
+	title = strings.ToLower(strings.TrimSpace(title))
+	title = strings.NewReplacer(" ", "_", ".", "", "/", "_").Replace(title)
+	return title
+}
+
+func validateImportRow(entity string, data map[string]string) []string {
+	var errs []string
+	switch entity {
+	case "properti":
+		if data["nama_unit"] == "" {
+			errs = append(errs, "nama_unit wajib diisi")
+		}
+		if harga := data["harga_sewa"]; harga != "" {
+			if value, err := parseRupiah(harga); err != nil || value < 0 {
+				errs = append(errs, "harga_sewa bukan nominal yang valid")
+			} else {
+				data["harga_sewa"] = strconv.FormatFloat(value, 'f', -1, 64)
+			}
+		}
+		if data["status"] == "" {
+			data["status"] = "kosong"
+		}
+		status := strings.ToLower(data["status"])
+		if status != "kosong" && status != "terisi" && status != "maintenance" {
+			errs = append(errs, "status harus kosong, terisi, atau maintenance")
+		}
+		data["status"] = status
+	case "penyewa":
+		if data["nama"] == "" {
+			errs = append(errs, "nama wajib diisi")
+		}
+		if data["telepon"] == "" {
+			errs = append(errs, "telepon wajib diisi")
+		} else if digits := normalizeTelepon(data["telepon"]); len(digits) < 9 || len(digits) > 15 {
+			errs = append(errs, "telepon tidak valid")
+		}
+		if nik := data["nik"]; nik != "" && !nikPattern.MatchString(nik) {
+			errs = append(errs, "nik harus 16 digit angka")
+		}
+		if email := data["email"]; email != "" {
+			if _, err := mail.ParseAddress(email); err != nil {
+				errs = append(errs, "email tidak valid")
+			}
+		}
+	}
+	return errs
+}
+
+// normalizeTelepon menyamakan format nomor (+62 812-..., 62812..., 0812...)
+// supaya duplikat bisa dikenali.
+func normalizeTelepon(telepon string) string {
+	var b strings.Builder
+	for _, ch := range telepon {
+		if ch >= '0' && ch <= '9' {
+			b.WriteRune(ch)
+		}
+	}
+	digits := b.String()
+	if strings.HasPrefix(digits, "62") {
+		digits = "0" + digits[2:]
+	}
+	return digits
+}
+
+// markImportDuplicates menandai baris yang NIK/telepon (penyewa) atau
+// nama_unit (properti) sudah ada di database atau di baris sebelumnya.
+func markImportDuplicates(entity string, rows []importRow) error {
+	existing := map[string]string{}
+
+	switch entity {
+	case "penyewa":
+		dbRows, err := db.Query("SELECT id, COALESCE(nik, ''), telepon FROM penyewa")
+		if err != nil {
+			return err
+		}
+		defer dbRows.Close()
+		for dbRows.Next() {
+			var id int64
+			var nik, telepon string
+			if err := dbRows.Scan(&id, &nik, &telepon); err != nil {
+				return err
+			}
+			if nik != "" {
+				existing["nik:"+nik] = fmt.Sprintf("NIK sudah terdaftar (penyewa #%d)", id)
+			}
+			existing["telepon:"+normalizeTelepon(telepon)] = fmt.Sprintf("telepon sudah terdaftar (penyewa #%d)", id)
+		}
+		if err := dbRows.Err(); err != nil {
+			return err
+		}
+	case "properti":
+		dbRows, err := db.Query("SELECT id, nama_unit FROM properti")
+		if err != nil {
+			return err
+		}
+		defer dbRows.Close()
+		for dbRows.Next() {
+			var id int64
+			var nama string
+			if err := dbRows.Scan(&id, &nama); err != nil {
+				return err
+			}
+			existing["nama_unit:"+strings.ToLower(nama)] = fmt.Sprintf("nama unit sudah ada (properti #%d)", id)
+		}
+		if err := dbRows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for i := range rows {
+		row := &rows[i]
+		var keys []string
+		switch entity {
+		case "penyewa":
+			if row.Data["nik"] != "" {
+				keys = append(keys, "nik:"+row.Data["nik"])
+			}
+			if row.Data["telepon"] != "" {
+				keys = append(keys, "telepon:"+normalizeTelepon(row.Data["telepon"]))
+			}
+		case "properti":
+			if row.Data["nama_unit"] != "" {
+				keys = append(keys, "nama_unit:"+strings.ToLower(row.Data["nama_unit"]))
+			}
+		}
+
+		for _, key := range keys {
+			if reason, ok := existing[key]; ok && row.Duplicate == "" {
+				row.Duplicate = reason
+			}
+		}
+		for _, key := range keys {
+			if _, ok := existing[key]; !ok {
+				existing[key] = fmt.Sprintf("sama dengan baris %d di file", row.Row)
+			}
+		}
+	}
+	return nil
+}
+
+// POST /api/import/:entity (multipart: file, dry_run, skip_invalid, mapping)
+func importData(c *gin.Context) {
+	entity := c.Param("entity")
+	if _, ok := importEntities[entity]; !ok {
+		respondNotFound(c, "Import hanya tersedia untuk properti dan penyewa")
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		respondValidation(c, []FieldError{{Field: "file", Message: "File CSV atau XLSX wajib diupload"}})
+		return
+	}
+
+	var mapping map[string]string
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			respondValidation(c, []FieldError{{Field: "mapping", Message: "mapping harus berupa JSON {\"Judul Kolom\": \"field\"}"}})
+			return
+		}
+	}
+	dryRun := c.PostForm("dry_run") == "true" || c.PostForm("dry_run") == "1"
+	skipInvalid := c.PostForm("skip_invalid") == "true" || c.PostForm("skip_invalid") == "1"
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer file.Close()
+
+	report, err := importFile(entity, file, fileHeader.Filename, mapping, dryRun, skipInvalid)
+	var fileErr importFileError
+	switch {
+	case errors.Is(err, errImportRejected):
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, err.Error(), report)
+		return
+	case errors.As(err, &fileErr):
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, err.Error(), nil)
+		return
+	case err != nil:
+		respondDBError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !dryRun {
+		status = http.StatusCreated
+	}
+	c.JSON(status, report)
+}
+
+func runImportCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	entity := fs.String("entity", "", "properti atau penyewa")
+	file := fs.String("file", "", "file .csv atau .xlsx")
+	mappingFlag := fs.String("map", "", `pemetaan kolom, misalnya "No HP=telepon,Nama Lengkap=nama"`)
+	dryRun := fs.Bool("dry-run", false, "hanya validasi, tidak menyimpan ke database")
+	skipInvalid := fs.Bool("skip-invalid", false, "tetap impor baris valid walaupun ada baris yang gagal")
+	fs.Parse(args)
+
+	if *entity == "" || *file == "" {
+		return fmt.Errorf("-entity dan -file wajib diisi")
+	}
+
+	mapping := map[string]string{}
+	if *mappingFlag != "" {
+		for _, pair := range strings.Split(*mappingFlag, ",") {
+			column, field, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("format -map salah: %q", pair)
+			}
+			mapping[strings.TrimSpace(column)] = strings.TrimSpace(field)
+		}
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	report, importErr := importFile(*entity, f, *file, mapping, *dryRun, *skipInvalid)
+	if report != nil {
+		printImportReport(report)
+	}
+	return importErr
+}
+
+func printImportReport(report *importReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BARIS\tSTATUS\tID\tKETERANGAN")
+	for _, row := range report.Rows {
+		notes := strings.Join(row.Errors, "; ")
+		if row.Duplicate != "" {
+			notes = strings.TrimPrefix(notes+"; "+row.Duplicate, "; ")
+		}
+		id := ""
+		if row.ID > 0 {
+			id = strconv.FormatInt(row.ID, 10)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", row.Row, row.Status, id, notes)
+	}
+	w.Flush()
+	fmt.Printf("\nTotal %d baris: %d valid, %d tidak valid, %d duplikat, %d disimpan (dry-run: %v)\n",
+		report.Total, report.Valid, report.Invalid, report.Duplicates, report.Inserted, report.DryRun)
+}
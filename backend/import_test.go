@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTelepon(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"0812-3456-7890", "081234567890"},
+		{"+62 812 3456 7890", "081234567890"},
+		{"6281234567890", "081234567890"},
+		{"(022) 123456", "022123456"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeTelepon(tt.in); got != tt.want {
+			t.Errorf("normalizeTelepon(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeHeader(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"\ufeffNama Unit", "nama_unit"},
+		{" No. KTP ", "no_ktp"},
+		{"Tipe/Jenis", "tipe_jenis"},
+	}
+	for _, tt := range tests {
+		if got := normalizeHeader(tt.in); got != tt.want {
+			t.Errorf("normalizeHeader(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidateImportRow(t *testing.T) {
+	tests := []struct {
+		name     string
+		entity   string
+		data     map[string]string
+		wantErrs []string
+		wantData map[string]string
+	}{
+		{
+			name:     "properti valid dinormalkan",
+			entity:   "properti",
+			data:     map[string]string{"nama_unit": "A1", "harga_sewa": "Rp 1.500.000", "status": "Terisi"},
+			wantData: map[string]string{"nama_unit": "A1", "harga_sewa": "1500000", "status": "terisi"},
+		},
+		{
+			name:     "properti status default kosong",
+			entity:   "properti",
+			data:     map[string]string{"nama_unit": "A2"},
+			wantData: map[string]string{"nama_unit": "A2", "status": "kosong"},
+		},
+		{
+			name:     "properti tidak valid",
+			entity:   "properti",
+			data:     map[string]string{"harga_sewa": "murah", "status": "dijual"},
+			wantErrs: []string{"nama_unit wajib diisi", "harga_sewa bukan nominal yang valid", "status harus kosong, terisi, atau maintenance"},
+		},
+		{
+			name:   "penyewa valid",
+			entity: "penyewa",
+			data:   map[string]string{"nama": "Budi", "telepon": "+62 812 3456 7890", "nik": "3273010703920001", "email": "budi@example.com"},
+		},
+		{
+			name:     "penyewa tidak valid",
+			entity:   "penyewa",
+			data:     map[string]string{"telepon": "0812", "nik": "12345", "email": "bukan-email"},
+			wantErrs: []string{"nama wajib diisi", "telepon tidak valid", "nik harus 16 digit angka", "email tidak valid"},
+		},
+		{
+			name:     "penyewa tanpa telepon",
+			entity:   "penyewa",
+			data:     map[string]string{"nama": "Budi"},
+			wantErrs: []string{"telepon wajib diisi"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateImportRow(tt.entity, tt.data)
+			if !reflect.DeepEqual(errs, tt.wantErrs) {
+				t.Fatalf("errors = %q, want %q", errs, tt.wantErrs)
+			}
+			if tt.wantData != nil && !reflect.DeepEqual(tt.data, tt.wantData) {
+				t.Fatalf("data = %v, want %v", tt.data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestMapImportColumns(t *testing.T) {
+	entity := importEntities["penyewa"]
+
+	columns, used, err := mapImportColumns(entity, []string{"Nama Lengkap", "No. KTP", "HP", "Catatan"}, map[string]string{"HP": "telepon"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"nama", "nik", "telepon", ""}; !reflect.DeepEqual(columns, want) {
+		t.Fatalf("columns = %q, want %q", columns, want)
+	}
+	if len(used) != 3 {
+		t.Fatalf("used = %v", used)
+	}
+
+	if _, _, err := mapImportColumns(entity, []string{"Nama", "Nama Penyewa"}, nil); err == nil {
+		t.Fatal("dua kolom ke field yang sama harus ditolak")
+	}
+	if _, _, err := mapImportColumns(entity, []string{"Kolom"}, map[string]string{"Kolom": "gaji"}); err == nil {
+		t.Fatal("mapping ke field tidak dikenal harus ditolak")
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+)
+
+// invoiceTemplate mengatur tampilan invoice: identitas usaha, logo, warna,
+// rekening tujuan transfer, dan catatan kaki. Disimpan sebagai JSON di
+// INVOICE_TEMPLATE (default ./invoice-template.json) dan dibaca ulang setiap
+// kali invoice dibuat.
+type invoiceTemplate struct {
+	NamaUsaha  string         `json:"nama_usaha"`
+	Alamat     string         `json:"alamat"`
+	Telepon    string         `json:"telepon"`
+	Email      string         `json:"email"`
+	Logo       string         `json:"logo"`
+	Judul      string         `json:"judul"`
+	WarnaAksen string         `json:"warna_aksen"`
+	Rekening   []rekeningBank `json:"rekening"`
+	Catatan    string         `json:"catatan"`
+}
+
+type rekeningBank struct {
+	Bank     string `json:"bank"`
+	Nomor    string `json:"nomor"`
+	AtasNama string `json:"atas_nama"`
+}
+
+var warnaHex = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func defaultInvoiceTemplate() *invoiceTemplate {
+	return &invoiceTemplate{
+		NamaUsaha:  "Kontrakanku",
+		Judul:      "INVOICE",
+		WarnaAksen: "#1D4ED8",
+		Rekening:   []rekeningBank{},
+		Catatan:    "Cantumkan nomor invoice pada berita transfer.",
+	}
+}
+
+func invoiceTemplatePath() string {
+	return envOr("INVOICE_TEMPLATE", "./invoice-template.json")
+}
+
+// loadInvoiceTemplate membaca template; field yang tidak diisi memakai
+// nilai default.
+func loadInvoiceTemplate() (*invoiceTemplate, error) {
+	t := defaultInvoiceTemplate()
+	raw, err := os.ReadFile(invoiceTemplatePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, t); err != nil {
+		return nil, fmt.Errorf("%s: %w", invoiceTemplatePath(), err)
+	}
+	return t, nil
+}
+
+// fileLogo mengubah path upload ("/uploads/...") menjadi path file lokal.
+func fileLogo(path string) string {
+	if strings.HasPrefix(path, "/uploads/") {
+		return "." + path
+	}
+	return path
+}
+
+func validateInvoiceTemplate(t *invoiceTemplate) []FieldError {
+	var fieldErrors []FieldError
+	if strings.TrimSpace(t.NamaUsaha) == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "nama_usaha", Message: "nama_usaha wajib diisi"})
+	}
+	if t.WarnaAksen != "" && !warnaHex.MatchString(t.WarnaAksen) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "warna_aksen", Message: "warna_aksen harus berformat #RRGGBB"})
+	}
+	if t.Logo != "" {
+		ext := strings.ToLower(filepath.Ext(t.Logo))
+		if ext != ".png" && ext != ".jpg" && ext != ".jpeg" {
+			fieldErrors = append(fieldErrors, FieldError{Field: "logo", Message: "logo harus berupa PNG atau JPG"})
+		} else if _, err := os.Stat(fileLogo(t.Logo)); err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: "logo", Message: "File logo tidak ditemukan"})
+		}
+	}
+	for i, r := range t.Rekening {
+		if strings.TrimSpace(r.Bank) == "" || strings.TrimSpace(r.Nomor) == "" {
+			fieldErrors = append(fieldErrors, FieldError{
+				Field:   fmt.Sprintf("rekening[%d]", i),
+				Message: "bank dan nomor rekening wajib diisi",
+			})
+		}
+	}
+	return fieldErrors
+}
+
+// GET /api/invoice/template
+func getInvoiceTemplate(c *gin.Context) {
+	t, err := loadInvoiceTemplate()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// PUT /api/invoice/template mengganti seluruh template.
+func updateInvoiceTemplate(c *gin.Context) {
+	t := defaultInvoiceTemplate()
+	if err := c.ShouldBindJSON(t); err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateInvoiceTemplate(t); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if t.Rekening == nil {
+		t.Rekening = []rekeningBank{}
+	}
+
+	raw, _ := json.MarshalIndent(t, "", "  ")
+	if err := os.WriteFile(invoiceTemplatePath(), append(raw, '\n'), 0o644); err != nil {
+		respondInternal(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+type invoiceItem struct {
+	Deskripsi   string
+	Jumlah      float64
+	HargaSatuan float64
+	Nominal     float64
+}
+
+// invoiceData adalah isi invoice satu tagihan.
+type invoiceData struct {
+	Nomor       string
+	NamaPenyewa string
+	Telepon     string
+	AlamatSewa  string
+	NamaUnit    string
+	Mulai       sql.NullTime
+	Akhir       sql.NullTime
+	JatuhTempo  sql.NullTime
+	Items       []invoiceItem
+	Subtotal    float64
+	Dibayar     float64
+	Tunggakan   float64
+}
+
+// Total yang masih harus dibayar penyewa.
+func (d *invoiceData) Total() float64 {
+	return d.Subtotal - d.Dibayar + d.Tunggakan
+}
+
+// loadInvoice mengumpulkan rincian (termasuk denda aktif), pembayaran yang
+// sudah masuk, dan tunggakan tagihan sebelumnya di kontrak yang sama.
+func loadInvoice(q querier, pembayaranID string) (*invoiceData, error) {
+	d := &invoiceData{}
+	var id int64
+	var kontrakID sql.NullInt64
+	err := q.QueryRow(`
+		SELECT pb.id, pb.kontrak_id, COALESCE(py.nama, ''), COALESCE(py.telepon, ''), COALESCE(py.alamat, ''),
+		       COALESCE(pr.nama_unit, ''), COALESCE(pb.tanggal_mulai, pb.tanggal_bayar), pb.tanggal_akhir, pb.jatuh_tempo,
+		       pb.nominal, COALESCE(pb.uang_dibayar, 0)
+		FROM pembayaran pb
+		LEFT JOIN penyewa py ON py.id = pb.penyewa_id
+		LEFT JOIN kontrak k ON k.id = pb.kontrak_id
+		LEFT JOIN properti pr ON pr.id = COALESCE(k.properti_id, py.properti_id)
+		WHERE pb.id=?`, pembayaranID).Scan(&id, &kontrakID, &d.NamaPenyewa, &d.Telepon, &d.AlamatSewa, &d.NamaUnit,
+		&d.Mulai, &d.Akhir, &d.JatuhTempo, &d.Subtotal, &d.Dibayar)
+	if err != nil {
+		return nil, err
+	}
+	d.Nomor = fmt.Sprintf("INV/%s/%05d", d.Mulai.Time.Format("2006/01"), id)
+
+	rows, err := q.Query(`
+		SELECT deskripsi, jumlah, harga_satuan, nominal
+		FROM tagihan_item WHERE pembayaran_id=?
+		ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var item invoiceItem
+		if err := rows.Scan(&item.Deskripsi, &item.Jumlah, &item.HargaSatuan, &item.Nominal); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Items = append(d.Items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(d.Items) == 0 {
+		d.Items = []invoiceItem{{Deskripsi: "Sewa " + d.NamaUnit, Jumlah: 1, HargaSatuan: d.Subtotal, Nominal: d.Subtotal}}
+	}
+
+	// Tunggakan: sisa tagihan periode sebelumnya yang belum lunas, dendanya
+	// sudah termasuk nominal
+	if kontrakID.Valid {
+		err = q.QueryRow(`
+			SELECT COALESCE(SUM(t.sisa), 0) FROM (
+				SELECT pb.nominal - COALESCE(pb.uang_dibayar, 0) AS sisa
+				FROM pembayaran pb
+				WHERE pb.kontrak_id = ? AND pb.id <> ? AND pb.status <> 'lunas'
+				  AND COALESCE(pb.tanggal_mulai, pb.tanggal_bayar) < ?
+			) t`,
+			kontrakID.Int64, id, d.Mulai.Time.Format("2006-01-02")).Scan(&d.Tunggakan)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// warnaRGB mengubah "#RRGGBB" menjadi komponen warna untuk fpdf.
+func warnaRGB(hex string) (int, int, int) {
+	if !warnaHex.MatchString(hex) {
+		hex = defaultInvoiceTemplate().WarnaAksen
+	}
+	v, _ := strconv.ParseUint(hex[1:], 16, 32)
+	return int(v >> 16 & 0xff), int(v >> 8 & 0xff), int(v & 0xff)
+}
+
+// formatJumlah menghasilkan "1" atau "0,5".
+func formatJumlah(v float64) string {
+	return strings.Replace(strconv.FormatFloat(v, 'f', -1, 64), ".", ",", 1)
+}
+
+// renderInvoice menggambar invoice di kertas A4 sesuai template.
+func renderInvoice(t *invoiceTemplate, d *invoiceData) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Invoice "+d.Nomor, true)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	r, g, b := warnaRGB(t.WarnaAksen)
+
+	// Kop: logo dan identitas usaha di kiri, judul dan nomor di kanan
+	x := 15.0
+	if logo := fileLogo(t.Logo); logo != "" {
+		if _, err := os.Stat(logo); err == nil {
+			pdf.ImageOptions(logo, 15, 15, 0, 18, false, fpdf.ImageOptions{ReadDpi: true}, 0, "")
+			if info := pdf.GetImageInfo(logo); info != nil && info.Height() > 0 {
+				x = 15 + info.Width()*18/info.Height() + 4
+			}
+		}
+	}
+	pdf.SetXY(x, 15)
+	pdf.SetFont("Helvetica", "B", 13)
+	pdf.CellFormat(95, 6, tr(t.NamaUsaha), "", 2, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range []string{t.Alamat, strings.Trim(t.Telepon+" | "+t.Email, " |")} {
+		if line != "" {
+			pdf.MultiCell(95, 4.5, tr(line), "", "L", false)
+			pdf.SetX(x)
+		}
+	}
+	kiriBawah := pdf.GetY()
+
+	pdf.SetXY(120, 15)
+	pdf.SetTextColor(r, g, b)
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.CellFormat(75, 9, tr(t.Judul), "", 2, "R", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(75, 5, "No. "+d.Nomor, "", 2, "R", false, 0, "")
+	pdf.CellFormat(75, 5, "Tanggal: "+formatTanggalPanjang(time.Now()), "", 2, "R", false, 0, "")
+	if d.JatuhTempo.Valid {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(75, 5, "Jatuh tempo: "+formatTanggalPanjang(d.JatuhTempo.Time), "", 2, "R", false, 0, "")
+	}
+
+	y := pdf.GetY()
+	if kiriBawah > y {
+		y = kiriBawah
+	}
+	pdf.SetDrawColor(r, g, b)
+	pdf.SetLineWidth(0.6)
+	pdf.Line(15, y+3, 195, y+3)
+	pdf.SetLineWidth(0.2)
+	pdf.SetDrawColor(0, 0, 0)
+
+	// Penyewa dan periode
+	pdf.SetXY(15, y+7)
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(0, 5, "Ditagihkan kepada:", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 6, tr(d.NamaPenyewa), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	for _, line := range []string{d.NamaUnit, d.AlamatSewa, d.Telepon} {
+		if line != "" {
+			pdf.MultiCell(0, 4.5, tr(line), "", "L", false)
+		}
+	}
+	pdf.CellFormat(0, 6, "Periode: "+periodeKwitansi(d.Mulai, d.Akhir), "", 1, "L", false, 0, "")
+	pdf.Ln(3)
+
+	// Rincian
+	lebar := []float64{95, 20, 35, 30}
+	pdf.SetFillColor(r, g, b)
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetFont("Helvetica", "B", 9)
+	for i, judul := range []string{"Deskripsi", "Jumlah", "Harga Satuan", "Nominal"} {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(lebar[i], 7, judul, "", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Helvetica", "", 9)
+	for _, item := range d.Items {
+		pdf.CellFormat(lebar[0], 6.5, tr(item.Deskripsi), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(lebar[1], 6.5, formatJumlah(item.Jumlah), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(lebar[2], 6.5, tr(formatRupiah(item.HargaSatuan)), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(lebar[3], 6.5, tr(formatRupiah(item.Nominal)), "B", 1, "R", false, 0, "")
+	}
+	pdf.Ln(2)
+
+	ringkasan := func(label string, nilai float64, tebal bool) {
+		style := ""
+		if tebal {
+			style = "B"
+		}
+		pdf.SetFont("Helvetica", style, 9)
+		pdf.CellFormat(150, 6, tr(label), "", 0, "R", false, 0, "")
+		pdf.CellFormat(30, 6, tr(formatRupiah(nilai)), "", 1, "R", false, 0, "")
+	}
+	ringkasan("Subtotal", d.Subtotal, false)
+	if d.Dibayar > 0 {
+		ringkasan("Sudah dibayar", -d.Dibayar, false)
+	}
+	if d.Tunggakan > 0 {
+		ringkasan("Tunggakan periode sebelumnya", d.Tunggakan, false)
+	}
+	pdf.SetDrawColor(r, g, b)
+	pdf.Line(120, pdf.GetY()+0.5, 195, pdf.GetY()+0.5)
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.Ln(1)
+	ringkasan("TOTAL HARUS DIBAYAR", d.Total(), true)
+
+	if d.Total() <= 0.005 {
+		pdf.Ln(2)
+		pdf.SetTextColor(r, g, b)
+		pdf.SetFont("Helvetica", "B", 16)
+		pdf.CellFormat(0, 8, "LUNAS", "", 1, "R", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	}
+
+	// Rekening tujuan dan catatan
+	pdf.Ln(6)
+	if len(t.Rekening) > 0 {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(0, 6, "Pembayaran melalui transfer ke:", "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		for _, rek := range t.Rekening {
+			line := rek.Bank + " " + rek.Nomor
+			if rek.AtasNama != "" {
+				line += " a.n. " + rek.AtasNama
+			}
+			pdf.CellFormat(0, 5, tr(line), "", 1, "L", false, 0, "")
+		}
+		pdf.Ln(3)
+	}
+	if t.Catatan != "" {
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.MultiCell(0, 4.5, tr(t.Catatan), "", "L", false)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GET /api/tagihan/:id/invoice.pdf
+func getInvoiceTagihan(c *gin.Context) {
+	t, err := loadInvoiceTemplate()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	d, err := loadInvoice(db, c.Param("id"))
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data tagihan tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	pdf, err := renderInvoice(t, d)
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	filename := strings.ReplaceAll(d.Nomor, "/", "-") + ".pdf"
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// maxPeriodeJatuhTempo membatasi perhitungan untuk kontrak tanpa tanggal
+// akhir (100 tahun tagihan bulanan).
+const maxPeriodeJatuhTempo = 1200
+
+// jatuhTempoDari mencari awal periode pertama yang belum lunas. Pembayaran
+// dialokasikan ke periode secara berurutan mulai dari awal kontrak; biaya
+// periode memakai nominal tagihannya jika sudah ada, selain itu harga
+// sewa kontrak (diprorata untuk periode parsial). ok=false berarti kontrak sudah lunas sampai tanggal akhir.
+func jatuhTempoDari(mulai time.Time, akhir sql.NullTime, bulan, hariTagihan int, hargaPeriode float64, tagihan map[time.Time]float64, dibayar float64) (time.Time, bool) {
+	for n := 0; n < maxPeriodeJatuhTempo; n++ {
+		periode, periodeAkhir, hariPenuh := periodeKontrak(mulai, hariTagihan, bulan, n)
+		if akhir.Valid && periode.After(dateOnly(akhir.Time)) {
+			return time.Time{}, false
+		}
+		if akhir.Valid && periodeAkhir.After(dateOnly(akhir.Time)) {
+			periodeAkhir = dateOnly(akhir.Time)
+		}
+
+		biaya := prorata(hargaPeriode, selisihHari(periode, periodeAkhir)+1, hariPenuh)
+		if nominal, ok := tagihan[periode]; ok {
+			biaya = nominal
+		}
+		// Toleransi setengah sen untuk pembulatan DECIMAL
+		if dibayar+0.005 < biaya {
+			return periode, true
+		}
+		dibayar -= biaya
+	}
+	return time.Time{}, false
+}
+
+// hitungJatuhTempo menghitung jatuh tempo berikutnya untuk satu kontrak.
+// Kontrak yang tidak aktif tidak punya jatuh tempo.
+func hitungJatuhTempo(q querier, kontrakID int64) (sql.NullTime, error) {
+	var mulai time.Time
+	var akhir sql.NullTime
+	var periode, status string
+	var hariTagihan int
+	var harga float64
+	err := q.QueryRow(`
+		SELECT tanggal_mulai, tanggal_akhir, periode_tagihan, COALESCE(hari_tagihan, 0), harga_sewa, status
+		FROM kontrak WHERE id=?`, kontrakID).Scan(&mulai, &akhir, &periode, &hariTagihan, &harga, &status)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	if status != "aktif" {
+		return sql.NullTime{}, nil
+	}
+	bulan := periodeBulan[periode]
+	if bulan == 0 {
+		bulan = 1
+	}
+
+	// Uang masuk per tagihan: uang_dibayar (NULL berarti lunas, data lama)
+	// atau jumlah riwayat cicilan, mana yang lebih besar.
+	rows, err := q.Query(`
+		SELECT pb.periode_mulai, pb.nominal,
+		       GREATEST(COALESCE(pb.uang_dibayar, pb.nominal),
+		                COALESCE((SELECT SUM(r.jumlah_dibayar - r.lebih_bayar) FROM riwayat_pembayaran r WHERE r.pembayaran_id = pb.id), 0))
+		FROM pembayaran pb
+		WHERE pb.kontrak_id = ?`, kontrakID)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	defer rows.Close()
+
+	tagihan := map[time.Time]float64{}
+	dibayar := 0.0
+	for rows.Next() {
+		var periodeMulai sql.NullTime
+		var nominal, masuk float64
+		if err := rows.Scan(&periodeMulai, &nominal, &masuk); err != nil {
+			return sql.NullTime{}, err
+		}
+		if periodeMulai.Valid {
+			tagihan[dateOnly(periodeMulai.Time)] = nominal
+		}
+		dibayar += masuk
+	}
+	if err := rows.Err(); err != nil {
+		return sql.NullTime{}, err
+	}
+
+	due, ok := jatuhTempoDari(dateOnly(mulai), akhir, bulan, hariTagihan, harga*float64(bulan), tagihan, dibayar)
+	return sql.NullTime{Time: due, Valid: ok}, nil
+}
+
+// recalcJatuhTempo menyimpan jatuh tempo kontrak lalu menyalin jatuh tempo
+// terdekat dari kontrak aktif ke penyewa, yang dipakai response penyewa
+// dan properti.
+func recalcJatuhTempo(q querier, kontrakID int64) error {
+	due, err := hitungJatuhTempo(q, kontrakID)
+	if err != nil {
+		return err
+	}
+
+	var value interface{}
+	if due.Valid {
+		value = due.Time.Format("2006-01-02")
+	}
+	if _, err := q.Exec("UPDATE kontrak SET jatuh_tempo=? WHERE id=?", value, kontrakID); err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`
+		UPDATE penyewa SET jatuh_tempo = (
+			SELECT MIN(k.jatuh_tempo) FROM kontrak k WHERE k.penyewa_id = penyewa.id AND k.status = 'aktif'
+		) WHERE id = (SELECT penyewa_id FROM kontrak WHERE id=?)`, kontrakID)
+	return err
+}
+
+// recalcJatuhTempoPembayaran dipanggil setelah cicilan ditambah atau
+// dihapus. Tagihan tanpa kontrak diabaikan.
+func recalcJatuhTempoPembayaran(q querier, pembayaranID interface{}) error {
+	var kontrakID sql.NullInt64
+	err := q.QueryRow("SELECT kontrak_id FROM pembayaran WHERE id=?", pembayaranID).Scan(&kontrakID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !kontrakID.Valid) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return recalcJatuhTempo(q, kontrakID.Int64)
+}
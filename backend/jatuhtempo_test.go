@@ -0,0 +1,40 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestJatuhTempoDari(t *testing.T) {
+	mulai := tanggal("2026-01-31")
+	akhir := sql.NullTime{Time: tanggal("2026-04-29"), Valid: true}
+	tests := []struct {
+		name    string
+		akhir   sql.NullTime
+		tagihan map[time.Time]float64
+		dibayar float64
+		want    string
+	}{
+		{"belum bayar", sql.NullTime{}, nil, 0, "2026-01-31"},
+		{"satu periode", sql.NullTime{}, nil, 1000000, "2026-02-28"},
+		{"kurang setengah sen tetap lunas", sql.NullTime{}, nil, 999999.996, "2026-02-28"},
+		{"cicilan sebagian", sql.NullTime{}, nil, 1500000, "2026-02-28"},
+		{"nominal tagihan dipakai", sql.NullTime{}, map[time.Time]float64{tanggal("2026-01-31"): 1200000}, 1000000, "2026-01-31"},
+		{"lunas sampai akhir kontrak", akhir, nil, 3000000, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := jatuhTempoDari(mulai, tt.akhir, 1, 0, 1000000, tt.tagihan, tt.dibayar)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("got %s, want lunas", got.Format("2006-01-02"))
+				}
+				return
+			}
+			if !ok || got.Format("2006-01-02") != tt.want {
+				t.Fatalf("got %s (ok=%v), want %s", got.Format("2006-01-02"), ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kontrak adalah perjanjian sewa antara penyewa dan satu unit. Tagihan
+// bulanan (pembayaran) dan cicilannya mengacu ke kontrak lewat kontrak_id.
+type Kontrak struct {
+	ID             int64   `json:"id"`
+	PenyewaID      int64   `json:"penyewa_id"`
+	NamaPenyewa    string  `json:"nama_penyewa"`
+	PropertiID     int64   `json:"properti_id"`
+	NamaUnit       string  `json:"nama_unit"`
+	TanggalMulai   string  `json:"tanggal_mulai"`
+	TanggalAkhir   string  `json:"tanggal_akhir"`
+	TanggalKeluar  string  `json:"tanggal_keluar"`
+	PeriodeTagihan string  `json:"periode_tagihan"`
+	HariTagihan    int     `json:"hari_tagihan"`
+	HargaSewa      float64 `json:"harga_sewa"`
+	Deposit        float64 `json:"deposit"`
+	Status         string  `json:"status"`
+	JatuhTempo     string  `json:"jatuh_tempo"`
+	Keterangan     string  `json:"keterangan"`
+	JumlahTagihan  int     `json:"jumlah_tagihan"`
+	TotalTagihan   float64 `json:"total_tagihan"`
+	TotalDibayar   float64 `json:"total_dibayar"`
+}
+
+var (
+	periodeTagihanValid = []string{"bulanan", "triwulan", "semester", "tahunan"}
+	statusKontrakValid  = []string{"aktif", "berakhir", "diputus"}
+)
+
+// errUnitSudahDisewa dikembalikan jika unit masih punya kontrak aktif lain.
+var errUnitSudahDisewa = errors.New("unit masih punya kontrak aktif")
+
+const kontrakSelect = `
+	SELECT k.id, k.penyewa_id, COALESCE(py.nama, ''), COALESCE(k.properti_id, 0), COALESCE(pr.nama_unit, ''),
+	       k.tanggal_mulai, k.tanggal_akhir, k.tanggal_keluar, k.periode_tagihan, COALESCE(k.hari_tagihan, 0), k.harga_sewa, k.deposit, k.status,
+	       k.jatuh_tempo, COALESCE(k.keterangan, ''),
+	       (SELECT COUNT(*) FROM pembayaran pb WHERE pb.kontrak_id = k.id),
+	       (SELECT COALESCE(SUM(pb.nominal), 0) FROM pembayaran pb WHERE pb.kontrak_id = k.id),
+	       (SELECT COALESCE(SUM(r.jumlah_dibayar - r.lebih_bayar), 0) FROM riwayat_pembayaran r WHERE r.kontrak_id = k.id)
+	FROM kontrak k
+	LEFT JOIN penyewa py ON py.id = k.penyewa_id
+	LEFT JOIN properti pr ON pr.id = k.properti_id`
+
+func scanKontrak(row interface{ Scan(...interface{}) error }) (Kontrak, error) {
+	var k Kontrak
+	var mulai, akhir, keluar, jatuhTempo sql.NullTime
+	err := row.Scan(&k.ID, &k.PenyewaID, &k.NamaPenyewa, &k.PropertiID, &k.NamaUnit,
+		&mulai, &akhir, &keluar, &k.PeriodeTagihan, &k.HariTagihan, &k.HargaSewa, &k.Deposit, &k.Status,
+		&jatuhTempo, &k.Keterangan, &k.JumlahTagihan, &k.TotalTagihan, &k.TotalDibayar)
+	k.TanggalMulai = dateString(mulai)
+	k.TanggalAkhir = dateString(akhir)
+	k.TanggalKeluar = dateString(keluar)
+	k.JatuhTempo = dateString(jatuhTempo)
+	return k, err
+}
+
+// kontrakData adalah field kontrak dari request, dipakai oleh handler
+// kontrak maupun createPembayaran yang membuat kontrak otomatis.
+type kontrakData struct {
+	PenyewaID      string
+	PropertiID     string
+	TanggalMulai   string
+	TanggalAkhir   string
+	PeriodeTagihan string
+	HariTagihan    string
+	HargaSewa      string
+	Deposit        string
+	Status         string
+	Keterangan     string
+}
+
+func kontrakDataFromInput(in *requestInput) kontrakData {
+	return kontrakData{
+		PenyewaID:      in.Get("penyewa_id"),
+		PropertiID:     in.Get("properti_id"),
+		TanggalMulai:   convertDateFormat(in.Get("tanggal_mulai")),
+		TanggalAkhir:   convertDateFormat(in.Get("tanggal_akhir")),
+		PeriodeTagihan: in.Get("periode_tagihan"),
+		HariTagihan:    in.Get("hari_tagihan"),
+		HargaSewa:      in.Get("harga_sewa"),
+		Deposit:        in.Get("deposit"),
+		Status:         in.Get("status"),
+		Keterangan:     in.Get("keterangan"),
+	}
+}
+
+// insertKontrak menyimpan kontrak baru. Jika harga_sewa kosong, harga
+// unit dipakai. Kontrak aktif menandai unit terisi dan menautkan penyewa
+// ke unit tersebut.
+func insertKontrak(tx *Tx, k kontrakData) (int64, error) {
+	if k.PeriodeTagihan == "" {
+		k.PeriodeTagihan = "bulanan"
+	}
+	if k.Status == "" {
+		k.Status = "aktif"
+	}
+	if k.Deposit == "" {
+		k.Deposit = "0"
+	}
+	if k.HargaSewa == "" {
+		harga, err := hargaSewaUnit(tx, k.PropertiID)
+		if err != nil {
+			return 0, err
+		}
+		k.HargaSewa = harga
+	}
+
+	if err := checkUnitTersedia(tx, k.PropertiID, k.Status, 0); err != nil {
+		return 0, err
+	}
+
+	id, err := tx.InsertID(`
+		INSERT INTO kontrak (penyewa_id, properti_id, tanggal_mulai, tanggal_akhir, periode_tagihan, hari_tagihan, harga_sewa, deposit, status, keterangan)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		k.PenyewaID, nullIfEmpty(k.PropertiID), k.TanggalMulai, nullIfEmpty(k.TanggalAkhir),
+		k.PeriodeTagihan, nullIfEmpty(k.HariTagihan), k.HargaSewa, k.Deposit, k.Status, nullIfEmpty(k.Keterangan),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if k.Status == "aktif" && k.PropertiID != "" {
+		if _, err := tx.Exec("UPDATE properti SET status='terisi' WHERE id=?", k.PropertiID); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("UPDATE penyewa SET properti_id=?, mulai_kontrak=? WHERE id=?", k.PropertiID, k.TanggalMulai, k.PenyewaID); err != nil {
+			return 0, err
+		}
+	}
+	if err := sinkronHunian(tx, id, hariIni()); err != nil {
+		return 0, err
+	}
+	return id, recalcJatuhTempo(tx, id)
+}
+
+// hargaSewaUnit adalah harga default kontrak tanpa harga_sewa: harga unit,
+// atau 0 jika kontrak tidak terikat unit.
+func hargaSewaUnit(tx *Tx, propertiID string) (string, error) {
+	if propertiID == "" {
+		return "0", nil
+	}
+	var harga float64
+	err := tx.QueryRow("SELECT harga_sewa FROM properti WHERE id=?", propertiID).Scan(&harga)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return strconv.FormatFloat(harga, 'f', -1, 64), nil
+}
+
+// checkUnitTersedia menolak kontrak aktif kedua pada unit yang sama.
+// Baris properti dikunci sampai transaksi selesai, jadi dua request yang
+// bersamaan untuk unit yang sama diproses bergantian. Pengecekan kontrak
+// juga memakai locking read supaya di MySQL (REPEATABLE READ) kontrak yang
+// baru di-commit request lain tetap terlihat.
+func checkUnitTersedia(tx *Tx, propertiID, status string, exceptID int64) error {
+	if propertiID == "" || status != "aktif" {
+		return nil
+	}
+	var id int64
+	err := tx.QueryRow("SELECT id FROM properti WHERE id=? FOR UPDATE", propertiID).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	err = tx.QueryRow(`
+		SELECT id FROM kontrak
+		WHERE properti_id=? AND status='aktif' AND id<>?
+		LIMIT 1 FOR UPDATE`, propertiID, exceptID).Scan(&id)
+	if err == nil {
+		return errUnitSudahDisewa
+	}
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+func validateKontrak(in *requestInput, partial bool) []FieldError {
+	var fieldErrors []FieldError
+	for _, field := range []string{"penyewa_id", "properti_id", "tanggal_mulai"} {
+		if !partial || in.Has(field) {
+			fieldErrors = append(fieldErrors, requiredFields(in, field)...)
+		}
+	}
+	fieldErrors = append(fieldErrors, numericFields(in, "penyewa_id", "properti_id", "harga_sewa", "deposit", "hari_tagihan")...)
+	if hari, err := strconv.Atoi(in.Get("hari_tagihan")); err == nil && (hari < 1 || hari > 28) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "hari_tagihan", Message: "hari_tagihan harus antara 1 dan 28"})
+	}
+	fieldErrors = append(fieldErrors, dateFields(in, "tanggal_mulai", "tanggal_akhir")...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "periode_tagihan", periodeTagihanValid)...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "status", statusKontrakValid)...)
+
+	mulai := convertDateFormat(in.Get("tanggal_mulai"))
+	akhir := convertDateFormat(in.Get("tanggal_akhir"))
+	if mulai != "" && akhir != "" && akhir < mulai {
+		fieldErrors = append(fieldErrors, FieldError{Field: "tanggal_akhir", Message: "tanggal_akhir tidak boleh sebelum tanggal_mulai"})
+	}
+	return fieldErrors
+}
+
+// respondKontrakError menerjemahkan errUnitSudahDisewa ke CONFLICT,
+// error lain lewat respondDBError.
+func respondKontrakError(c *gin.Context, err error) {
+	if errors.Is(err, errUnitSudahDisewa) {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Unit masih punya kontrak aktif", nil)
+		return
+	}
+	respondDBError(c, err)
+}
+
+// KONTRAK HANDLERS
+func getKontrak(c *gin.Context) {
+	filter := kontrakFilter(c)
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
+	rows, err := db.Query(kontrakSelect+filter.where()+" ORDER BY k.tanggal_mulai DESC, k.id DESC", filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	kontrakList := []Kontrak{}
+	for rows.Next() {
+		k, err := scanKontrak(rows)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		kontrakList = append(kontrakList, k)
+	}
+
+	c.JSON(http.StatusOK, kontrakList)
+}
+
+// getKontrakByID mengembalikan kontrak beserta daftar tagihannya.
+func getKontrakByID(c *gin.Context) {
+	id := c.Param("id")
+
+	k, err := scanKontrak(db.QueryRow(kontrakSelect+" WHERE k.id=?", id))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT id, nominal, COALESCE(uang_dibayar, 0), tanggal_mulai, tanggal_akhir, status
+		FROM pembayaran WHERE kontrak_id=?
+		ORDER BY tanggal_mulai ASC, id ASC`, id)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	tagihan := []gin.H{}
+	for rows.Next() {
+		var pbID int64
+		var nominal, dibayar float64
+		var mulai, akhir sql.NullTime
+		var status string
+		if err := rows.Scan(&pbID, &nominal, &dibayar, &mulai, &akhir, &status); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		tagihan = append(tagihan, gin.H{
+			"id":            pbID,
+			"nominal":       nominal,
+			"uang_dibayar":  dibayar,
+			"tanggal_mulai": dateString(mulai),
+			"tanggal_akhir": dateString(akhir),
+			"status":        status,
+		})
+	}
+
+	perjanjian, err := loadDokumenKontrak(db, id)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"kontrak": k, "pembayaran": tagihan, "perjanjian": perjanjian})
+}
+
+func createKontrak(c *gin.Context) {
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateKontrak(in, false); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	id, err := insertKontrak(tx, kontrakDataFromInput(in))
+	if err != nil {
+		respondKontrakError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Kontrak berhasil dibuat"})
+}
+
+func updateKontrak(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateKontrak(in, false); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "kontrak", id) {
+		return
+	}
+	kontrakID, _ := strconv.ParseInt(id, 10, 64)
+
+	k := kontrakDataFromInput(in)
+	if k.PeriodeTagihan == "" {
+		k.PeriodeTagihan = "bulanan"
+	}
+	if k.Status == "" {
+		k.Status = "aktif"
+	}
+	if k.Deposit == "" {
+		k.Deposit = "0"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Sama dengan kontrak baru: tanpa harga_sewa dipakai harga unit
+	if k.HargaSewa == "" {
+		if k.HargaSewa, err = hargaSewaUnit(tx, k.PropertiID); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+
+	if err := checkUnitTersedia(tx, k.PropertiID, k.Status, kontrakID); err != nil {
+		respondKontrakError(c, err)
+		return
+	}
+
+	var propertiLama sql.NullInt64
+	if err := tx.QueryRow("SELECT properti_id FROM kontrak WHERE id=?", id).Scan(&propertiLama); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE kontrak SET
+			penyewa_id=?, properti_id=?, tanggal_mulai=?, tanggal_akhir=?, periode_tagihan=?, hari_tagihan=?,
+			harga_sewa=?, deposit=?, status=?, keterangan=?, updated_at=CURRENT_TIMESTAMP
+		WHERE id=?`,
+		k.PenyewaID, k.PropertiID, k.TanggalMulai, nullIfEmpty(k.TanggalAkhir), k.PeriodeTagihan, nullIfEmpty(k.HariTagihan),
+		k.HargaSewa, k.Deposit, k.Status, nullIfEmpty(k.Keterangan), id,
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := sinkronUnitKontrak(tx, kontrakID, propertiLama); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := recalcJatuhTempo(tx, kontrakID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kontrak berhasil diupdate"})
+}
+
+// patchKontrak hanya mengubah field yang dikirim client
+func patchKontrak(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateKontrak(in, true); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "kontrak", id) {
+		return
+	}
+	kontrakID, _ := strconv.ParseInt(id, 10, 64)
+
+	sets, args := buildPatch(in, []patchField{
+		{Field: "penyewa_id", Column: "penyewa_id"},
+		{Field: "properti_id", Column: "properti_id"},
+		{Field: "tanggal_mulai", Column: "tanggal_mulai", Convert: convertDateFormat},
+		{Field: "tanggal_akhir", Column: "tanggal_akhir", Convert: convertDateFormat, Nullable: true},
+		{Field: "periode_tagihan", Column: "periode_tagihan"},
+		{Field: "hari_tagihan", Column: "hari_tagihan", Nullable: true},
+		{Field: "harga_sewa", Column: "harga_sewa"},
+		{Field: "deposit", Column: "deposit"},
+		{Field: "status", Column: "status"},
+		{Field: "keterangan", Column: "keterangan", Nullable: true},
+	})
+	if len(sets) == 0 {
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Tidak ada field yang diubah", nil)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var propertiLama sql.NullInt64
+	var status string
+	if err := tx.QueryRow("SELECT properti_id, status FROM kontrak WHERE id=?", id).Scan(&propertiLama, &status); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	// Cek bentrok memakai nilai akhir setelah patch
+	if in.Has("properti_id") || in.Has("status") {
+		unit := ""
+		if propertiLama.Valid {
+			unit = strconv.FormatInt(propertiLama.Int64, 10)
+		}
+		if in.Has("properti_id") {
+			unit = in.Get("properti_id")
+		}
+		if in.Has("status") {
+			status = in.Get("status")
+		}
+		if err := checkUnitTersedia(tx, unit, status, kontrakID); err != nil {
+			respondKontrakError(c, err)
+			return
+		}
+	}
+
+	sets = append(sets, "updated_at=CURRENT_TIMESTAMP")
+	args = append(args, id)
+	if _, err := tx.Exec("UPDATE kontrak SET "+strings.Join(sets, ", ")+" WHERE id=?", args...); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := sinkronUnitKontrak(tx, kontrakID, propertiLama); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := recalcJatuhTempo(tx, kontrakID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kontrak berhasil diupdate"})
+}
+
+// deleteKontrak hanya untuk kontrak yang belum punya tagihan; kontrak yang
+// sudah berjalan diakhiri lewat status berakhir/diputus.
+func deleteKontrak(c *gin.Context) {
+	id := c.Param("id")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var penyewaID int64
+	var propertiID sql.NullInt64
+	err = tx.QueryRow("SELECT penyewa_id, properti_id FROM kontrak WHERE id=? FOR UPDATE", id).Scan(&penyewaID, &propertiID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	var tagihan int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM pembayaran WHERE kontrak_id=?", id).Scan(&tagihan); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if tagihan > 0 {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Kontrak sudah punya tagihan, ubah statusnya menjadi berakhir atau diputus", nil)
+		return
+	}
+
+	// Kontrak tanpa tagihan biasanya salah input, jadi riwayat huniannya
+	// ikut dihapus.
+	if _, err := tx.Exec("DELETE FROM riwayat_hunian WHERE kontrak_id=?", id); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	result, err := tx.Exec("DELETE FROM kontrak WHERE id=?", id)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if propertiID.Valid {
+		if _, err := tx.Exec("UPDATE penyewa SET properti_id=NULL WHERE id=? AND properti_id=?", penyewaID, propertiID.Int64); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		if err := lepaskanUnit(tx, propertiID.Int64, "kosong"); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	respondDeleted(c, result, "kontrak", "Kontrak berhasil dihapus")
+}
+
+// kontrakForPembayaran menentukan kontrak untuk tagihan baru. Tanpa
+// kontrak_id, kontrak aktif penyewa (di unit yang sama) dipakai ulang;
+// jika belum ada, kontrak baru dibuat dari data tagihan.
+func kontrakForPembayaran(tx *Tx, kontrakID string, k kontrakData) (int64, error) {
+	if kontrakID != "" {
+		var id int64
+		err := tx.QueryRow("SELECT id FROM kontrak WHERE id=?", kontrakID).Scan(&id)
+		return id, err
+	}
+
+	query := "SELECT id FROM kontrak WHERE penyewa_id=? AND status='aktif'"
+	args := []interface{}{k.PenyewaID}
+	if k.PropertiID != "" {
+		query += " AND properti_id=?"
+		args = append(args, k.PropertiID)
+	}
+	var id int64
+	err := tx.QueryRow(query+" ORDER BY tanggal_mulai DESC LIMIT 1", args...).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	k.Keterangan = keteranganKontrakOtomatis
+	return insertKontrak(tx, k)
+}
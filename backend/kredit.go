@@ -0,0 +1,295 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KreditTransaksi adalah satu baris buku saldo kredit penyewa: masuk dari
+// lebih bayar, pakai untuk tagihan berikutnya, refund ke penyewa, atau
+// batal saat cicilan asal lebih bayarnya dibatalkan.
+type KreditTransaksi struct {
+	ID           int64   `json:"id"`
+	Jenis        string  `json:"jenis"`
+	Nominal      float64 `json:"nominal"`
+	Tanggal      string  `json:"tanggal"`
+	MetodeBayar  string  `json:"metode_bayar"`
+	PembayaranID int64   `json:"pembayaran_id"`
+	Keterangan   string  `json:"keterangan"`
+}
+
+// KreditStatement adalah rekap saldo kredit satu penyewa.
+type KreditStatement struct {
+	PenyewaID   int64             `json:"penyewa_id"`
+	NamaPenyewa string            `json:"nama_penyewa"`
+	Masuk       float64           `json:"masuk"`
+	Dipakai     float64           `json:"dipakai"`
+	Refund      float64           `json:"refund"`
+	Dibatalkan  float64           `json:"dibatalkan"`
+	Saldo       float64           `json:"saldo"`
+	Transaksi   []KreditTransaksi `json:"transaksi"`
+}
+
+var (
+	errSaldoKreditKurang = errors.New("refund melebihi saldo kredit")
+	errKreditTerpakai    = errors.New("kredit dari cicilan ini sudah terpakai")
+)
+
+func respondKreditError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errSaldoKreditKurang):
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Refund melebihi saldo kredit", nil)
+	case errors.Is(err, errKreditTerpakai):
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Lebih bayar dari cicilan ini sudah dipakai atau direfund", nil)
+	default:
+		respondDBError(c, err)
+	}
+}
+
+// saldoKredit = masuk - pakai - refund - batal.
+func saldoKredit(q querier, penyewaID int64) (float64, error) {
+	var saldo float64
+	err := q.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN jenis = 'masuk' THEN nominal ELSE -nominal END), 0)
+		FROM kredit_transaksi WHERE penyewa_id = ?`, penyewaID).Scan(&saldo)
+	return math.Round(saldo*100) / 100, err
+}
+
+// kunciSaldoKredit mengunci baris penyewa sampai transaksi selesai, supaya
+// dua pemakaian atau refund bersamaan tidak membaca saldo yang sama.
+func kunciSaldoKredit(q querier, penyewaID int64) error {
+	var id int64
+	return q.QueryRow("SELECT id FROM penyewa WHERE id=? FOR UPDATE", penyewaID).Scan(&id)
+}
+
+// loadKreditStatement mengembalikan sql.ErrNoRows jika penyewa tidak ada.
+func loadKreditStatement(q querier, penyewaID int64) (*KreditStatement, error) {
+	s := &KreditStatement{PenyewaID: penyewaID, Transaksi: []KreditTransaksi{}}
+	if err := q.QueryRow("SELECT nama FROM penyewa WHERE id=?", penyewaID).Scan(&s.NamaPenyewa); err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(`
+		SELECT id, jenis, nominal, tanggal, COALESCE(metode_bayar, ''), COALESCE(pembayaran_id, 0), COALESCE(keterangan, '')
+		FROM kredit_transaksi WHERE penyewa_id = ?
+		ORDER BY tanggal, id`, penyewaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t KreditTransaksi
+		var tanggal sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Jenis, &t.Nominal, &tanggal, &t.MetodeBayar, &t.PembayaranID, &t.Keterangan); err != nil {
+			return nil, err
+		}
+		t.Tanggal = dateString(tanggal)
+		switch t.Jenis {
+		case "masuk":
+			s.Masuk += t.Nominal
+		case "pakai":
+			s.Dipakai += t.Nominal
+		case "refund":
+			s.Refund += t.Nominal
+		case "batal":
+			s.Dibatalkan += t.Nominal
+		}
+		s.Transaksi = append(s.Transaksi, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.Saldo = math.Round((s.Masuk-s.Dipakai-s.Refund-s.Dibatalkan)*100) / 100
+	return s, nil
+}
+
+// simpanLebihBayar dipanggil setelah cicilan dicatat. Bagian cicilan yang
+// melebihi sisa tagihan dipindah ke saldo kredit penyewa dan dicatat di
+// lebih_bayar cicilan, sehingga uang_dibayar tidak pernah lebih dari
+// nominal sementara jumlah_dibayar (dan kwitansinya) tetap uang yang
+// diterima. Mengembalikan nominal kredit yang tercatat.
+func simpanLebihBayar(q querier, pembayaranID interface{}, riwayatID int64) (float64, error) {
+	var id int64
+	var penyewaID sql.NullInt64
+	var nominal, dibayar, jumlah float64
+	var metode string
+	var tanggal sql.NullTime
+	err := q.QueryRow(`
+		SELECT pb.id, pb.penyewa_id, pb.nominal,
+		       (SELECT COALESCE(SUM(x.jumlah_dibayar - x.lebih_bayar), 0) FROM riwayat_pembayaran x WHERE x.pembayaran_id = pb.id),
+		       r.jumlah_dibayar - r.lebih_bayar, r.tanggal_bayar, COALESCE(r.metode_bayar, '')
+		FROM riwayat_pembayaran r
+		JOIN pembayaran pb ON pb.id = r.pembayaran_id
+		WHERE r.id = ? AND pb.id = ?`, riwayatID, pembayaranID).Scan(
+		&id, &penyewaID, &nominal, &dibayar, &jumlah, &tanggal, &metode)
+	if err != nil {
+		return 0, err
+	}
+	if !penyewaID.Valid {
+		return 0, nil
+	}
+
+	lebih := math.Round(math.Min(dibayar-nominal, jumlah)*100) / 100
+	if lebih <= 0.005 {
+		return 0, nil
+	}
+
+	if _, err := q.Exec("UPDATE riwayat_pembayaran SET lebih_bayar = lebih_bayar + ? WHERE id=?", lebih, riwayatID); err != nil {
+		return 0, err
+	}
+	tgl := time.Now().Format("2006-01-02")
+	if tanggal.Valid {
+		tgl = tanggal.Time.Format("2006-01-02")
+	}
+	_, err = q.Exec(`
+		INSERT INTO kredit_transaksi (penyewa_id, jenis, nominal, tanggal, metode_bayar, pembayaran_id, riwayat_id, keterangan)
+		VALUES (?, 'masuk', ?, ?, ?, ?, ?, ?)`,
+		penyewaID.Int64, lebih, tgl, nullIfEmpty(metode), id, riwayatID,
+		"Lebih bayar tagihan #"+strconv.FormatInt(id, 10),
+	)
+	return lebih, err
+}
+
+// pakaiSaldoKredit melunasi tagihan sebanyak mungkin dari saldo kredit
+// penyewa. Pemakaian dicatat sebagai cicilan dengan metode "Kredit" supaya
+// uang_dibayar dan jatuh tempo ikut terhitung.
+func pakaiSaldoKredit(q querier, penyewaID, pembayaranID int64, tanggal string) (float64, error) {
+	if err := kunciSaldoKredit(q, penyewaID); err != nil {
+		return 0, err
+	}
+	saldo, err := saldoKredit(q, penyewaID)
+	if err != nil || saldo <= 0.005 {
+		return 0, err
+	}
+
+	var sisa float64
+	err = q.QueryRow(`
+		SELECT pb.nominal - (SELECT COALESCE(SUM(r.jumlah_dibayar - r.lebih_bayar), 0) FROM riwayat_pembayaran r WHERE r.pembayaran_id = pb.id)
+		FROM pembayaran pb WHERE pb.id=?`, pembayaranID).Scan(&sisa)
+	if err != nil {
+		return 0, err
+	}
+	jumlah := math.Round(math.Min(saldo, sisa)*100) / 100
+	if jumlah <= 0.005 {
+		return 0, nil
+	}
+
+	riwayatID, err := q.InsertID(`
+		INSERT INTO riwayat_pembayaran (pembayaran_id, kontrak_id, jumlah_dibayar, tanggal_bayar, metode_bayar, keterangan)
+		VALUES (?, (SELECT kontrak_id FROM pembayaran WHERE id=?), ?, ?, 'Kredit', 'Dipakai dari saldo kredit')`,
+		pembayaranID, pembayaranID, jumlah, tanggal,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := q.Exec(`
+		INSERT INTO kredit_transaksi (penyewa_id, jenis, nominal, tanggal, pembayaran_id, riwayat_id, keterangan)
+		VALUES (?, 'pakai', ?, ?, ?, ?, ?)`,
+		penyewaID, jumlah, tanggal, pembayaranID, riwayatID, "Dipakai untuk tagihan #"+strconv.FormatInt(pembayaranID, 10),
+	); err != nil {
+		return 0, err
+	}
+	return jumlah, sinkronPembayaran(q, pembayaranID)
+}
+
+// KREDIT HANDLERS
+func getKreditPenyewa(c *gin.Context) {
+	penyewaID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondNotFound(c, "Data penyewa tidak ditemukan")
+		return
+	}
+
+	s, err := loadKreditStatement(db, penyewaID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// POST /api/penyewa/:id/kredit/refund mengembalikan saldo kredit ke penyewa.
+func refundKreditPenyewa(c *gin.Context) {
+	penyewaID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondNotFound(c, "Data penyewa tidak ditemukan")
+		return
+	}
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	fieldErrors := requiredFields(in, "nominal")
+	fieldErrors = append(fieldErrors, numericFields(in, "nominal")...)
+	fieldErrors = append(fieldErrors, dateFields(in, "tanggal")...)
+	if nominal, err := strconv.ParseFloat(in.Get("nominal"), 64); err == nil && nominal <= 0 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "nominal", Message: "nominal harus lebih dari 0"})
+	}
+	if len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	tanggal := convertDateFormat(in.Get("tanggal"))
+	if tanggal == "" {
+		tanggal = time.Now().Format("2006-01-02")
+	}
+	metode := in.Get("metode_bayar")
+	if metode == "" {
+		metode = "Transfer"
+	}
+	keterangan := in.Get("keterangan")
+	if keterangan == "" {
+		keterangan = "Pengembalian saldo kredit"
+	}
+	nominal, _ := strconv.ParseFloat(in.Get("nominal"), 64)
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := kunciSaldoKredit(tx, penyewaID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	s, err := loadKreditStatement(tx, penyewaID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if nominal > s.Saldo+0.005 {
+		respondKreditError(c, errSaldoKreditKurang)
+		return
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO kredit_transaksi (penyewa_id, jenis, nominal, tanggal, metode_bayar, keterangan)
+		VALUES (?, 'refund', ?, ?, ?, ?)`,
+		penyewaID, nominal, tanggal, metode, keterangan,
+	); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if s, err = loadKreditStatement(tx, penyewaID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, s)
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+)
+
+// Tanda tangan pemilik diunggah lewat POST /api/kwitansi/ttd, atau diatur
+// dengan KWITANSI_TTD (path file PNG/JPG). Nama pemilik dari
+// KWITANSI_PEMILIK dan kota dari KWITANSI_KOTA.
+var ttdDir = filepath.Join(dokumenDir, "ttd")
+
+// percobaanKwitansi adalah batas ulang penerbitan saat nomor bentrok
+// dengan permintaan lain.
+const percobaanKwitansi = 3
+
+var errBelumDibayar = errors.New("belum ada pembayaran")
+
+// kwitansiData adalah isi satu kwitansi, untuk seluruh tagihan atau satu
+// cicilan.
+type kwitansiData struct {
+	PembayaranID int64
+	RiwayatID    sql.NullInt64
+	Nomor        string
+	Tanggal      time.Time
+	NamaPenyewa  string
+	NamaUnit     string
+	Nominal      float64
+	MetodeBayar  string
+	TanggalBayar time.Time
+	Keperluan    string
+}
+
+// terbitkanKwitansi mengisi nomor dan tanggal kwitansi. Kwitansi cicilan
+// selalu memakai nomor yang sama; kwitansi tagihan memakai nomor lama
+// selama total yang dibayar belum berubah. Baris tagihan dikunci supaya
+// cetak bersamaan tidak menerbitkan dua nomor untuk kwitansi yang sama.
+func terbitkanKwitansi(q querier, k *kwitansiData) error {
+	var id int64
+	if err := q.QueryRow("SELECT id FROM pembayaran WHERE id=? FOR UPDATE", k.PembayaranID).Scan(&id); err != nil {
+		return err
+	}
+
+	var tanggal sql.NullTime
+	var err error
+	if k.RiwayatID.Valid {
+		err = q.QueryRow("SELECT nomor, tanggal FROM kwitansi WHERE riwayat_id=?", k.RiwayatID).Scan(&k.Nomor, &tanggal)
+	} else {
+		err = q.QueryRow(`
+			SELECT nomor, tanggal FROM kwitansi
+			WHERE pembayaran_id=? AND jenis='tagihan' AND ABS(nominal - ?) < 0.005
+			ORDER BY id DESC LIMIT 1`, k.PembayaranID, k.Nominal).Scan(&k.Nomor, &tanggal)
+	}
+	if err == nil {
+		k.Tanggal = tanggal.Time
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	k.Tanggal = time.Now()
+	urutan, err := nomorUrutKwitansi(q, k.Tanggal.Year())
+	if err != nil {
+		return err
+	}
+	jenis := "tagihan"
+	if k.RiwayatID.Valid {
+		jenis = "cicilan"
+	}
+	k.Nomor = fmt.Sprintf("KW/%d/%02d/%04d", k.Tanggal.Year(), int(k.Tanggal.Month()), urutan)
+	_, err = q.Exec(`
+		INSERT INTO kwitansi (nomor, tahun, urutan, tanggal, jenis, pembayaran_id, riwayat_id, nominal)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		k.Nomor, k.Tanggal.Year(), urutan, k.Tanggal.Format("2006-01-02"), jenis, k.PembayaranID, k.RiwayatID, k.Nominal,
+	)
+	return err
+}
+
+// nomorUrutKwitansi mengambil nomor urut berikutnya dari kwitansi_nomor.
+// UPDATE mengunci baris tahun itu sampai transaksi selesai, jadi penerbitan
+// bersamaan antre. Baris tahun baru dibuat dari nomor terbesar yang sudah
+// ada; jika dua permintaan membuatnya bersamaan, yang kalah mendapat
+// pelanggaran UNIQUE dan diulang oleh kirimKwitansi.
+func nomorUrutKwitansi(q querier, tahun int) (int, error) {
+	result, err := q.Exec("UPDATE kwitansi_nomor SET urutan = urutan + 1 WHERE tahun=?", tahun)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		if _, err := q.Exec(`
+			INSERT INTO kwitansi_nomor (tahun, urutan)
+			SELECT ?, COALESCE(MAX(urutan), 0) + 1 FROM kwitansi WHERE tahun=?`, tahun, tahun); err != nil {
+			return 0, err
+		}
+	}
+
+	var urutan int
+	err = q.QueryRow("SELECT urutan FROM kwitansi_nomor WHERE tahun=?", tahun).Scan(&urutan)
+	return urutan, err
+}
+
+// loadKwitansiPembayaran menyiapkan kwitansi untuk total yang sudah dibayar
+// pada satu tagihan. Tagihan yang belum dibayar tidak diberi kwitansi.
+func loadKwitansiPembayaran(q querier, pembayaranID string) (*kwitansiData, error) {
+	k := &kwitansiData{}
+	var nominal float64
+	var mulai, akhir, bayar sql.NullTime
+	err := q.QueryRow(`
+		SELECT pb.id, COALESCE(py.nama, ''), COALESCE(pr.nama_unit, ''), pb.nominal, COALESCE(pb.uang_dibayar, 0),
+		       COALESCE(pb.metode_bayar, ''),
+		       COALESCE(pb.tanggal_mulai, pb.tanggal_bayar), pb.tanggal_akhir,
+		       (SELECT MAX(r.tanggal_bayar) FROM riwayat_pembayaran r WHERE r.pembayaran_id = pb.id)
+		FROM pembayaran pb
+		LEFT JOIN penyewa py ON py.id = pb.penyewa_id
+		LEFT JOIN kontrak k ON k.id = pb.kontrak_id
+		LEFT JOIN properti pr ON pr.id = COALESCE(k.properti_id, py.properti_id)
+		WHERE pb.id=?`, pembayaranID).Scan(&k.PembayaranID, &k.NamaPenyewa, &k.NamaUnit, &nominal, &k.Nominal,
+		&k.MetodeBayar, &mulai, &akhir, &bayar)
+	if err != nil {
+		return nil, err
+	}
+	if k.Nominal <= 0 {
+		return nil, errBelumDibayar
+	}
+
+	k.TanggalBayar = bayar.Time
+	k.Keperluan = "Sewa " + k.NamaUnit + " periode " + periodeKwitansi(mulai, akhir)
+	if k.Nominal+0.005 < nominal {
+		k.Keperluan += fmt.Sprintf(" (sebagian dari %s)", formatRupiah(nominal))
+	}
+	return k, nil
+}
+
+// loadKwitansiRiwayat menyiapkan kwitansi satu cicilan. Cicilan yang sudah
+// dibatalkan dan baris pembaliknya tidak diberi kwitansi.
+func loadKwitansiRiwayat(q querier, pembayaranID, riwayatID string) (*kwitansiData, error) {
+	if err := cicilanTerkunci(q, riwayatID); err != nil {
+		return nil, err
+	}
+
+	k := &kwitansiData{}
+	var lebih float64
+	var mulai, akhir, bayar sql.NullTime
+	err := q.QueryRow(`
+		SELECT pb.id, r.id, COALESCE(py.nama, ''), COALESCE(pr.nama_unit, ''), r.jumlah_dibayar, r.lebih_bayar,
+		       COALESCE(r.metode_bayar, ''),
+		       COALESCE(pb.tanggal_mulai, pb.tanggal_bayar), pb.tanggal_akhir, r.tanggal_bayar
+		FROM riwayat_pembayaran r
+		JOIN pembayaran pb ON pb.id = r.pembayaran_id
+		LEFT JOIN penyewa py ON py.id = pb.penyewa_id
+		LEFT JOIN kontrak k ON k.id = pb.kontrak_id
+		LEFT JOIN properti pr ON pr.id = COALESCE(k.properti_id, py.properti_id)
+		WHERE r.id=? AND r.pembayaran_id=?`, riwayatID, pembayaranID).Scan(&k.PembayaranID, &k.RiwayatID, &k.NamaPenyewa,
+		&k.NamaUnit, &k.Nominal, &lebih, &k.MetodeBayar, &mulai, &akhir, &bayar)
+	if err != nil {
+		return nil, err
+	}
+	if k.Nominal <= 0 {
+		return nil, errBelumDibayar
+	}
+
+	k.TanggalBayar = bayar.Time
+	k.Keperluan = "Cicilan sewa " + k.NamaUnit + " periode " + periodeKwitansi(mulai, akhir)
+	if lebih > 0 {
+		k.Keperluan += fmt.Sprintf(" (lebih bayar %s masuk saldo kredit)", formatRupiah(lebih))
+	}
+	return k, nil
+}
+
+func periodeKwitansi(mulai, akhir sql.NullTime) string {
+	periode := formatTanggal(mulai.Time)
+	if akhir.Valid {
+		periode += " s/d " + formatTanggal(akhir.Time)
+	}
+	return periode
+}
+
+// fileTTD mencari gambar tanda tangan pemilik; string kosong jika belum ada.
+func fileTTD() string {
+	if path := os.Getenv("KWITANSI_TTD"); path != "" {
+		return path
+	}
+	for _, ext := range []string{".png", ".jpg", ".jpeg"} {
+		path := filepath.Join(ttdDir, "pemilik"+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func envOr(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func namaPemilik() string {
+	return envOr("KWITANSI_PEMILIK", "Pemilik Kontrakan")
+}
+
+// tempatTanggal menghasilkan "Bandung, 15 Januari 2026" untuk tanda tangan.
+func tempatTanggal(t time.Time) string {
+	if kota := envOr("KWITANSI_KOTA", ""); kota != "" {
+		return kota + ", " + formatTanggalPanjang(t)
+	}
+	return formatTanggalPanjang(t)
+}
+
+// renderKwitansi menggambar kwitansi di kertas A5 mendatar.
+func renderKwitansi(k *kwitansiData) ([]byte, error) {
+	pdf := fpdf.New("L", "mm", "A5", "")
+	pdf.SetTitle("Kwitansi "+k.Nomor, true)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, "KWITANSI", "", 1, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(0, 6, "No. "+k.Nomor, "", 1, "C", false, 0, "")
+	pdf.Ln(6)
+
+	baris := func(label, value string) {
+		pdf.SetFont("Helvetica", "", 11)
+		pdf.CellFormat(45, 7, label, "", 0, "L", false, 0, "")
+		pdf.CellFormat(4, 7, ":", "", 0, "L", false, 0, "")
+		pdf.MultiCell(0, 7, tr(value), "", "L", false)
+	}
+	baris("Telah terima dari", k.NamaPenyewa)
+	baris("Unit", k.NamaUnit)
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.CellFormat(45, 7, "Uang sejumlah", "", 0, "L", false, 0, "")
+	pdf.CellFormat(4, 7, ":", "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "BI", 11)
+	kata := terbilang(k.Nominal)
+	pdf.MultiCell(0, 7, strings.ToUpper(kata[:1])+kata[1:], "", "L", false)
+	baris("Untuk pembayaran", k.Keperluan)
+	metode := k.MetodeBayar
+	if !k.TanggalBayar.IsZero() {
+		metode = strings.TrimPrefix(metode+", "+formatTanggalPanjang(k.TanggalBayar), ", ")
+	}
+	baris("Metode bayar", metode)
+
+	// Nominal di kiri bawah, tanda tangan di kanan bawah
+	top := 100.0
+	pdf.SetXY(15, top+12)
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(70, 12, tr(formatRupiah(k.Nominal)), "1", 0, "C", false, 0, "")
+
+	pdf.SetXY(125, top)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(70, 5, tr(tempatTanggal(k.Tanggal)), "", 0, "C", false, 0, "")
+	if path := fileTTD(); path != "" {
+		pdf.ImageOptions(path, 140, top+6, 40, 0, false, fpdf.ImageOptions{ReadDpi: true}, 0, "")
+	}
+	pdf.SetXY(125, top+30)
+	pdf.SetFont("Helvetica", "BU", 10)
+	pdf.CellFormat(70, 5, tr(namaPemilik()), "", 0, "C", false, 0, "")
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// simpanKwitansi memuat data kwitansi dan menerbitkan nomornya dalam satu
+// transaksi.
+func simpanKwitansi(load func(q querier) (*kwitansiData, error)) (*kwitansiData, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	k, err := load(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := terbitkanKwitansi(tx, k); err != nil {
+		return nil, err
+	}
+	return k, tx.Commit()
+}
+
+// kirimKwitansi menerbitkan nomor (atau memakai nomor lama), lalu
+// mengirim PDF-nya. Nomor yang bentrok dengan permintaan lain diulang
+// dalam transaksi baru.
+func kirimKwitansi(c *gin.Context, load func(q querier) (*kwitansiData, error)) {
+	var k *kwitansiData
+	var err error
+	for i := 0; i < percobaanKwitansi; i++ {
+		if k, err = simpanKwitansi(load); !isUniqueViolation(err) {
+			break
+		}
+	}
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data pembayaran tidak ditemukan")
+		return
+	}
+	if errors.Is(err, errBelumDibayar) {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Belum ada pembayaran yang bisa dibuatkan kwitansi", nil)
+		return
+	}
+	if err != nil {
+		respondPembatalanError(c, err)
+		return
+	}
+
+	pdf, err := renderKwitansi(k)
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	filename := strings.ReplaceAll(k.Nomor, "/", "-") + ".pdf"
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// GET /api/pembayaran/:id/kwitansi.pdf: kwitansi untuk total yang sudah
+// dibayar pada tagihan.
+func getKwitansiPembayaran(c *gin.Context) {
+	kirimKwitansi(c, func(q querier) (*kwitansiData, error) {
+		return loadKwitansiPembayaran(q, c.Param("id"))
+	})
+}
+
+// GET /api/pembayaran/:id/riwayat/:riwayatId/kwitansi.pdf: kwitansi satu
+// cicilan.
+func getKwitansiRiwayat(c *gin.Context) {
+	kirimKwitansi(c, func(q querier) (*kwitansiData, error) {
+		return loadKwitansiRiwayat(q, c.Param("id"), c.Param("riwayatId"))
+	})
+}
+
+// POST /api/kwitansi/ttd mengganti gambar tanda tangan pemilik (field
+// "ttd", PNG atau JPG).
+func uploadTTD(c *gin.Context) {
+	file, err := c.FormFile("ttd")
+	if err != nil {
+		respondValidation(c, []FieldError{{Field: "ttd", Message: "File tidak ditemukan"}})
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext != ".png" && ext != ".jpg" && ext != ".jpeg" {
+		respondValidation(c, []FieldError{{Field: "ttd", Message: "ttd harus berupa PNG atau JPG"}})
+		return
+	}
+
+	if err := os.MkdirAll(ttdDir, os.ModePerm); err != nil {
+		respondInternal(c, err)
+		return
+	}
+	for _, lama := range []string{".png", ".jpg", ".jpeg"} {
+		os.Remove(filepath.Join(ttdDir, "pemilik"+lama))
+	}
+	if err := c.SaveUploadedFile(file, filepath.Join(ttdDir, "pemilik"+ext)); err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeUploadFailed, "Gagal menyimpan file", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tanda tangan berhasil disimpan"})
+}
@@ -1,10 +1,9 @@
 package main
 
 import (
-	"database/sql"
-	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
@@ -12,120 +11,72 @@ import (
 	"github.com/joho/godotenv"
 )
 
-var db *sql.DB
-
-func createRiwayatPembayaranTable() {
-	// Create riwayat_pembayaran table if it doesn't exist
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS riwayat_pembayaran (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		pembayaran_id INT NOT NULL,
-		jumlah_dibayar DECIMAL(12,2) NOT NULL,
-		tanggal_bayar DATETIME DEFAULT CURRENT_TIMESTAMP,
-		metode_bayar VARCHAR(50) DEFAULT 'Transfer',
-		kwitansi_path VARCHAR(255) NULL,
-		keterangan TEXT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		
-		-- Foreign key
-		FOREIGN KEY (pembayaran_id) REFERENCES pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE,
-		
-		-- Index untuk performa
-		INDEX idx_pembayaran_id (pembayaran_id),
-		INDEX idx_tanggal_bayar (tanggal_bayar)
-	);`
-	
-	_, err := db.Exec(createTableSQL)
-	if err != nil {
-		log.Printf("Error creating riwayat_pembayaran table: %v", err)
-	} else {
-		log.Printf("Table riwayat_pembayaran created or already exists")
-	}
-	
-	// Migrate existing data
-	migrateSQL := `
-	INSERT IGNORE INTO riwayat_pembayaran (pembayaran_id, jumlah_dibayar, tanggal_bayar, metode_bayar, kwitansi_path, keterangan)
-	SELECT 
-		id as pembayaran_id,
-		COALESCE(uang_dibayar, nominal) as jumlah_dibayar,
-		tanggal_bayar,
-		metode_bayar,
-		kwitansi_path,
-		'Pembayaran awal'
-	FROM pembayaran
-	WHERE id NOT IN (SELECT DISTINCT pembayaran_id FROM riwayat_pembayaran);`
-	
-	_, err = db.Exec(migrateSQL)
-	if err != nil {
-		log.Printf("Error migrating existing data: %v", err)
-	} else {
-		log.Printf("Existing payment data migrated to riwayat_pembayaran")
-	}
-}
-
 func main() {
 	// Load .env file hanya untuk development
 	godotenv.Load()
 
 	var err error
-	var dsn string
-	var dbDriver string
-	
-	// Cek apakah menggunakan DATABASE_URL (PostgreSQL di Render) atau MySQL lokal
-	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
-		// PostgreSQL (Render)
-		dsn = databaseURL
-		dbDriver = "postgres"
-		log.Printf("Using PostgreSQL (Render)")
-	} else {
-		// MySQL (Development) - gunakan environment variables terpisah
-		dbHost := os.Getenv("DB_HOST")
-		dbPort := os.Getenv("DB_PORT")
-		dbUser := os.Getenv("DB_USER")
-		dbPassword := os.Getenv("DB_PASSWORD")
-		dbName := os.Getenv("DB_NAME")
-		
-		if dbHost == "" {
-			dbHost = "localhost"
-		}
-		if dbPort == "" {
-			dbPort = "3306"
-		}
-		if dbUser == "" {
-			dbUser = "root"
-		}
-		if dbName == "" {
-			dbName = "kontrakanku"
-		}
-		
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", 
-			dbUser, dbPassword, dbHost, dbPort, dbName)
-		dbDriver = "mysql"
-		log.Printf("Using MySQL (Development)")
-	}
-	
-	log.Printf("Connecting to database...")
-	db, err = sql.Open(dbDriver, dsn)
+	db, err = connectDB()
 	if err != nil {
 		log.Fatal("Database connection failed:", err)
 	}
 	defer db.Close()
+	log.Printf("Database connected successfully!")
 
-	if err = db.Ping(); err != nil {
-		log.Fatal("Database ping failed:", err)
+	// Buat tabel yang belum ada
+	if err := runMigrations(); err != nil {
+		log.Fatal("Database migration failed:", err)
 	}
-	log.Printf("Database connected successfully!")
 
-	// Create riwayat_pembayaran table
-	createRiwayatPembayaranTable()
+	// Subcommand CLI (seed, dst.) dijalankan lalu keluar tanpa start server
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	r := gin.Default()
+	r := setupRouter()
+
+	if interval, ok := tagihanSchedulerInterval(); ok {
+		log.Printf("Scheduler tagihan aktif setiap %s", interval)
+		startTagihanScheduler(interval)
+	}
+
+	log.Printf("Routes registered:")
+	log.Printf("- POST /api/pembayaran -> createPembayaran")
+	log.Printf("- GET /api/pembayaran -> getPembayaran")
+	log.Printf("- PUT /api/pembayaran/:id -> updatePembayaran")
+	log.Printf("- PATCH /api/pembayaran/:id -> patchPembayaran")
+	log.Printf("- DELETE /api/pembayaran/:id -> deletePembayaran")
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	log.Printf("Server running on port %s", port)
+	r.Run(":" + port)
+}
+
+// setupRouter mendaftarkan middleware dan semua route API. Dipisah dari
+// main supaya bisa dipakai juga oleh integration test.
+func setupRouter() *gin.Engine {
+	r := gin.New()
+	// IP penanda tangan perjanjian diambil dari ClientIP, jadi
+	// X-Forwarded-For hanya dipercaya dari proxy di TRUSTED_PROXIES
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("TRUSTED_PROXIES tidak valid: %v", err)
+	}
+	r.Use(gin.Logger(), gin.CustomRecovery(recoveryHandler))
+	r.Use(requestIDMiddleware())
 	r.Use(corsMiddleware())
+	r.NoRoute(noRouteHandler)
 	
 	// Serve static files
 	r.Static("/uploads", "./uploads")
@@ -140,40 +91,130 @@ func main() {
 		
 		// Pembayaran routes - tambahkan middleware untuk operasi CRUD
 		api.GET("/pembayaran", getPembayaran)
+		api.GET("/pembayaran/verifikasi", getAntreanVerifikasi)
 		api.POST("/pembayaran", checkDemoUser(), createPembayaran)
 		api.PUT("/pembayaran/:id", checkDemoUser(), updatePembayaran)
+		api.PATCH("/pembayaran/:id", checkDemoUser(), patchPembayaran)
 		api.DELETE("/pembayaran/:id", checkDemoUser(), deletePembayaran)
 		api.POST("/pembayaran/upload", checkDemoUser(), uploadKwitansi)
 		api.GET("/pembayaran/:id/riwayat", getRiwayatPembayaran)
 		api.POST("/pembayaran/:id/riwayat", checkDemoUser(), addRiwayatPembayaran)
+		api.POST("/pembayaran/:id/riwayat/:riwayatId/batal", checkDemoUser(), batalkanRiwayatPembayaran)
+		api.POST("/pembayaran/:id/setujui", checkDemoUser(), setujuiPembayaran)
+		api.GET("/pembayaran/:id/kwitansi.pdf", checkAdminUser(), getKwitansiPembayaran)
+		api.GET("/pembayaran/:id/riwayat/:riwayatId/kwitansi.pdf", checkAdminUser(), getKwitansiRiwayat)
+		api.POST("/kwitansi/ttd", checkAdminUser(), uploadTTD)
+		api.POST("/pembayaran/:id/tolak", checkDemoUser(), tolakPembayaran)
 		api.POST("/create-riwayat-table", createRiwayatTable)
 		
 		// Penyewa routes - tambahkan middleware untuk operasi CRUD
 		api.GET("/penyewa", getPenyewa)
 		api.POST("/penyewa", checkDemoUser(), createPenyewa)
 		api.PUT("/penyewa/:id", checkDemoUser(), updatePenyewa)
+		api.PATCH("/penyewa/:id", checkDemoUser(), patchPenyewa)
 		api.DELETE("/penyewa/:id", checkDemoUser(), deletePenyewa)
+		api.GET("/penyewa/:id/history", getPenyewaHistory)
+		api.GET("/penyewa/:id/kredit", getKreditPenyewa)
+		api.POST("/penyewa/:id/kredit/refund", checkDemoUser(), refundKreditPenyewa)
 		
 		// Properti routes - tambahkan middleware untuk operasi CRUD
 		api.GET("/properti", getProperti)
 		api.POST("/properti", checkDemoUser(), createProperti)
 		api.PUT("/properti/:id", checkDemoUser(), updateProperti)
+		api.PATCH("/properti/:id", checkDemoUser(), patchProperti)
 		api.DELETE("/properti/:id", checkDemoUser(), deleteProperti)
-	}
+		api.GET("/properti/:id/history", getPropertiHistory)
 
-	log.Printf("Routes registered:")
-	log.Printf("- POST /api/pembayaran -> createPembayaran")
-	log.Printf("- GET /api/pembayaran -> getPembayaran")
-	log.Printf("- PUT /api/pembayaran/:id -> updatePembayaran")
-	log.Printf("- DELETE /api/pembayaran/:id -> deletePembayaran")
+		// Kontrak routes
+		api.GET("/kontrak", getKontrak)
+		api.GET("/kontrak/:id", getKontrakByID)
+		api.POST("/kontrak", checkDemoUser(), createKontrak)
+		api.PUT("/kontrak/:id", checkDemoUser(), updateKontrak)
+		api.PATCH("/kontrak/:id", checkDemoUser(), patchKontrak)
+		api.DELETE("/kontrak/:id", checkDemoUser(), deleteKontrak)
+		api.GET("/kontrak/:id/deposit", getDeposit)
+		api.POST("/kontrak/:id/deposit", checkDemoUser(), addDepositTransaksi)
+		api.POST("/kontrak/:id/deposit/settle", checkDemoUser(), settleDeposit)
+		api.POST("/kontrak/:id/pindah", checkDemoUser(), pindahKeluar)
+		api.GET("/kontrak/:id/perjanjian", getPerjanjianKontrak)
+		api.POST("/kontrak/:id/perjanjian", checkDemoUser(), buatPerjanjianKontrak)
+		api.GET("/kontrak/:id/perjanjian/:dokumenId/pdf", checkAdminUser(), unduhPerjanjian)
+		api.GET("/kontrak/:id/perjanjian/:dokumenId/ttd/:pihak", checkAdminUser(), unduhTTDPerjanjian)
+		api.POST("/kontrak/:id/perjanjian/:dokumenId/ttd", checkDemoUser(), tandaTanganiPerjanjian)
+		api.GET("/kontrak/:id/perjanjian/:dokumenId/verifikasi", verifikasiPerjanjian)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+		// Tagihan routes
+		api.GET("/tagihan", getTagihan)
+		api.POST("/tagihan/generate", checkDemoUser(), generateTagihanHandler)
+		api.GET("/tagihan/:id/item", getTagihanItem)
+		api.POST("/tagihan/:id/item", checkDemoUser(), addTagihanItem)
+		api.DELETE("/tagihan/:id/item/:itemId", checkDemoUser(), deleteTagihanItem)
+		api.GET("/tagihan/:id/invoice.pdf", getInvoiceTagihan)
+		api.GET("/invoice/template", getInvoiceTemplate)
+		api.PUT("/invoice/template", checkDemoUser(), updateInvoiceTemplate)
+
+		// Template surat perjanjian sewa, berversi
+		api.GET("/perjanjian/template", getTemplatePerjanjian)
+		api.GET("/perjanjian/template/:id", getTemplatePerjanjianByID)
+		api.POST("/perjanjian/template", checkDemoUser(), createTemplatePerjanjian)
+		api.GET("/perjanjian/placeholder", getPlaceholderPerjanjian)
+		api.POST("/perjanjian/verifikasi", verifikasiSalinanPerjanjian)
+
+		// Jenis biaya tambahan (kebersihan, keamanan, wifi, parkir, ...)
+		api.GET("/biaya", getJenisBiaya)
+		api.POST("/biaya", checkDemoUser(), createJenisBiaya)
+		api.PATCH("/biaya/:id", checkDemoUser(), patchJenisBiaya)
+		api.DELETE("/biaya/:id", checkDemoUser(), deleteJenisBiaya)
+
+		// Aturan diskon (bayar beberapa bulan, penyewa lama)
+		api.GET("/diskon", getAturanDiskon)
+		api.POST("/diskon", checkDemoUser(), createAturanDiskon)
+		api.PATCH("/diskon/:id", checkDemoUser(), patchAturanDiskon)
+		api.DELETE("/diskon/:id", checkDemoUser(), deleteAturanDiskon)
+
+		// Denda routes
+		api.GET("/denda", getDenda)
+		api.POST("/denda/hitung", checkDemoUser(), hitungDendaHandler)
+		api.POST("/denda/:id/hapuskan", checkDemoUser(), hapuskanDenda)
+		api.GET("/denda/aturan", getAturanDenda)
+		api.POST("/denda/aturan", checkDemoUser(), createAturanDenda)
+		api.PATCH("/denda/aturan/:id", checkDemoUser(), patchAturanDenda)
+		api.DELETE("/denda/aturan/:id", checkDemoUser(), deleteAturanDenda)
+
+		// Notifikasi penyewa (dikirim manual lalu ditandai terkirim)
+		api.GET("/notifikasi", getNotifikasi)
+		api.POST("/notifikasi/:id/terkirim", checkDemoUser(), tandaiNotifikasiTerkirim)
+
+		// Utilitas (listrik/air) routes
+		api.GET("/utilitas/tarif", getTarifUtilitas)
+		api.POST("/utilitas/tarif", checkDemoUser(), createTarifUtilitas)
+		api.PATCH("/utilitas/tarif/:id", checkDemoUser(), patchTarifUtilitas)
+		api.DELETE("/utilitas/tarif/:id", checkDemoUser(), deleteTarifUtilitas)
+		api.GET("/utilitas/meter", getMeterBacaan)
+		api.POST("/utilitas/meter", checkDemoUser(), createMeterBacaan)
+		api.DELETE("/utilitas/meter/:id", checkDemoUser(), deleteMeterBacaan)
+
+		// Import CSV/XLSX (dry_run=true untuk preview)
+		api.POST("/import/:entity", checkDemoUser(), importData)
+
+		// Export CSV/XLSX, menerima filter yang sama dengan endpoint list
+		api.GET("/export/:entity", exportData)
 	}
 
-	log.Printf("Server running on port %s", port)
-	r.Run(":" + port)
+	return r
+}
+
+// trustedProxies membaca TRUSTED_PROXIES (IP atau CIDR, dipisah koma).
+// Kosong berarti tidak ada proxy yang dipercaya dan IP klien diambil dari
+// koneksinya langsung.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
 }
 
 func corsMiddleware() gin.HandlerFunc {
@@ -200,8 +241,9 @@ func corsMiddleware() gin.HandlerFunc {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
 		}
 		
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-Role")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-Role, X-User-Name, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
@@ -0,0 +1,1267 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// migrations dijalankan berurutan setiap server start. Semua langkah harus
+// idempotent (CREATE TABLE IF NOT EXISTS, cek kolom sebelum ALTER, dst).
+var migrations = []struct {
+	name string
+	run  func() error
+}{
+	{"base tables", createBaseTables},
+	{"riwayat_pembayaran", createRiwayatPembayaranTable},
+	{"kontrak", createKontrakTable},
+	{"tagihan periode", addTagihanColumns},
+	{"jatuh tempo kontrak", addKontrakJatuhTempo},
+	{"denda", createDendaTables},
+	{"deposit", createDepositTable},
+	{"tanggal keluar kontrak", addKontrakTanggalKeluar},
+	{"riwayat hunian", createRiwayatHunianTable},
+	{"utilitas", createUtilitasTables},
+	{"jenis biaya", createJenisBiayaTable},
+	{"prorata dan diskon", createAturanDiskonTable},
+	{"status sebagian", rekonsiliasiStatusPembayaran},
+	{"saldo kredit", createKreditTable},
+	{"pembatalan cicilan", addPembatalanRiwayat},
+	{"verifikasi pembayaran", addVerifikasiPembayaran},
+	{"kwitansi", createKwitansiTable},
+	{"perjanjian sewa", createPerjanjianTables},
+	{"tanda tangan perjanjian", createTandaTanganTable},
+	{"denda di tagihan", addDendaTagihanItem},
+	{"nomor kwitansi", createKwitansiNomorTable},
+	{"dokumen pribadi", pindahkanDokumenPribadi},
+}
+
+// tableOrder adalah semua tabel aplikasi, diurutkan dari induk ke anak
+// sesuai foreign key. Hapus data dengan urutan terbalik.
+var tableOrder = []string{
+	"properti",
+	"penyewa",
+	"kontrak",
+	"pembayaran",
+	"riwayat_pembayaran",
+	"aturan_denda",
+	"denda",
+	"deposit_transaksi",
+	"riwayat_hunian",
+	"tarif_utilitas",
+	"meter_bacaan",
+	"jenis_biaya",
+	"aturan_diskon",
+	"tagihan_item",
+	"kredit_transaksi",
+	"notifikasi",
+	"kwitansi",
+	"kwitansi_nomor",
+	"template_perjanjian",
+	"dokumen_kontrak",
+	"tanda_tangan_dokumen",
+}
+
+func runMigrations() error {
+	for _, m := range migrations {
+		if err := m.run(); err != nil {
+			return fmt.Errorf("migration %s: %w", m.name, err)
+		}
+		log.Printf("Migration %s OK", m.name)
+	}
+	return nil
+}
+
+// execSchema menjalankan DDL sesuai dialect database yang aktif.
+func execSchema(mysqlStmts, postgresStmts []string) error {
+	stmts := mysqlStmts
+	if db.isPostgres() {
+		stmts = postgresStmts
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing menjalankan ALTER TABLE hanya jika kolom belum ada.
+// mysqlAlter dan postgresAlter adalah lanjutan "ALTER TABLE <table> ...".
+func addColumnIfMissing(table, column, mysqlAlter, postgresAlter string) error {
+	query := `SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`
+	alter := mysqlAlter
+	if db.isPostgres() {
+		query = `SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`
+		alter = postgresAlter
+	}
+
+	var count int
+	if err := db.QueryRow(query, table, column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := db.Exec("ALTER TABLE " + table + " " + alter)
+	return err
+}
+
+func createBaseTables() error {
+	return execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS properti (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			nama_unit VARCHAR(100) NOT NULL,
+			tipe VARCHAR(50) NOT NULL DEFAULT 'Studio',
+			harga_sewa DECIMAL(12,2) NOT NULL DEFAULT 0,
+			foto_path VARCHAR(255) NULL,
+			status VARCHAR(20) DEFAULT 'kosong',
+			deskripsi TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS penyewa (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			nama VARCHAR(100) NOT NULL,
+			nik VARCHAR(16) NULL,
+			email VARCHAR(100) NULL,
+			telepon VARCHAR(20) NOT NULL,
+			alamat TEXT NULL,
+			properti_id INT NULL,
+			mulai_kontrak DATE NULL,
+			jatuh_tempo DATE NULL,
+			status_bayar VARCHAR(20) DEFAULT 'belum_bayar',
+			ktp_path VARCHAR(255) NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (properti_id) REFERENCES properti(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+			INDEX idx_penyewa_nik (nik),
+			INDEX idx_penyewa_properti_id (properti_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS pembayaran (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			penyewa_id INT NOT NULL,
+			nominal DECIMAL(12,2) NOT NULL,
+			uang_dibayar DECIMAL(12,2) NULL,
+			tanggal_bayar DATE NOT NULL,
+			tanggal_mulai DATE NULL,
+			tanggal_akhir DATE NULL,
+			metode_bayar VARCHAR(50) DEFAULT 'Transfer',
+			kwitansi_path VARCHAR(255) NULL,
+			status VARCHAR(20) DEFAULT 'pending',
+			keterangan TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (penyewa_id) REFERENCES penyewa(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+			INDEX idx_pembayaran_penyewa_id (penyewa_id),
+			INDEX idx_pembayaran_status (status)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS properti (
+			id BIGSERIAL PRIMARY KEY,
+			nama_unit VARCHAR(100) NOT NULL,
+			tipe VARCHAR(50) NOT NULL DEFAULT 'Studio',
+			harga_sewa DECIMAL(12,2) NOT NULL DEFAULT 0,
+			foto_path VARCHAR(255) NULL,
+			status VARCHAR(20) DEFAULT 'kosong' CHECK (status IN ('kosong', 'terisi', 'maintenance')),
+			deskripsi TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE TABLE IF NOT EXISTS penyewa (
+			id BIGSERIAL PRIMARY KEY,
+			nama VARCHAR(100) NOT NULL,
+			nik VARCHAR(16) NULL,
+			email VARCHAR(100) NULL,
+			telepon VARCHAR(20) NOT NULL,
+			alamat TEXT NULL,
+			properti_id BIGINT NULL REFERENCES properti(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			mulai_kontrak DATE NULL,
+			jatuh_tempo DATE NULL,
+			status_bayar VARCHAR(20) DEFAULT 'belum_bayar' CHECK (status_bayar IN ('lunas', 'hutang', 'belum_bayar')),
+			ktp_path VARCHAR(255) NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE TABLE IF NOT EXISTS pembayaran (
+			id BIGSERIAL PRIMARY KEY,
+			penyewa_id BIGINT NOT NULL REFERENCES penyewa(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			nominal DECIMAL(12,2) NOT NULL,
+			uang_dibayar DECIMAL(12,2) NULL,
+			tanggal_bayar DATE NOT NULL,
+			tanggal_mulai DATE NULL,
+			tanggal_akhir DATE NULL,
+			metode_bayar VARCHAR(50) DEFAULT 'Transfer',
+			kwitansi_path VARCHAR(255) NULL,
+			status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('lunas', 'sebagian', 'pending', 'ditolak')),
+			keterangan TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_penyewa_nik ON penyewa(nik)`,
+		`CREATE INDEX IF NOT EXISTS idx_penyewa_properti_id ON penyewa(properti_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_pembayaran_penyewa_id ON pembayaran(penyewa_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_pembayaran_status ON pembayaran(status)`,
+	})
+}
+
+func createRiwayatPembayaranTable() error {
+	// Create riwayat_pembayaran table if it doesn't exist
+	err := execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS riwayat_pembayaran (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			pembayaran_id INT NOT NULL,
+			jumlah_dibayar DECIMAL(12,2) NOT NULL,
+			tanggal_bayar DATETIME DEFAULT CURRENT_TIMESTAMP,
+			metode_bayar VARCHAR(50) DEFAULT 'Transfer',
+			kwitansi_path VARCHAR(255) NULL,
+			keterangan TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+			-- Foreign key
+			FOREIGN KEY (pembayaran_id) REFERENCES pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+			-- Index untuk performa
+			INDEX idx_pembayaran_id (pembayaran_id),
+			INDEX idx_tanggal_bayar (tanggal_bayar)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS riwayat_pembayaran (
+			id BIGSERIAL PRIMARY KEY,
+			pembayaran_id BIGINT NOT NULL REFERENCES pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			jumlah_dibayar DECIMAL(12,2) NOT NULL,
+			tanggal_bayar TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			metode_bayar VARCHAR(50) DEFAULT 'Transfer',
+			kwitansi_path VARCHAR(255) NULL,
+			keterangan TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_riwayat_pembayaran_id ON riwayat_pembayaran(pembayaran_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_riwayat_tanggal_bayar ON riwayat_pembayaran(tanggal_bayar)`,
+	})
+	if err != nil {
+		return err
+	}
+	// lebih_bayar adalah bagian cicilan yang dipindah ke saldo kredit;
+	// yang dihitung untuk tagihan adalah jumlah_dibayar - lebih_bayar.
+	// Ditambahkan di sini karena migrasi berikutnya sudah menjumlah cicilan.
+	err = addColumnIfMissing("riwayat_pembayaran", "lebih_bayar",
+		"ADD COLUMN lebih_bayar DECIMAL(12,2) NOT NULL DEFAULT 0",
+		"ADD COLUMN lebih_bayar DECIMAL(12,2) NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+
+	// Migrate existing data: pembayaran lama yang belum punya riwayat
+	// dicatat sebagai satu cicilan awal.
+	_, err = db.Exec(`
+		INSERT INTO riwayat_pembayaran (pembayaran_id, jumlah_dibayar, tanggal_bayar, metode_bayar, kwitansi_path, keterangan)
+		SELECT
+			p.id,
+			COALESCE(p.uang_dibayar, p.nominal),
+			p.tanggal_bayar,
+			p.metode_bayar,
+			p.kwitansi_path,
+			'Pembayaran awal'
+		FROM pembayaran p
+		WHERE COALESCE(p.uang_dibayar, p.nominal) > 0
+		AND NOT EXISTS (SELECT 1 FROM riwayat_pembayaran r WHERE r.pembayaran_id = p.id)`)
+	return err
+}
+
+func createKontrakTable() error {
+	err := execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS kontrak (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			penyewa_id INT NOT NULL,
+			properti_id INT NULL,
+			tanggal_mulai DATE NOT NULL,
+			tanggal_akhir DATE NULL,
+			periode_tagihan VARCHAR(20) NOT NULL DEFAULT 'bulanan',
+			harga_sewa DECIMAL(12,2) NOT NULL DEFAULT 0,
+			deposit DECIMAL(12,2) NOT NULL DEFAULT 0,
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif',
+			keterangan TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (penyewa_id) REFERENCES penyewa(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			FOREIGN KEY (properti_id) REFERENCES properti(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+			INDEX idx_kontrak_penyewa_id (penyewa_id),
+			INDEX idx_kontrak_properti_id (properti_id),
+			INDEX idx_kontrak_status (status)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS kontrak (
+			id BIGSERIAL PRIMARY KEY,
+			penyewa_id BIGINT NOT NULL REFERENCES penyewa(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			properti_id BIGINT NULL REFERENCES properti(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			tanggal_mulai DATE NOT NULL,
+			tanggal_akhir DATE NULL,
+			periode_tagihan VARCHAR(20) NOT NULL DEFAULT 'bulanan' CHECK (periode_tagihan IN ('bulanan', 'triwulan', 'semester', 'tahunan')),
+			harga_sewa DECIMAL(12,2) NOT NULL DEFAULT 0,
+			deposit DECIMAL(12,2) NOT NULL DEFAULT 0,
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif' CHECK (status IN ('aktif', 'berakhir', 'diputus')),
+			keterangan TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_kontrak_penyewa_id ON kontrak(penyewa_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_kontrak_properti_id ON kontrak(properti_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_kontrak_status ON kontrak(status)`,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Tagihan dan cicilan ikut terhapus bersama kontraknya; handler
+	// deleteKontrak menolak kontrak yang masih punya tagihan.
+	for _, table := range []string{"pembayaran", "riwayat_pembayaran"} {
+		err := addColumnIfMissing(table, "kontrak_id",
+			fmt.Sprintf(`ADD COLUMN kontrak_id INT NULL,
+				ADD CONSTRAINT fk_%s_kontrak FOREIGN KEY (kontrak_id) REFERENCES kontrak(id) ON DELETE CASCADE ON UPDATE CASCADE,
+				ADD INDEX idx_%s_kontrak_id (kontrak_id)`, table, table),
+			"ADD COLUMN kontrak_id BIGINT NULL REFERENCES kontrak(id) ON DELETE CASCADE ON UPDATE CASCADE",
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if db.isPostgres() {
+		if err := execSchema(nil, []string{
+			`CREATE INDEX IF NOT EXISTS idx_pembayaran_kontrak_id ON pembayaran(kontrak_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_riwayat_pembayaran_kontrak_id ON riwayat_pembayaran(kontrak_id)`,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return backfillKontrak()
+}
+
+// backfillKontrak membuat satu kontrak untuk setiap penyewa yang masih
+// punya pembayaran lama tanpa kontrak_id. Periode kontrak diambil dari
+// tanggal mulai paling awal sampai tanggal akhir paling akhir.
+func backfillKontrak() error {
+	rows, err := db.Query(`
+		SELECT p.penyewa_id, py.properti_id,
+		       MIN(COALESCE(p.tanggal_mulai, p.tanggal_bayar)), MAX(p.tanggal_akhir),
+		       MAX(p.nominal), COALESCE(MAX(pr.harga_sewa), 0)
+		FROM pembayaran p
+		JOIN penyewa py ON py.id = p.penyewa_id
+		LEFT JOIN properti pr ON pr.id = py.properti_id
+		WHERE p.kontrak_id IS NULL
+		GROUP BY p.penyewa_id, py.properti_id`)
+	if err != nil {
+		return err
+	}
+
+	type legacyKontrak struct {
+		penyewaID    int64
+		propertiID   sql.NullInt64
+		mulai, akhir sql.NullTime
+		nominal      float64
+		hargaUnit    float64
+	}
+	var legacy []legacyKontrak
+	for rows.Next() {
+		var k legacyKontrak
+		if err := rows.Scan(&k.penyewaID, &k.propertiID, &k.mulai, &k.akhir, &k.nominal, &k.hargaUnit); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	today := time.Now().Format("2006-01-02")
+	for _, k := range legacy {
+		status := "aktif"
+		var akhir interface{}
+		if k.akhir.Valid {
+			tanggal := k.akhir.Time.Format("2006-01-02")
+			akhir = tanggal
+			if tanggal < today {
+				status = "berakhir"
+			}
+		}
+		harga := k.hargaUnit
+		if harga == 0 {
+			harga = k.nominal
+		}
+
+		var propertiID interface{}
+		if k.propertiID.Valid {
+			propertiID = k.propertiID.Int64
+		}
+
+		kontrakID, err := tx.InsertID(`
+			INSERT INTO kontrak (penyewa_id, properti_id, tanggal_mulai, tanggal_akhir, periode_tagihan, harga_sewa, status, keterangan)
+			VALUES (?, ?, ?, ?, 'bulanan', ?, ?, 'Dibuat otomatis dari data pembayaran lama')`,
+			k.penyewaID, propertiID, k.mulai.Time.Format("2006-01-02"), akhir, harga, status,
+		)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE pembayaran SET kontrak_id=? WHERE penyewa_id=? AND kontrak_id IS NULL", kontrakID, k.penyewaID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE riwayat_pembayaran SET kontrak_id = (
+			SELECT p.kontrak_id FROM pembayaran p WHERE p.id = riwayat_pembayaran.pembayaran_id
+		) WHERE kontrak_id IS NULL`)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Backfill kontrak: %d kontrak dibuat dari pembayaran lama", len(legacy))
+	return tx.Commit()
+}
+
+// addTagihanColumns menambah periode_mulai dan jatuh_tempo ke pembayaran.
+// UNIQUE (kontrak_id, periode_mulai) menjamin generator tagihan tidak
+// pernah membuat tagihan ganda; tagihan manual punya periode_mulai NULL.
+func addTagihanColumns() error {
+	err := addColumnIfMissing("pembayaran", "periode_mulai",
+		"ADD COLUMN periode_mulai DATE NULL, ADD UNIQUE KEY uq_pembayaran_kontrak_periode (kontrak_id, periode_mulai)",
+		"ADD COLUMN periode_mulai DATE NULL",
+	)
+	if err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("pembayaran", "jatuh_tempo", "ADD COLUMN jatuh_tempo DATE NULL", "ADD COLUMN jatuh_tempo DATE NULL"); err != nil {
+		return err
+	}
+	if err := execSchema(nil, []string{
+		`CREATE UNIQUE INDEX IF NOT EXISTS uq_pembayaran_kontrak_periode ON pembayaran(kontrak_id, periode_mulai)`,
+	}); err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE pembayaran SET jatuh_tempo = COALESCE(tanggal_mulai, tanggal_bayar) WHERE jatuh_tempo IS NULL")
+	return err
+}
+
+// addKontrakJatuhTempo menyimpan jatuh tempo per kontrak dan menghitung
+// ulang kontrak aktif yang belum punya nilai. Kontrak yang sudah lunas
+// sampai akhir tetap NULL dan ikut dihitung ulang setiap start.
+func addKontrakJatuhTempo() error {
+	if err := addColumnIfMissing("kontrak", "jatuh_tempo", "ADD COLUMN jatuh_tempo DATE NULL", "ADD COLUMN jatuh_tempo DATE NULL"); err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT id FROM kontrak WHERE status = 'aktif' AND jatuh_tempo IS NULL")
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := recalcJatuhTempo(db, id); err != nil {
+			return fmt.Errorf("kontrak %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// createDendaTables membuat aturan denda (global jika properti_id NULL) dan
+// satu baris denda per tagihan terlambat yang nominalnya bertambah setiap
+// kali scheduler berjalan sampai tagihan lunas atau dihapuskan.
+func createDendaTables() error {
+	return execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS aturan_denda (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			properti_id INT NULL,
+			jenis VARCHAR(10) NOT NULL DEFAULT 'flat',
+			nilai DECIMAL(12,2) NOT NULL,
+			masa_tenggang INT NOT NULL DEFAULT 0,
+			akrual VARCHAR(10) NOT NULL DEFAULT 'harian',
+			maksimal DECIMAL(12,2) NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif',
+			keterangan TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (properti_id) REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+			INDEX idx_aturan_denda_properti_id (properti_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS denda (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			pembayaran_id INT NOT NULL,
+			kontrak_id INT NULL,
+			aturan_id INT NULL,
+			nominal DECIMAL(12,2) NOT NULL DEFAULT 0,
+			hari_terlambat INT NOT NULL DEFAULT 0,
+			dihitung_sampai DATE NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif',
+			alasan_penghapusan TEXT NULL,
+			dihapuskan_oleh VARCHAR(100) NULL,
+			dihapuskan_pada TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (pembayaran_id) REFERENCES pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			FOREIGN KEY (kontrak_id) REFERENCES kontrak(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			FOREIGN KEY (aturan_id) REFERENCES aturan_denda(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+			UNIQUE KEY uq_denda_pembayaran (pembayaran_id),
+			INDEX idx_denda_kontrak_id (kontrak_id),
+			INDEX idx_denda_status (status)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS aturan_denda (
+			id BIGSERIAL PRIMARY KEY,
+			properti_id BIGINT NULL REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			jenis VARCHAR(10) NOT NULL DEFAULT 'flat' CHECK (jenis IN ('flat', 'persen')),
+			nilai DECIMAL(12,2) NOT NULL,
+			masa_tenggang INT NOT NULL DEFAULT 0,
+			akrual VARCHAR(10) NOT NULL DEFAULT 'harian' CHECK (akrual IN ('harian', 'bulanan')),
+			maksimal DECIMAL(12,2) NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif' CHECK (status IN ('aktif', 'nonaktif')),
+			keterangan TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_aturan_denda_properti_id ON aturan_denda(properti_id)`,
+		`CREATE TABLE IF NOT EXISTS denda (
+			id BIGSERIAL PRIMARY KEY,
+			pembayaran_id BIGINT NOT NULL UNIQUE REFERENCES pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			kontrak_id BIGINT NULL REFERENCES kontrak(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			aturan_id BIGINT NULL REFERENCES aturan_denda(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			nominal DECIMAL(12,2) NOT NULL DEFAULT 0,
+			hari_terlambat INT NOT NULL DEFAULT 0,
+			dihitung_sampai DATE NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif' CHECK (status IN ('aktif', 'dihapuskan')),
+			alasan_penghapusan TEXT NULL,
+			dihapuskan_oleh VARCHAR(100) NULL,
+			dihapuskan_pada TIMESTAMP WITH TIME ZONE NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_denda_kontrak_id ON denda(kontrak_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_denda_status ON denda(status)`,
+	})
+}
+
+// createDepositTable mencatat uang jaminan per kontrak sebagai buku kas:
+// terima (setoran), potong (kerusakan/tunggakan) dan refund. Saldo adalah
+// terima - potong - refund. kontrak.deposit_selesai terisi setelah
+// settlement sehingga deposit tidak bisa diubah lagi.
+func createDepositTable() error {
+	err := execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS deposit_transaksi (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			kontrak_id INT NOT NULL,
+			jenis VARCHAR(10) NOT NULL,
+			kategori VARCHAR(20) NULL,
+			nominal DECIMAL(12,2) NOT NULL,
+			tanggal DATE NOT NULL,
+			metode_bayar VARCHAR(50) NULL,
+			pembayaran_id INT NULL,
+			keterangan TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (kontrak_id) REFERENCES kontrak(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			FOREIGN KEY (pembayaran_id) REFERENCES pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+			INDEX idx_deposit_transaksi_kontrak_id (kontrak_id)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS deposit_transaksi (
+			id BIGSERIAL PRIMARY KEY,
+			kontrak_id BIGINT NOT NULL REFERENCES kontrak(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			jenis VARCHAR(10) NOT NULL CHECK (jenis IN ('terima', 'potong', 'refund')),
+			kategori VARCHAR(20) NULL CHECK (kategori IN ('kerusakan', 'tunggakan', 'lainnya')),
+			nominal DECIMAL(12,2) NOT NULL CHECK (nominal > 0),
+			tanggal DATE NOT NULL,
+			metode_bayar VARCHAR(50) NULL,
+			pembayaran_id BIGINT NULL REFERENCES pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			keterangan TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_deposit_transaksi_kontrak_id ON deposit_transaksi(kontrak_id)`,
+	})
+	if err != nil {
+		return err
+	}
+	return addColumnIfMissing("kontrak", "deposit_selesai", "ADD COLUMN deposit_selesai DATE NULL", "ADD COLUMN deposit_selesai DATE NULL")
+}
+
+// addKontrakTanggalKeluar mencatat tanggal penyewa benar-benar keluar,
+// yang bisa berbeda dari tanggal_akhir kontrak.
+func addKontrakTanggalKeluar() error {
+	return addColumnIfMissing("kontrak", "tanggal_keluar", "ADD COLUMN tanggal_keluar DATE NULL", "ADD COLUMN tanggal_keluar DATE NULL")
+}
+
+// createRiwayatHunianTable menyimpan siapa menempati unit mana dan kapan.
+// nama_penyewa disalin supaya riwayat tetap terbaca setelah penyewa
+// dihapus (penyewa_id dan kontrak_id menjadi NULL).
+func createRiwayatHunianTable() error {
+	err := execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS riwayat_hunian (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			properti_id INT NOT NULL,
+			penyewa_id INT NULL,
+			kontrak_id INT NULL,
+			nama_penyewa VARCHAR(100) NOT NULL,
+			tanggal_masuk DATE NOT NULL,
+			tanggal_keluar DATE NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (properti_id) REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			FOREIGN KEY (penyewa_id) REFERENCES penyewa(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			FOREIGN KEY (kontrak_id) REFERENCES kontrak(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+			INDEX idx_riwayat_hunian_properti_id (properti_id, tanggal_masuk),
+			INDEX idx_riwayat_hunian_penyewa_id (penyewa_id),
+			INDEX idx_riwayat_hunian_kontrak_id (kontrak_id)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS riwayat_hunian (
+			id BIGSERIAL PRIMARY KEY,
+			properti_id BIGINT NOT NULL REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			penyewa_id BIGINT NULL REFERENCES penyewa(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			kontrak_id BIGINT NULL REFERENCES kontrak(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			nama_penyewa VARCHAR(100) NOT NULL,
+			tanggal_masuk DATE NOT NULL,
+			tanggal_keluar DATE NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_riwayat_hunian_properti_id ON riwayat_hunian(properti_id, tanggal_masuk)`,
+		`CREATE INDEX IF NOT EXISTS idx_riwayat_hunian_penyewa_id ON riwayat_hunian(penyewa_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_riwayat_hunian_kontrak_id ON riwayat_hunian(kontrak_id)`,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Backfill dari kontrak yang belum tercatat. Kontrak yang sudah selesai
+	// tanpa tanggal_keluar dianggap keluar di tanggal_akhir.
+	_, err = db.Exec(`
+		INSERT INTO riwayat_hunian (properti_id, penyewa_id, kontrak_id, nama_penyewa, tanggal_masuk, tanggal_keluar)
+		SELECT k.properti_id, k.penyewa_id, k.id, py.nama, k.tanggal_mulai,
+		       CASE WHEN k.status = 'aktif' THEN NULL ELSE COALESCE(k.tanggal_keluar, k.tanggal_akhir, k.tanggal_mulai) END
+		FROM kontrak k
+		JOIN penyewa py ON py.id = k.penyewa_id
+		WHERE k.properti_id IS NOT NULL
+		  AND NOT EXISTS (SELECT 1 FROM riwayat_hunian h WHERE h.kontrak_id = k.id)`)
+	return err
+}
+
+// createUtilitasTables membuat tarif listrik/air (global jika properti_id
+// NULL), catatan bacaan meter per unit, dan rincian tagihan (tagihan_item)
+// tempat biaya utilitas ditambahkan ke tagihan bulanan.
+func createUtilitasTables() error {
+	return execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS tarif_utilitas (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			properti_id INT NULL,
+			jenis VARCHAR(10) NOT NULL,
+			tarif DECIMAL(12,2) NOT NULL,
+			abonemen DECIMAL(12,2) NOT NULL DEFAULT 0,
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif',
+			keterangan TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (properti_id) REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+			INDEX idx_tarif_utilitas_properti_id (properti_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS meter_bacaan (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			properti_id INT NOT NULL,
+			jenis VARCHAR(10) NOT NULL,
+			tanggal DATE NOT NULL,
+			angka DECIMAL(12,2) NOT NULL,
+			pemakaian DECIMAL(12,2) NULL,
+			anomali VARCHAR(20) NULL,
+			foto_path VARCHAR(255) NULL,
+			pembayaran_id INT NULL,
+			keterangan TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (properti_id) REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			FOREIGN KEY (pembayaran_id) REFERENCES pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+			UNIQUE KEY uq_meter_bacaan (properti_id, jenis, tanggal),
+			INDEX idx_meter_bacaan_pembayaran_id (pembayaran_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS tagihan_item (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			pembayaran_id INT NOT NULL,
+			jenis VARCHAR(20) NOT NULL,
+			deskripsi VARCHAR(255) NOT NULL,
+			jumlah DECIMAL(12,2) NOT NULL DEFAULT 1,
+			harga_satuan DECIMAL(12,2) NOT NULL DEFAULT 0,
+			nominal DECIMAL(12,2) NOT NULL,
+			meter_bacaan_id INT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (pembayaran_id) REFERENCES pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			FOREIGN KEY (meter_bacaan_id) REFERENCES meter_bacaan(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+			INDEX idx_tagihan_item_pembayaran_id (pembayaran_id)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS tarif_utilitas (
+			id BIGSERIAL PRIMARY KEY,
+			properti_id BIGINT NULL REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			jenis VARCHAR(10) NOT NULL CHECK (jenis IN ('listrik', 'air')),
+			tarif DECIMAL(12,2) NOT NULL,
+			abonemen DECIMAL(12,2) NOT NULL DEFAULT 0,
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif' CHECK (status IN ('aktif', 'nonaktif')),
+			keterangan TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_tarif_utilitas_properti_id ON tarif_utilitas(properti_id)`,
+		`CREATE TABLE IF NOT EXISTS meter_bacaan (
+			id BIGSERIAL PRIMARY KEY,
+			properti_id BIGINT NOT NULL REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			jenis VARCHAR(10) NOT NULL CHECK (jenis IN ('listrik', 'air')),
+			tanggal DATE NOT NULL,
+			angka DECIMAL(12,2) NOT NULL,
+			pemakaian DECIMAL(12,2) NULL,
+			anomali VARCHAR(20) NULL,
+			foto_path VARCHAR(255) NULL,
+			pembayaran_id BIGINT NULL REFERENCES pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			keterangan TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			UNIQUE (properti_id, jenis, tanggal)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_meter_bacaan_pembayaran_id ON meter_bacaan(pembayaran_id)`,
+		`CREATE TABLE IF NOT EXISTS tagihan_item (
+			id BIGSERIAL PRIMARY KEY,
+			pembayaran_id BIGINT NOT NULL REFERENCES pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			jenis VARCHAR(20) NOT NULL,
+			deskripsi VARCHAR(255) NOT NULL,
+			jumlah DECIMAL(12,2) NOT NULL DEFAULT 1,
+			harga_satuan DECIMAL(12,2) NOT NULL DEFAULT 0,
+			nominal DECIMAL(12,2) NOT NULL,
+			meter_bacaan_id BIGINT NULL REFERENCES meter_bacaan(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_tagihan_item_pembayaran_id ON tagihan_item(pembayaran_id)`,
+	})
+}
+
+// createJenisBiayaTable membuat jenis biaya tambahan (kebersihan, keamanan,
+// wifi, parkir, ...) yang berlaku untuk semua unit atau satu unit, lalu
+// menautkannya ke tagihan_item. Tagihan lama yang belum punya rincian diberi
+// satu rincian sewa sebesar nominalnya supaya total selalu = jumlah rincian.
+func createJenisBiayaTable() error {
+	err := execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS jenis_biaya (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			nama VARCHAR(100) NOT NULL,
+			properti_id INT NULL,
+			nominal DECIMAL(12,2) NOT NULL,
+			pengulangan VARCHAR(10) NOT NULL DEFAULT 'bulanan',
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif',
+			keterangan TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (properti_id) REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+			INDEX idx_jenis_biaya_properti_id (properti_id)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS jenis_biaya (
+			id BIGSERIAL PRIMARY KEY,
+			nama VARCHAR(100) NOT NULL,
+			properti_id BIGINT NULL REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			nominal DECIMAL(12,2) NOT NULL,
+			pengulangan VARCHAR(10) NOT NULL DEFAULT 'bulanan' CHECK (pengulangan IN ('bulanan', 'sekali')),
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif' CHECK (status IN ('aktif', 'nonaktif')),
+			keterangan TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_jenis_biaya_properti_id ON jenis_biaya(properti_id)`,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = addColumnIfMissing("tagihan_item", "jenis_biaya_id",
+		"ADD COLUMN jenis_biaya_id INT NULL, ADD FOREIGN KEY (jenis_biaya_id) REFERENCES jenis_biaya(id) ON DELETE SET NULL ON UPDATE CASCADE",
+		"ADD COLUMN jenis_biaya_id BIGINT NULL REFERENCES jenis_biaya(id) ON DELETE SET NULL ON UPDATE CASCADE")
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO tagihan_item (pembayaran_id, jenis, deskripsi, jumlah, harga_satuan, nominal)
+		SELECT p.id, 'sewa', 'Sewa', 1, p.nominal, p.nominal
+		FROM pembayaran p
+		WHERE NOT EXISTS (SELECT 1 FROM tagihan_item i WHERE i.pembayaran_id = p.id)`)
+	return err
+}
+
+// createAturanDiskonTable menambah hari_tagihan kontrak (tanggal tagih
+// tetap, periode pertama diprorata) dan aturan diskon yang diterapkan
+// sebagai rincian tagihan bernilai negatif. min_bulan untuk diskon bayar
+// beberapa bulan sekaligus, min_lama_bulan untuk diskon penyewa lama.
+func createAturanDiskonTable() error {
+	err := addColumnIfMissing("kontrak", "hari_tagihan", "ADD COLUMN hari_tagihan INT NULL", "ADD COLUMN hari_tagihan INT NULL")
+	if err != nil {
+		return err
+	}
+
+	err = execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS aturan_diskon (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			nama VARCHAR(100) NOT NULL,
+			properti_id INT NULL,
+			jenis VARCHAR(10) NOT NULL,
+			nilai DECIMAL(12,2) NOT NULL,
+			min_bulan INT NOT NULL DEFAULT 0,
+			min_lama_bulan INT NOT NULL DEFAULT 0,
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif',
+			keterangan TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (properti_id) REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+			INDEX idx_aturan_diskon_properti_id (properti_id)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS aturan_diskon (
+			id BIGSERIAL PRIMARY KEY,
+			nama VARCHAR(100) NOT NULL,
+			properti_id BIGINT NULL REFERENCES properti(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			jenis VARCHAR(10) NOT NULL CHECK (jenis IN ('persen', 'flat')),
+			nilai DECIMAL(12,2) NOT NULL,
+			min_bulan INT NOT NULL DEFAULT 0,
+			min_lama_bulan INT NOT NULL DEFAULT 0,
+			status VARCHAR(20) NOT NULL DEFAULT 'aktif' CHECK (status IN ('aktif', 'nonaktif')),
+			keterangan TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_aturan_diskon_properti_id ON aturan_diskon(properti_id)`,
+	})
+	if err != nil {
+		return err
+	}
+
+	return addColumnIfMissing("tagihan_item", "aturan_diskon_id",
+		"ADD COLUMN aturan_diskon_id INT NULL, ADD FOREIGN KEY (aturan_diskon_id) REFERENCES aturan_diskon(id) ON DELETE SET NULL ON UPDATE CASCADE",
+		"ADD COLUMN aturan_diskon_id BIGINT NULL REFERENCES aturan_diskon(id) ON DELETE SET NULL ON UPDATE CASCADE")
+}
+
+// rekonsiliasiStatusPembayaran mengizinkan status 'sebagian' lalu
+// memeriksa tagihan yang uang_dibayar atau statusnya tidak cocok dengan
+// riwayat cicilan. Startup hanya mencatatnya di log; perbaikannya lewat
+// perintah reconcile supaya tidak ada data yang diubah diam-diam.
+func rekonsiliasiStatusPembayaran() error {
+	err := execSchema(nil, []string{
+		`ALTER TABLE pembayaran DROP CONSTRAINT IF EXISTS pembayaran_status_check`,
+		`ALTER TABLE pembayaran ADD CONSTRAINT pembayaran_status_check CHECK (status IN ('lunas', 'sebagian', 'pending', 'ditolak'))`,
+	})
+	if err != nil {
+		return err
+	}
+
+	report, err := rekonsiliasiPembayaran(true)
+	if err != nil {
+		return err
+	}
+	if report.Diperbaiki > 0 {
+		log.Printf("Rekonsiliasi: %d tagihan tidak cocok dengan riwayat cicilan, jalankan `go run . reconcile -dry-run` untuk melihat dan `go run . reconcile` untuk memperbaikinya", report.Diperbaiki)
+	}
+	return nil
+}
+
+// createKreditTable menyimpan buku saldo kredit penyewa. Baris yang berasal
+// dari cicilan (lebih bayar atau pemakaian) ikut terhapus bersama cicilannya.
+func createKreditTable() error {
+	return execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS kredit_transaksi (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			penyewa_id INT NOT NULL,
+			jenis VARCHAR(10) NOT NULL,
+			nominal DECIMAL(12,2) NOT NULL,
+			tanggal DATE NOT NULL,
+			metode_bayar VARCHAR(50) NULL,
+			pembayaran_id INT NULL,
+			riwayat_id INT NULL,
+			keterangan TEXT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (penyewa_id) REFERENCES penyewa(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			FOREIGN KEY (pembayaran_id) REFERENCES pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			FOREIGN KEY (riwayat_id) REFERENCES riwayat_pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE,
+
+			INDEX idx_kredit_transaksi_penyewa_id (penyewa_id)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS kredit_transaksi (
+			id BIGSERIAL PRIMARY KEY,
+			penyewa_id BIGINT NOT NULL REFERENCES penyewa(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			jenis VARCHAR(10) NOT NULL CHECK (jenis IN ('masuk', 'pakai', 'refund')),
+			nominal DECIMAL(12,2) NOT NULL CHECK (nominal > 0),
+			tanggal DATE NOT NULL,
+			metode_bayar VARCHAR(50) NULL,
+			pembayaran_id BIGINT NULL REFERENCES pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			riwayat_id BIGINT NULL REFERENCES riwayat_pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			keterangan TEXT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_kredit_transaksi_penyewa_id ON kredit_transaksi(penyewa_id)`,
+	})
+}
+
+// addPembatalanRiwayat: cicilan dibatalkan dengan baris pembalik bernilai
+// negatif (membatalkan_id menunjuk cicilan asal, paling banyak satu per
+// cicilan) yang mencatat alasan dan pelakunya. Kredit lebih bayar yang ikut
+// dibatalkan dicatat dengan jenis 'batal'.
+func addPembatalanRiwayat() error {
+	err := addColumnIfMissing("riwayat_pembayaran", "membatalkan_id",
+		"ADD COLUMN membatalkan_id INT NULL UNIQUE, ADD FOREIGN KEY (membatalkan_id) REFERENCES riwayat_pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE",
+		"ADD COLUMN membatalkan_id BIGINT NULL UNIQUE REFERENCES riwayat_pembayaran(id) ON DELETE CASCADE ON UPDATE CASCADE")
+	if err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("riwayat_pembayaran", "alasan", "ADD COLUMN alasan TEXT NULL", "ADD COLUMN alasan TEXT NULL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("riwayat_pembayaran", "oleh", "ADD COLUMN oleh VARCHAR(100) NULL", "ADD COLUMN oleh VARCHAR(100) NULL"); err != nil {
+		return err
+	}
+
+	return execSchema(nil, []string{
+		`ALTER TABLE kredit_transaksi DROP CONSTRAINT IF EXISTS kredit_transaksi_jenis_check`,
+		`ALTER TABLE kredit_transaksi ADD CONSTRAINT kredit_transaksi_jenis_check CHECK (jenis IN ('masuk', 'pakai', 'refund', 'batal'))`,
+	})
+}
+
+// addVerifikasiPembayaran mencatat siapa dan kapan tagihan disetujui atau
+// ditolak beserta alasannya, kapan setiap cicilan diverifikasi, dan membuat
+// antrean notifikasi untuk penyewa.
+func addVerifikasiPembayaran() error {
+	if err := addColumnIfMissing("pembayaran", "diverifikasi_oleh",
+		"ADD COLUMN diverifikasi_oleh VARCHAR(100) NULL", "ADD COLUMN diverifikasi_oleh VARCHAR(100) NULL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("pembayaran", "diverifikasi_pada",
+		"ADD COLUMN diverifikasi_pada TIMESTAMP NULL", "ADD COLUMN diverifikasi_pada TIMESTAMP WITH TIME ZONE NULL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("pembayaran", "alasan_penolakan",
+		"ADD COLUMN alasan_penolakan TEXT NULL", "ADD COLUMN alasan_penolakan TEXT NULL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing("riwayat_pembayaran", "diverifikasi_pada",
+		"ADD COLUMN diverifikasi_pada TIMESTAMP NULL", "ADD COLUMN diverifikasi_pada TIMESTAMP WITH TIME ZONE NULL"); err != nil {
+		return err
+	}
+
+	return execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS notifikasi (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			penyewa_id INT NOT NULL,
+			pembayaran_id INT NULL,
+			jenis VARCHAR(50) NOT NULL,
+			pesan TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'menunggu',
+			dikirim_pada TIMESTAMP NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (penyewa_id) REFERENCES penyewa(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			FOREIGN KEY (pembayaran_id) REFERENCES pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+			INDEX idx_notifikasi_penyewa_id (penyewa_id),
+			INDEX idx_notifikasi_status (status)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS notifikasi (
+			id BIGSERIAL PRIMARY KEY,
+			penyewa_id BIGINT NOT NULL REFERENCES penyewa(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			pembayaran_id BIGINT NULL REFERENCES pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			jenis VARCHAR(50) NOT NULL,
+			pesan TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'menunggu' CHECK (status IN ('menunggu', 'terkirim')),
+			dikirim_pada TIMESTAMP WITH TIME ZONE NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_notifikasi_penyewa_id ON notifikasi(penyewa_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_notifikasi_status ON notifikasi(status)`,
+	})
+}
+
+// createKwitansiTable mencatat nomor kwitansi PDF yang sudah diterbitkan.
+// Nomor urut per tahun; kwitansi yang sama dicetak ulang dengan nomor lama.
+// Baris tidak ikut terhapus bersama tagihan atau cicilannya supaya nomor
+// tidak pernah dipakai ulang.
+func createKwitansiTable() error {
+	return execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS kwitansi (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			nomor VARCHAR(30) NOT NULL UNIQUE,
+			tahun INT NOT NULL,
+			urutan INT NOT NULL,
+			tanggal DATE NOT NULL,
+			jenis VARCHAR(10) NOT NULL,
+			pembayaran_id INT NULL,
+			riwayat_id INT NULL UNIQUE,
+			nominal DECIMAL(12,2) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+			UNIQUE KEY uq_kwitansi_urutan (tahun, urutan),
+			FOREIGN KEY (pembayaran_id) REFERENCES pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			FOREIGN KEY (riwayat_id) REFERENCES riwayat_pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+
+			INDEX idx_kwitansi_pembayaran_id (pembayaran_id)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS kwitansi (
+			id BIGSERIAL PRIMARY KEY,
+			nomor VARCHAR(30) NOT NULL UNIQUE,
+			tahun INT NOT NULL,
+			urutan INT NOT NULL,
+			tanggal DATE NOT NULL,
+			jenis VARCHAR(10) NOT NULL CHECK (jenis IN ('tagihan', 'cicilan')),
+			pembayaran_id BIGINT NULL REFERENCES pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			riwayat_id BIGINT NULL UNIQUE REFERENCES riwayat_pembayaran(id) ON DELETE SET NULL ON UPDATE CASCADE,
+			nominal DECIMAL(12,2) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			UNIQUE (tahun, urutan)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_kwitansi_pembayaran_id ON kwitansi(pembayaran_id)`,
+	})
+}
+
+// createPerjanjianTables menyimpan template surat perjanjian sewa dan PDF
+// yang sudah dibuat untuk kontrak. Template tidak pernah diubah; setiap
+// perubahan disimpan sebagai versi baru dengan nama yang sama, sehingga
+// dokumen lama tetap menunjuk ke isi yang dipakai saat dibuat.
+func createPerjanjianTables() error {
+	return execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS template_perjanjian (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			nama VARCHAR(100) NOT NULL,
+			versi INT NOT NULL,
+			judul VARCHAR(150) NOT NULL,
+			isi TEXT NOT NULL,
+			tata_tertib TEXT NULL,
+			catatan TEXT NULL,
+			dibuat_oleh VARCHAR(100) NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+			UNIQUE KEY uq_template_perjanjian_versi (nama, versi)
+		)`,
+		`CREATE TABLE IF NOT EXISTS dokumen_kontrak (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			kontrak_id INT NOT NULL,
+			template_id INT NOT NULL,
+			file_path VARCHAR(255) NULL,
+			dibuat_oleh VARCHAR(100) NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+			FOREIGN KEY (kontrak_id) REFERENCES kontrak(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			FOREIGN KEY (template_id) REFERENCES template_perjanjian(id) ON UPDATE CASCADE,
+
+			INDEX idx_dokumen_kontrak_kontrak_id (kontrak_id)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS template_perjanjian (
+			id BIGSERIAL PRIMARY KEY,
+			nama VARCHAR(100) NOT NULL,
+			versi INT NOT NULL,
+			judul VARCHAR(150) NOT NULL,
+			isi TEXT NOT NULL,
+			tata_tertib TEXT NULL,
+			catatan TEXT NULL,
+			dibuat_oleh VARCHAR(100) NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			UNIQUE (nama, versi)
+		)`,
+		`CREATE TABLE IF NOT EXISTS dokumen_kontrak (
+			id BIGSERIAL PRIMARY KEY,
+			kontrak_id BIGINT NOT NULL REFERENCES kontrak(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			template_id BIGINT NOT NULL REFERENCES template_perjanjian(id) ON UPDATE CASCADE,
+			file_path VARCHAR(255) NULL,
+			dibuat_oleh VARCHAR(100) NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_dokumen_kontrak_kontrak_id ON dokumen_kontrak(kontrak_id)`,
+	})
+}
+
+// createTandaTanganTable mencatat tanda tangan pemilik dan penyewa pada
+// dokumen perjanjian. Teks perjanjian disimpan di dokumen_kontrak supaya
+// PDF yang ditandatangani sama persis dengan yang dibuat, dan sha256 adalah
+// hash file PDF terakhir untuk mendeteksi perubahan.
+func createTandaTanganTable() error {
+	columns := []struct{ name, def string }{
+		{"judul", "VARCHAR(150) NULL"},
+		{"isi", "TEXT NULL"},
+		{"nama_pemilik", "VARCHAR(100) NULL"},
+		{"nama_penyewa", "VARCHAR(100) NULL"},
+		{"sha256", "CHAR(64) NULL"},
+	}
+	for _, col := range columns {
+		alter := "ADD COLUMN " + col.name + " " + col.def
+		if err := addColumnIfMissing("dokumen_kontrak", col.name, alter, alter); err != nil {
+			return err
+		}
+	}
+
+	return execSchema([]string{
+		`CREATE TABLE IF NOT EXISTS tanda_tangan_dokumen (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			dokumen_id INT NOT NULL,
+			pihak VARCHAR(10) NOT NULL,
+			nama VARCHAR(100) NOT NULL,
+			ttd_path VARCHAR(255) NOT NULL,
+			ip VARCHAR(45) NOT NULL,
+			sha256 CHAR(64) NOT NULL,
+			ditandatangani_pada TIMESTAMP NOT NULL,
+
+			UNIQUE KEY uq_tanda_tangan_pihak (dokumen_id, pihak),
+			FOREIGN KEY (dokumen_id) REFERENCES dokumen_kontrak(id) ON DELETE CASCADE ON UPDATE CASCADE
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS tanda_tangan_dokumen (
+			id BIGSERIAL PRIMARY KEY,
+			dokumen_id BIGINT NOT NULL REFERENCES dokumen_kontrak(id) ON DELETE CASCADE ON UPDATE CASCADE,
+			pihak VARCHAR(10) NOT NULL CHECK (pihak IN ('pemilik', 'penyewa')),
+			nama VARCHAR(100) NOT NULL,
+			ttd_path VARCHAR(255) NOT NULL,
+			ip VARCHAR(45) NOT NULL,
+			sha256 CHAR(64) NOT NULL,
+			ditandatangani_pada TIMESTAMP WITH TIME ZONE NOT NULL,
+			UNIQUE (dokumen_id, pihak)
+		)`,
+	})
+}
+
+// addDendaTagihanItem menautkan rincian tagihan ke denda. Denda aktif
+// ditagihkan sebagai rincian jenis 'denda' sehingga ikut nominal tagihan
+// dan lunas bersama cicilannya.
+func addDendaTagihanItem() error {
+	return addColumnIfMissing("tagihan_item", "denda_id",
+		"ADD COLUMN denda_id INT NULL, ADD FOREIGN KEY (denda_id) REFERENCES denda(id) ON DELETE CASCADE ON UPDATE CASCADE",
+		"ADD COLUMN denda_id BIGINT NULL REFERENCES denda(id) ON DELETE CASCADE ON UPDATE CASCADE")
+}
+
+// createKwitansiNomorTable menyimpan nomor urut kwitansi terakhir per tahun.
+// Baris tahun dikunci saat nomor diambil; isi awalnya dari kwitansi yang
+// sudah terbit supaya nomor lama tidak terpakai ulang.
+func createKwitansiNomorTable() error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS kwitansi_nomor (
+			tahun INT PRIMARY KEY,
+			urutan INT NOT NULL
+		)`,
+		`INSERT INTO kwitansi_nomor (tahun, urutan)
+		SELECT k.tahun, MAX(k.urutan) FROM kwitansi k
+		WHERE NOT EXISTS (SELECT 1 FROM kwitansi_nomor n WHERE n.tahun = k.tahun)
+		GROUP BY k.tahun`,
+	}
+	return execSchema(stmts, stmts)
+}
+
+// pindahkanDokumenPribadi memindahkan file pribadi yang dulu disimpan di
+// ./uploads ke dokumenDir supaya tidak lagi tersaji lewat /uploads, lalu
+// menyesuaikan path yang tercatat.
+func pindahkanDokumenPribadi() error {
+	for _, ext := range []string{".png", ".jpg", ".jpeg"} {
+		if err := pindahkanFile(filepath.Join("./uploads/ttd", "pemilik"+ext), filepath.Join(ttdDir, "pemilik"+ext)); err != nil {
+			return err
+		}
+	}
+
+	if err := pindahkanIsiFolder("./uploads/perjanjian", perjanjianDir); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`
+		UPDATE dokumen_kontrak SET file_path = REPLACE(file_path, '/uploads/perjanjian/', '/dokumen/perjanjian/')
+		WHERE file_path LIKE '/uploads/perjanjian/%'`); err != nil {
+		return err
+	}
+
+	if err := pindahkanIsiFolder("./uploads/ttd/perjanjian", ttdPerjanjianDir); err != nil {
+		return err
+	}
+	_, err := db.Exec(`
+		UPDATE tanda_tangan_dokumen SET ttd_path = REPLACE(ttd_path, '/uploads/ttd/perjanjian/', '/dokumen/ttd/perjanjian/')
+		WHERE ttd_path LIKE '/uploads/ttd/perjanjian/%'`)
+	return err
+}
+
+// pindahkanIsiFolder memindahkan setiap file di folder lama ke folder baru.
+func pindahkanIsiFolder(lama, baru string) error {
+	entries, err := os.ReadDir(lama)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if err := pindahkanFile(filepath.Join(lama, e.Name()), filepath.Join(baru, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pindahkanFile memindahkan file atau folder lama; tidak melakukan apa-apa
+// jika path lama tidak ada.
+func pindahkanFile(lama, baru string) error {
+	if _, err := os.Stat(lama); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(baru), os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(lama, baru)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errCicilanDibatalkan = errors.New("cicilan sudah dibatalkan")
+	errCicilanPembatalan = errors.New("cicilan adalah pembatalan")
+)
+
+// namaAktor mengambil siapa yang melakukan perubahan: field "oleh" jika
+// dikirim, selain itu header X-User-Name dari frontend (URL-encoded).
+func namaAktor(c *gin.Context, in *requestInput) string {
+	if oleh := strings.TrimSpace(in.Get("oleh")); oleh != "" {
+		return oleh
+	}
+	nama := c.GetHeader("X-User-Name")
+	if decoded, err := url.QueryUnescape(nama); err == nil {
+		nama = decoded
+	}
+	return strings.TrimSpace(nama)
+}
+
+// cicilanTerkunci: cicilan yang sudah dibatalkan, atau baris pembatalannya
+// sendiri, tidak boleh dihapus atau dibatalkan lagi supaya jejak koreksi
+// tetap utuh.
+func cicilanTerkunci(q querier, riwayatID string) error {
+	var membatalkan sql.NullInt64
+	var dibatalkan int
+	err := q.QueryRow(`
+		SELECT r.membatalkan_id, (SELECT COUNT(*) FROM riwayat_pembayaran b WHERE b.membatalkan_id = r.id)
+		FROM riwayat_pembayaran r WHERE r.id = ?`, riwayatID).Scan(&membatalkan, &dibatalkan)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return err
+	case membatalkan.Valid:
+		return errCicilanPembatalan
+	case dibatalkan > 0:
+		return errCicilanDibatalkan
+	}
+	return nil
+}
+
+func respondPembatalanError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errCicilanDibatalkan):
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Cicilan sudah dibatalkan", nil)
+	case errors.Is(err, errCicilanPembatalan):
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Baris pembatalan tidak bisa diubah", nil)
+	default:
+		respondKreditError(c, err)
+	}
+}
+
+// batalkanKredit membalik kredit yang berasal dari cicilan asal: lebih
+// bayar ditarik dari saldo (jenis batal), pemakaian kredit dikembalikan ke
+// saldo (jenis masuk). Baris baru ditautkan ke cicilan pembatalan.
+func batalkanKredit(q querier, asalID, pembatalanID int64, tanggal string) error {
+	rows, err := q.Query(`
+		SELECT penyewa_id, jenis, nominal, pembayaran_id
+		FROM kredit_transaksi WHERE riwayat_id = ?`, asalID)
+	if err != nil {
+		return err
+	}
+	type kredit struct {
+		penyewaID    int64
+		jenis        string
+		nominal      float64
+		pembayaranID sql.NullInt64
+	}
+	var list []kredit
+	for rows.Next() {
+		var k kredit
+		if err := rows.Scan(&k.penyewaID, &k.jenis, &k.nominal, &k.pembayaranID); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, k := range list {
+		jenis, keterangan := "masuk", "Pembatalan pemakaian kredit"
+		if k.jenis == "masuk" {
+			if err := kunciSaldoKredit(q, k.penyewaID); err != nil {
+				return err
+			}
+			saldo, err := saldoKredit(q, k.penyewaID)
+			if err != nil {
+				return err
+			}
+			if k.nominal > saldo+0.005 {
+				return errKreditTerpakai
+			}
+			jenis, keterangan = "batal", "Pembatalan lebih bayar"
+		}
+		if _, err := q.Exec(`
+			INSERT INTO kredit_transaksi (penyewa_id, jenis, nominal, tanggal, pembayaran_id, riwayat_id, keterangan)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			k.penyewaID, jenis, k.nominal, tanggal, k.pembayaranID, pembatalanID,
+			keterangan+" cicilan #"+strconv.FormatInt(asalID, 10),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// POST /api/pembayaran/:id/riwayat/:riwayatId/batal membatalkan cicilan
+// tanpa menghapusnya: cicilan asal tetap ada, lalu dicatat baris pembalik
+// bernilai negatif (termasuk lebih_bayar-nya) beserta alasan dan pelakunya.
+// uang_dibayar, status, dan jatuh tempo dihitung ulang dari riwayat.
+func batalkanRiwayatPembayaran(c *gin.Context) {
+	pembayaranID := c.Param("id")
+	riwayatID := c.Param("riwayatId")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	fieldErrors := requiredFields(in, "alasan")
+	fieldErrors = append(fieldErrors, dateFields(in, "tanggal")...)
+	if len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	// Tanpa tanggal, baris pembalik memakai waktu sekarang supaya tampil
+	// setelah cicilan asal
+	tanggalBayar := convertDateFormat(in.Get("tanggal"))
+	tanggal := tanggalBayar
+	if tanggal == "" {
+		tanggal = time.Now().Format("2006-01-02")
+	}
+	oleh := namaAktor(c, in)
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var asalID int64
+	var kontrakID sql.NullInt64
+	var jumlah, lebih float64
+	var metode sql.NullString
+	err = tx.QueryRow(`
+		SELECT id, kontrak_id, jumlah_dibayar, lebih_bayar, metode_bayar
+		FROM riwayat_pembayaran WHERE id=? AND pembayaran_id=?`, riwayatID, pembayaranID).Scan(&asalID, &kontrakID, &jumlah, &lebih, &metode)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data riwayat_pembayaran tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := cicilanTerkunci(tx, riwayatID); err != nil {
+		respondPembatalanError(c, err)
+		return
+	}
+
+	pembatalanID, err := tx.InsertID(`
+		INSERT INTO riwayat_pembayaran (pembayaran_id, kontrak_id, jumlah_dibayar, lebih_bayar, tanggal_bayar, metode_bayar, keterangan, membatalkan_id, alasan, oleh)
+		VALUES (?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), ?, ?, ?, ?, ?)`,
+		pembayaranID, kontrakID, -jumlah, -lebih, nullIfEmpty(tanggalBayar), metode,
+		"Pembatalan cicilan #"+strconv.FormatInt(asalID, 10), asalID, in.Get("alasan"), nullIfEmpty(oleh),
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := batalkanKredit(tx, asalID, pembatalanID, tanggal); err != nil {
+		respondPembatalanError(c, err)
+		return
+	}
+	if err := sinkronPembayaran(tx, pembayaranID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := recalcJatuhTempoPembayaran(tx, pembayaranID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": pembatalanID, "membatalkan_id": asalID, "message": "Cicilan berhasil dibatalkan"})
+}
@@ -0,0 +1,633 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+)
+
+// TemplatePerjanjian adalah isi surat perjanjian sewa dengan placeholder
+// {{nama_penyewa}}, {{harga_sewa}}, dan seterusnya. Baris "# " menjadi judul
+// bagian di tengah, "## " menjadi subjudul tebal. Tata tertib rumah ikut
+// disimpan di template supaya berversi bersama isinya.
+type TemplatePerjanjian struct {
+	ID         int64  `json:"id"`
+	Nama       string `json:"nama"`
+	Versi      int    `json:"versi"`
+	Judul      string `json:"judul"`
+	Isi        string `json:"isi"`
+	TataTertib string `json:"tata_tertib"`
+	Catatan    string `json:"catatan"`
+	DibuatOleh string `json:"dibuat_oleh"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// PDF perjanjian berisi NIK dan alamat penyewa, jadi disimpan di
+// dokumenDir (bukan ./uploads) dan hanya dikirim lewat
+// GET /api/kontrak/:id/perjanjian/:dokumenId/pdf. file_path di
+// dokumen_kontrak relatif terhadap folder backend.
+var perjanjianDir = filepath.Join(dokumenDir, "perjanjian")
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-z_]+)\s*\}\}`)
+
+// placeholderPerjanjian adalah placeholder yang bisa dipakai di judul, isi,
+// dan tata tertib template.
+var placeholderPerjanjian = map[string]string{
+	"nomor_kontrak":        "Nomor perjanjian, misalnya SP/2026/0012",
+	"nama_penyewa":         "Nama lengkap penyewa",
+	"nik":                  "NIK penyewa",
+	"alamat_penyewa":       "Alamat asal penyewa",
+	"telepon_penyewa":      "Nomor telepon penyewa",
+	"nama_unit":            "Nama unit yang disewa",
+	"tipe_unit":            "Tipe unit",
+	"harga_sewa":           "Harga sewa per periode, misalnya Rp 1.500.000",
+	"harga_sewa_terbilang": "Harga sewa dalam kata",
+	"periode_tagihan":      "bulanan, triwulan, semester, atau tahunan",
+	"tanggal_mulai":        "Tanggal mulai sewa, misalnya 1 Januari 2026",
+	"tanggal_akhir":        "Tanggal akhir sewa",
+	"deposit":              "Uang jaminan kontrak",
+	"deposit_terbilang":    "Uang jaminan dalam kata",
+	"tata_tertib":          "Tata tertib rumah dari template",
+	"tanggal_hari_ini":     "Tanggal dokumen dibuat",
+	"nama_pemilik":         "Nama pemilik (KWITANSI_PEMILIK)",
+	"kota":                 "Kota penandatanganan (KWITANSI_KOTA)",
+	"nama_usaha":           "Nama usaha dari template invoice",
+	"alamat_properti":      "Alamat usaha dari template invoice",
+}
+
+var templatePerjanjianBawaan = TemplatePerjanjian{
+	Nama:  "standar",
+	Judul: "SURAT PERJANJIAN SEWA",
+	Isi: `Nomor: {{nomor_kontrak}}
+
+Pada tanggal {{tanggal_hari_ini}}, yang bertanda tangan di bawah ini:
+
+1. {{nama_pemilik}}, selaku pemilik {{nama_usaha}}, selanjutnya disebut PIHAK PERTAMA.
+2. {{nama_penyewa}}, NIK {{nik}}, beralamat di {{alamat_penyewa}}, nomor telepon {{telepon_penyewa}}, selanjutnya disebut PIHAK KEDUA.
+
+Kedua pihak sepakat mengadakan perjanjian sewa dengan ketentuan sebagai berikut.
+
+## Pasal 1 - Objek Sewa
+PIHAK PERTAMA menyewakan unit {{nama_unit}} ({{tipe_unit}}) yang beralamat di {{alamat_properti}} kepada PIHAK KEDUA.
+
+## Pasal 2 - Jangka Waktu
+Sewa berlaku sejak {{tanggal_mulai}} sampai dengan {{tanggal_akhir}}.
+
+## Pasal 3 - Harga Sewa
+Harga sewa sebesar {{harga_sewa}} ({{harga_sewa_terbilang}}) dibayar {{periode_tagihan}} paling lambat pada tanggal jatuh tempo.
+
+## Pasal 4 - Uang Jaminan
+PIHAK KEDUA menyerahkan uang jaminan sebesar {{deposit}} ({{deposit_terbilang}}) yang dikembalikan pada akhir masa sewa setelah dikurangi kerusakan atau tunggakan.
+
+## Pasal 5 - Tata Tertib
+{{tata_tertib}}
+
+## Pasal 6 - Penutup
+Perjanjian ini dibuat dalam dua rangkap yang sama kekuatan hukumnya dan ditandatangani oleh kedua pihak dalam keadaan sadar tanpa paksaan.`,
+	TataTertib: `1. Menjaga kebersihan dan ketertiban lingkungan.
+2. Tamu menginap wajib melapor kepada pemilik.
+3. Dilarang mengubah bangunan tanpa izin tertulis dari pemilik.
+4. Dilarang menyimpan barang terlarang atau berbahaya.`,
+}
+
+// placeholderTidakDikenal mengembalikan placeholder yang tidak ada di
+// placeholderPerjanjian, tanpa duplikat.
+func placeholderTidakDikenal(text string) []string {
+	var unknown []string
+	seen := map[string]bool{}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if _, ok := placeholderPerjanjian[m[1]]; !ok && !seen[m[1]] {
+			seen[m[1]] = true
+			unknown = append(unknown, m[1])
+		}
+	}
+	return unknown
+}
+
+// isiPlaceholder mengganti semua placeholder dengan nilainya.
+func isiPlaceholder(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(m string) string {
+		return values[placeholderPattern.FindStringSubmatch(m)[1]]
+	})
+}
+
+// nilaiPerjanjian mengumpulkan nilai placeholder untuk satu kontrak.
+func nilaiPerjanjian(q querier, kontrakID string, t *TemplatePerjanjian) (int64, map[string]string, error) {
+	var id int64
+	var nama, nik, alamat, telepon, unit, tipe, periode string
+	var harga, deposit float64
+	var mulai, akhir sql.NullTime
+	err := q.QueryRow(`
+		SELECT k.id, COALESCE(py.nama, ''), COALESCE(py.nik, ''), COALESCE(py.alamat, ''), COALESCE(py.telepon, ''),
+		       COALESCE(pr.nama_unit, ''), COALESCE(pr.tipe, ''), k.periode_tagihan, k.harga_sewa, k.deposit,
+		       k.tanggal_mulai, k.tanggal_akhir
+		FROM kontrak k
+		LEFT JOIN penyewa py ON py.id = k.penyewa_id
+		LEFT JOIN properti pr ON pr.id = k.properti_id
+		WHERE k.id=?`, kontrakID).Scan(&id, &nama, &nik, &alamat, &telepon, &unit, &tipe, &periode, &harga, &deposit, &mulai, &akhir)
+	if err != nil {
+		return 0, nil, err
+	}
+	usaha, err := loadInvoiceTemplate()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tanggalAkhir := "waktu yang tidak ditentukan"
+	if akhir.Valid {
+		tanggalAkhir = formatTanggalPanjang(akhir.Time)
+	}
+	values := map[string]string{
+		"nomor_kontrak":        fmt.Sprintf("SP/%d/%04d", mulai.Time.Year(), id),
+		"nama_penyewa":         nama,
+		"nik":                  nik,
+		"alamat_penyewa":       alamat,
+		"telepon_penyewa":      telepon,
+		"nama_unit":            unit,
+		"tipe_unit":            tipe,
+		"harga_sewa":           formatRupiah(harga),
+		"harga_sewa_terbilang": terbilang(harga),
+		"periode_tagihan":      periode,
+		"tanggal_mulai":        formatTanggalPanjang(mulai.Time),
+		"tanggal_akhir":        tanggalAkhir,
+		"deposit":              formatRupiah(deposit),
+		"deposit_terbilang":    terbilang(deposit),
+		"tanggal_hari_ini":     formatTanggalPanjang(time.Now()),
+		"nama_pemilik":         namaPemilik(),
+		"kota":                 envOr("KWITANSI_KOTA", ""),
+		"nama_usaha":           usaha.NamaUsaha,
+		"alamat_properti":      usaha.Alamat,
+	}
+	// Tata tertib boleh memuat placeholder lain
+	values["tata_tertib"] = isiPlaceholder(t.TataTertib, values)
+	return id, values, nil
+}
+
+// pihakPerjanjian adalah satu kolom tanda tangan di bawah perjanjian. TTD
+// berisi path gambar tanda tangan, kosong jika belum ditandatangani.
+type pihakPerjanjian struct {
+	Sebutan string
+	Nama    string
+	TTD     string
+	Waktu   time.Time
+}
+
+// dokumenPerjanjian adalah perjanjian yang placeholdernya sudah diisi.
+type dokumenPerjanjian struct {
+	KontrakID int64
+	Judul     string
+	Isi       string
+	Tanggal   time.Time
+	Pihak     [2]pihakPerjanjian
+}
+
+func susunPerjanjian(q querier, kontrakID string, t *TemplatePerjanjian) (*dokumenPerjanjian, error) {
+	id, values, err := nilaiPerjanjian(q, kontrakID, t)
+	if err != nil {
+		return nil, err
+	}
+	return &dokumenPerjanjian{
+		KontrakID: id,
+		Judul:     isiPlaceholder(t.Judul, values),
+		Isi:       isiPlaceholder(t.Isi, values),
+		Tanggal:   time.Now(),
+		Pihak: [2]pihakPerjanjian{
+			{Sebutan: "PIHAK PERTAMA", Nama: values["nama_pemilik"]},
+			{Sebutan: "PIHAK KEDUA", Nama: values["nama_penyewa"]},
+		},
+	}, nil
+}
+
+// renderPerjanjian menggambar perjanjian di kertas A4 tegak, diakhiri
+// kolom tanda tangan kedua pihak.
+func renderPerjanjian(d *dokumenPerjanjian) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(d.Judul, true)
+	pdf.SetMargins(25, 20, 25)
+	pdf.SetAutoPageBreak(true, 20)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Halaman %d dari {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.MultiCell(0, 7, tr(d.Judul), "", "C", false)
+	pdf.Ln(4)
+
+	for _, line := range strings.Split(strings.ReplaceAll(d.Isi, "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, " \t")
+		switch {
+		case line == "":
+			pdf.Ln(3)
+		case strings.HasPrefix(line, "## "):
+			pdf.Ln(2)
+			pdf.SetFont("Helvetica", "B", 11)
+			pdf.MultiCell(0, 6, tr(strings.TrimPrefix(line, "## ")), "", "L", false)
+		case strings.HasPrefix(line, "# "):
+			pdf.Ln(2)
+			pdf.SetFont("Helvetica", "B", 12)
+			pdf.MultiCell(0, 6, tr(strings.TrimPrefix(line, "# ")), "", "C", false)
+		default:
+			pdf.SetFont("Helvetica", "", 11)
+			pdf.MultiCell(0, 6, tr(line), "", "J", false)
+		}
+	}
+
+	// Kolom tanda tangan tidak dipotong ke halaman berikutnya
+	_, pageHeight := pdf.GetPageSize()
+	if pdf.GetY()+60 > pageHeight-20 {
+		pdf.AddPage()
+	}
+	pdf.Ln(8)
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.CellFormat(0, 6, tr(tempatTanggal(d.Tanggal)), "", 1, "R", false, 0, "")
+	pdf.Ln(2)
+
+	top := pdf.GetY()
+	for i, p := range d.Pihak {
+		x := 25 + float64(i)*85
+		pdf.SetXY(x, top)
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.CellFormat(75, 6, p.Sebutan, "", 0, "C", false, 0, "")
+		if p.TTD != "" {
+			// Gambar diperkecil supaya muat di kotak 50x22 mm tanpa berubah rasio
+			opts := fpdf.ImageOptions{ReadDpi: true}
+			if info := pdf.RegisterImageOptions(p.TTD, opts); info != nil {
+				w, h := info.Extent()
+				scale := math.Min(50/w, 22/h)
+				w, h = w*scale, h*scale
+				pdf.ImageOptions(p.TTD, x+(75-w)/2, top+8+(22-h)/2, w, h, false, opts, 0, "")
+			}
+		}
+		pdf.SetXY(x, top+32)
+		pdf.SetFont("Helvetica", "BU", 11)
+		pdf.CellFormat(75, 6, tr(p.Nama), "", 0, "C", false, 0, "")
+		if !p.Waktu.IsZero() {
+			pdf.SetXY(x, top+38)
+			pdf.SetFont("Helvetica", "I", 8)
+			pdf.CellFormat(75, 4, "Ditandatangani "+p.Waktu.Local().Format("02/01/2006 15:04"), "", 0, "C", false, 0, "")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const templatePerjanjianSelect = `
+	SELECT id, nama, versi, judul, isi, COALESCE(tata_tertib, ''), COALESCE(catatan, ''),
+	       COALESCE(dibuat_oleh, ''), created_at
+	FROM template_perjanjian`
+
+func scanTemplatePerjanjian(row interface{ Scan(...interface{}) error }) (TemplatePerjanjian, error) {
+	var t TemplatePerjanjian
+	var created sql.NullTime
+	err := row.Scan(&t.ID, &t.Nama, &t.Versi, &t.Judul, &t.Isi, &t.TataTertib, &t.Catatan, &t.DibuatOleh, &created)
+	if created.Valid {
+		t.CreatedAt = created.Time.Format(time.RFC3339)
+	}
+	return t, err
+}
+
+// GET /api/perjanjian/template: versi terbaru setiap template, atau semua
+// versi satu template dengan ?nama=.
+func getTemplatePerjanjian(c *gin.Context) {
+	query := templatePerjanjianSelect + `
+		WHERE versi = (SELECT MAX(t2.versi) FROM template_perjanjian t2 WHERE t2.nama = template_perjanjian.nama)
+		ORDER BY nama`
+	var args []interface{}
+	if nama := c.Query("nama"); nama != "" {
+		query = templatePerjanjianSelect + " WHERE nama=? ORDER BY versi DESC"
+		args = append(args, nama)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	list := []TemplatePerjanjian{}
+	for rows.Next() {
+		t, err := scanTemplatePerjanjian(rows)
+		if err != nil {
+			respondDBError(c, err)
+			return
+		}
+		list = append(list, t)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func getTemplatePerjanjianByID(c *gin.Context) {
+	t, err := scanTemplatePerjanjian(db.QueryRow(templatePerjanjianSelect+" WHERE id=?", c.Param("id")))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// GET /api/perjanjian/placeholder
+func getPlaceholderPerjanjian(c *gin.Context) {
+	names := make([]string, 0, len(placeholderPerjanjian))
+	for name := range placeholderPerjanjian {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		list = append(list, gin.H{"placeholder": "{{" + name + "}}", "keterangan": placeholderPerjanjian[name]})
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func validateTemplatePerjanjian(in *requestInput) []FieldError {
+	fieldErrors := requiredFields(in, "nama", "judul", "isi")
+	for _, field := range []string{"judul", "isi", "tata_tertib"} {
+		if unknown := placeholderTidakDikenal(in.Get(field)); len(unknown) > 0 {
+			fieldErrors = append(fieldErrors, FieldError{
+				Field:   field,
+				Message: "Placeholder tidak dikenal: " + strings.Join(unknown, ", "),
+			})
+		}
+	}
+	return fieldErrors
+}
+
+// POST /api/perjanjian/template menyimpan template sebagai versi baru.
+// Nama yang belum ada menjadi versi 1; template lama tidak pernah diubah.
+func createTemplatePerjanjian(c *gin.Context) {
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateTemplatePerjanjian(in); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	nama := strings.TrimSpace(in.Get("nama"))
+	var versi int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(versi), 0) + 1 FROM template_perjanjian WHERE nama=?", nama).Scan(&versi); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	id, err := tx.InsertID(`
+		INSERT INTO template_perjanjian (nama, versi, judul, isi, tata_tertib, catatan, dibuat_oleh)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		nama, versi, in.Get("judul"), in.Get("isi"), nullIfEmpty(in.Get("tata_tertib")),
+		nullIfEmpty(in.Get("catatan")), nullIfEmpty(namaAktor(c, in)),
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "versi": versi, "message": "Template perjanjian berhasil disimpan"})
+}
+
+// loadDokumenKontrak mendaftar perjanjian yang pernah dibuat untuk kontrak,
+// terbaru lebih dulu.
+func loadDokumenKontrak(q querier, kontrakID string) ([]gin.H, error) {
+	rows, err := q.Query(`
+		SELECT d.id, d.template_id, t.nama, t.versi, COALESCE(d.file_path, ''), COALESCE(d.sha256, ''),
+		       COALESCE(d.dibuat_oleh, ''), d.created_at,
+		       (SELECT COUNT(*) FROM tanda_tangan_dokumen s WHERE s.dokumen_id = d.id AND s.pihak = 'pemilik'),
+		       (SELECT COUNT(*) FROM tanda_tangan_dokumen s WHERE s.dokumen_id = d.id AND s.pihak = 'penyewa')
+		FROM dokumen_kontrak d
+		JOIN template_perjanjian t ON t.id = d.template_id
+		WHERE d.kontrak_id=?
+		ORDER BY d.id DESC`, kontrakID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []gin.H{}
+	for rows.Next() {
+		var id, templateID int64
+		var nama, path, hash, oleh string
+		var versi, ttdPemilik, ttdPenyewa int
+		var created sql.NullTime
+		if err := rows.Scan(&id, &templateID, &nama, &versi, &path, &hash, &oleh, &created, &ttdPemilik, &ttdPenyewa); err != nil {
+			return nil, err
+		}
+		list = append(list, gin.H{
+			"id":            id,
+			"template_id":   templateID,
+			"template_nama": nama,
+			"versi":         versi,
+			"file_path":     path,
+			"url":           urlPerjanjian(kontrakID, id),
+			"sha256":        hash,
+			"ttd_pemilik":   ttdPemilik > 0,
+			"ttd_penyewa":   ttdPenyewa > 0,
+			"dibuat_oleh":   oleh,
+			"created_at":    created.Time.Format(time.RFC3339),
+		})
+	}
+	return list, rows.Err()
+}
+
+// urlPerjanjian adalah endpoint untuk mengunduh PDF sebuah dokumen.
+func urlPerjanjian(kontrakID interface{}, dokumenID int64) string {
+	return fmt.Sprintf("/api/kontrak/%v/perjanjian/%d/pdf", kontrakID, dokumenID)
+}
+
+// GET /api/kontrak/:id/perjanjian
+func getPerjanjianKontrak(c *gin.Context) {
+	id := c.Param("id")
+	if !ensureExists(c, "kontrak", id) {
+		return
+	}
+	list, err := loadDokumenKontrak(db, id)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// templateStandar mengembalikan versi terbaru template "standar". Template
+// bawaan baru disimpan saat pertama kali dipakai, supaya database kosong
+// tetap kosong untuk restore.
+func templateStandar(q querier) (TemplatePerjanjian, error) {
+	row := q.QueryRow(templatePerjanjianSelect+" WHERE nama=? ORDER BY versi DESC LIMIT 1", templatePerjanjianBawaan.Nama)
+	t, err := scanTemplatePerjanjian(row)
+	if err != sql.ErrNoRows {
+		return t, err
+	}
+
+	b := templatePerjanjianBawaan
+	id, err := q.InsertID(`
+		INSERT INTO template_perjanjian (nama, versi, judul, isi, tata_tertib, dibuat_oleh)
+		VALUES (?, 1, ?, ?, ?, 'sistem')`, b.Nama, b.Judul, b.Isi, b.TataTertib)
+	if err != nil {
+		return t, err
+	}
+	return scanTemplatePerjanjian(q.QueryRow(templatePerjanjianSelect+" WHERE id=?", id))
+}
+
+// POST /api/kontrak/:id/perjanjian membuat PDF perjanjian dari template_id
+// (tanpa template_id: versi terbaru template "standar") dan menyimpannya
+// sebagai dokumen kontrak.
+func buatPerjanjianKontrak(c *gin.Context) {
+	kontrakID := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := numericFields(in, "template_id"); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "kontrak", kontrakID) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var t TemplatePerjanjian
+	if in.Get("template_id") == "" {
+		t, err = templateStandar(tx)
+	} else {
+		t, err = scanTemplatePerjanjian(tx.QueryRow(templatePerjanjianSelect+" WHERE id=?", in.Get("template_id")))
+	}
+	if err == sql.ErrNoRows {
+		respondValidation(c, []FieldError{{Field: "template_id", Message: "Template perjanjian tidak ditemukan"}})
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	d, err := susunPerjanjian(tx, kontrakID, &t)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	pdf, err := renderPerjanjian(d)
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+
+	dokumenID, err := tx.InsertID(`
+		INSERT INTO dokumen_kontrak (kontrak_id, template_id, judul, isi, nama_pemilik, nama_penyewa, dibuat_oleh)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		kontrakID, t.ID, d.Judul, d.Isi, d.Pihak[0].Nama, d.Pihak[1].Nama, nullIfEmpty(namaAktor(c, in)),
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	path, err := simpanPDFPerjanjian(d.KontrakID, dokumenID, pdf)
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	hash := hashDokumen(pdf)
+	if _, err := tx.Exec("UPDATE dokumen_kontrak SET file_path=?, sha256=? WHERE id=?", path, hash, dokumenID); err != nil {
+		os.Remove("." + path)
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		os.Remove("." + path)
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":        dokumenID,
+		"file_path": path,
+		"url":       urlPerjanjian(d.KontrakID, dokumenID),
+		"sha256":    hash,
+		"message":   "Perjanjian berhasil dibuat",
+	})
+}
+
+// simpanPDFPerjanjian menulis PDF ke perjanjianDir dan mengembalikan path
+// yang disimpan di dokumen_kontrak.
+func simpanPDFPerjanjian(kontrakID, dokumenID int64, pdf []byte) (string, error) {
+	if err := os.MkdirAll(perjanjianDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	filename := fmt.Sprintf("kontrak-%d-%d.pdf", kontrakID, dokumenID)
+	if err := os.WriteFile(filepath.Join(perjanjianDir, filename), pdf, 0o644); err != nil {
+		return "", err
+	}
+	return "/dokumen/perjanjian/" + filename, nil
+}
+
+// GET /api/kontrak/:id/perjanjian/:dokumenId/pdf mengirim PDF perjanjian
+// terakhir (termasuk tanda tangan yang sudah ada).
+func unduhPerjanjian(c *gin.Context) {
+	var path string
+	err := db.QueryRow("SELECT COALESCE(file_path, '') FROM dokumen_kontrak WHERE id=? AND kontrak_id=?",
+		c.Param("dokumenId"), c.Param("id")).Scan(&path)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Dokumen perjanjian tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if path == "" {
+		respondNotFound(c, "File perjanjian tidak ditemukan")
+		return
+	}
+	if _, err := os.Stat("." + path); err != nil {
+		respondNotFound(c, "File perjanjian tidak ditemukan")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filepath.Base(path)))
+	c.File("." + path)
+}
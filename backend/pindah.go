@@ -0,0 +1,256 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keteranganKontrakOtomatis menandai kontrak yang dibuat createPembayaran
+// tanpa kontrak_id. Kontrak seperti ini ikut dihapus bersama tagihan
+// terakhirnya.
+const keteranganKontrakOtomatis = "Dibuat otomatis dari pembayaran"
+
+var (
+	statusUnitKeluarValid = []string{"kosong", "maintenance"}
+	statusKontrakKeluar   = []string{"berakhir", "diputus"}
+)
+
+// lepaskanUnit mengubah status unit menjadi statusUnit jika tidak ada lagi
+// kontrak aktif maupun penyewa yang terhubung ke unit itu. Unit yang
+// sedang maintenance tidak diubah menjadi kosong.
+func lepaskanUnit(q querier, propertiID int64, statusUnit string) error {
+	var terpakai int
+	err := q.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM kontrak WHERE properti_id=? AND status='aktif')
+		     + (SELECT COUNT(*) FROM penyewa WHERE properti_id=?)`, propertiID, propertiID).Scan(&terpakai)
+	if err != nil || terpakai > 0 {
+		return err
+	}
+	if statusUnit == "maintenance" {
+		_, err = q.Exec("UPDATE properti SET status='maintenance' WHERE id=?", propertiID)
+	} else {
+		_, err = q.Exec("UPDATE properti SET status=? WHERE id=? AND status='terisi'", statusUnit, propertiID)
+	}
+	return err
+}
+
+// sinkronUnitKontrak menyamakan status unit dan properti_id penyewa dengan
+// kontrak setelah kontrak diubah. propertiLama adalah unit sebelum
+// perubahan; unit itu dilepas jika kontrak pindah unit atau tidak aktif.
+func sinkronUnitKontrak(q querier, kontrakID int64, propertiLama sql.NullInt64) error {
+	if err := sinkronHunian(q, kontrakID, hariIni()); err != nil {
+		return err
+	}
+
+	var penyewaID int64
+	var propertiID sql.NullInt64
+	var status string
+	var mulai sql.NullTime
+	err := q.QueryRow("SELECT penyewa_id, properti_id, status, tanggal_mulai FROM kontrak WHERE id=?", kontrakID).
+		Scan(&penyewaID, &propertiID, &status, &mulai)
+	if err != nil {
+		return err
+	}
+
+	if status == "aktif" && propertiID.Valid {
+		if _, err := q.Exec("UPDATE properti SET status='terisi' WHERE id=?", propertiID.Int64); err != nil {
+			return err
+		}
+		if _, err := q.Exec("UPDATE penyewa SET properti_id=?, mulai_kontrak=? WHERE id=?", propertiID.Int64, dateString(mulai), penyewaID); err != nil {
+			return err
+		}
+	}
+
+	if !propertiLama.Valid || (status == "aktif" && propertiID.Valid && propertiID.Int64 == propertiLama.Int64) {
+		return nil
+	}
+	if _, err := q.Exec("UPDATE penyewa SET properti_id=NULL WHERE id=? AND properti_id=?", penyewaID, propertiLama.Int64); err != nil {
+		return err
+	}
+	return lepaskanUnit(q, propertiLama.Int64, "kosong")
+}
+
+// hapusKontrakOtomatisKosong menghapus kontrak buatan createPembayaran yang
+// sudah tidak punya tagihan, lalu melepas unitnya. Kontrak yang dibuat
+// manual tidak disentuh. Dijalankan di transaksi pemanggil, sesudah
+// tagihannya dihapus, supaya kontrak tidak terhapus separuh.
+func hapusKontrakOtomatisKosong(q querier, kontrakID int64) error {
+	var penyewaID int64
+	var propertiID sql.NullInt64
+	err := q.QueryRow(`
+		SELECT penyewa_id, properti_id FROM kontrak
+		WHERE id=? AND keterangan=?
+		  AND NOT EXISTS (SELECT 1 FROM pembayaran WHERE kontrak_id = kontrak.id)
+		FOR UPDATE`,
+		kontrakID, keteranganKontrakOtomatis).Scan(&penyewaID, &propertiID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.Exec("DELETE FROM riwayat_hunian WHERE kontrak_id=?", kontrakID); err != nil {
+		return err
+	}
+	if _, err := q.Exec("DELETE FROM kontrak WHERE id=?", kontrakID); err != nil {
+		return err
+	}
+	if !propertiID.Valid {
+		return nil
+	}
+	if _, err := q.Exec("UPDATE penyewa SET properti_id=NULL WHERE id=? AND properti_id=?", penyewaID, propertiID.Int64); err != nil {
+		return err
+	}
+	return lepaskanUnit(q, propertiID.Int64, "kosong")
+}
+
+// batalkanTagihanSetelahKeluar menghapus tagihan generator untuk periode
+// yang dimulai setelah tanggal keluar dan belum dibayar sama sekali.
+func batalkanTagihanSetelahKeluar(q querier, kontrakID int64, tanggalKeluar string) (int64, error) {
+	result, err := q.Exec(`
+		DELETE FROM pembayaran
+		WHERE kontrak_id=? AND periode_mulai IS NOT NULL AND periode_mulai > ?
+		  AND COALESCE(uang_dibayar, 0) = 0
+		  AND NOT EXISTS (SELECT 1 FROM riwayat_pembayaran r WHERE r.pembayaran_id = pembayaran.id)`,
+		kontrakID, tanggalKeluar)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// POST /api/kontrak/:id/pindah mencatat penyewa pindah keluar: kontrak
+// diakhiri dengan tanggal keluar sebenarnya, tagihan periode setelah keluar
+// dibatalkan, deposit diselesaikan (memotong tunggakan, sisanya refund),
+// dan unit dilepas menjadi kosong atau maintenance.
+func pindahKeluar(c *gin.Context) {
+	kontrakID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondNotFound(c, "Data kontrak tidak ditemukan")
+		return
+	}
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	fieldErrors := dateFields(in, "tanggal_keluar")
+	fieldErrors = append(fieldErrors, oneOfField(in, "status_unit", statusUnitKeluarValid)...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "status", statusKontrakKeluar)...)
+	if len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	tanggalKeluar := convertDateFormat(in.Get("tanggal_keluar"))
+	if tanggalKeluar == "" {
+		tanggalKeluar = time.Now().Format("2006-01-02")
+	}
+	statusUnit := in.Get("status_unit")
+	if statusUnit == "" {
+		statusUnit = "kosong"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var penyewaID int64
+	var propertiID sql.NullInt64
+	var status string
+	var mulai, akhir sql.NullTime
+	err = tx.QueryRow("SELECT penyewa_id, properti_id, status, tanggal_mulai, tanggal_akhir FROM kontrak WHERE id=?", kontrakID).
+		Scan(&penyewaID, &propertiID, &status, &mulai, &akhir)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if status != "aktif" {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Kontrak sudah tidak aktif", nil)
+		return
+	}
+	if tanggalKeluar < dateString(mulai) {
+		respondValidation(c, []FieldError{{Field: "tanggal_keluar", Message: "tanggal_keluar tidak boleh sebelum tanggal_mulai kontrak"}})
+		return
+	}
+
+	// Keluar sebelum kontrak habis dianggap diputus, kecuali dikirim lain
+	statusBaru := in.Get("status")
+	if statusBaru == "" {
+		statusBaru = "berakhir"
+		if akhir.Valid && tanggalKeluar < dateString(akhir) {
+			statusBaru = "diputus"
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE kontrak SET status=?, tanggal_keluar=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`,
+		statusBaru, tanggalKeluar, kontrakID,
+	); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	if err := sinkronHunian(tx, kontrakID, tanggalKeluar); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	dibatalkan, err := batalkanTagihanSetelahKeluar(tx, kontrakID, tanggalKeluar)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	deposit, err := loadDepositStatement(tx, kontrakID)
+	if err == nil && deposit.Selesai == "" {
+		deposit, err = selesaikanDeposit(tx, kontrakID, tanggalKeluar, in.Get("metode_bayar"))
+	}
+	if err != nil {
+		respondDepositError(c, err)
+		return
+	}
+
+	if propertiID.Valid {
+		if _, err := tx.Exec("UPDATE penyewa SET properti_id=NULL WHERE id=? AND properti_id=?", penyewaID, propertiID.Int64); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		if err := lepaskanUnit(tx, propertiID.Int64, statusUnit); err != nil {
+			respondDBError(c, err)
+			return
+		}
+	}
+	if err := recalcJatuhTempo(tx, kontrakID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	k, err := scanKontrak(tx.QueryRow(kontrakSelect+" WHERE k.id=?", kontrakID))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Penyewa berhasil pindah keluar",
+		"kontrak":            k,
+		"deposit":            deposit,
+		"tagihan_dibatalkan": dibatalkan,
+		"sisa_tunggakan":     deposit.Tunggakan,
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+)
+
+// Status tagihan mengikuti uang yang masuk: pending (belum ada cicilan),
+// sebagian, lalu lunas. Penolakan membatalkan cicilannya, bukan mengubah
+// status tagihan.
+var statusPembayaranValid = []string{"pending", "sebagian", "lunas"}
+
+// statusDariDibayar menentukan status tagihan dari total cicilan.
+func statusDariDibayar(nominal, dibayar float64) string {
+	// Toleransi setengah sen untuk pembulatan DECIMAL
+	switch {
+	case dibayar+0.005 >= nominal && dibayar > 0:
+		return "lunas"
+	case dibayar > 0:
+		return "sebagian"
+	}
+	return "pending"
+}
+
+// sinkronPembayaran menyamakan uang_dibayar dan status tagihan dengan
+// jumlah riwayat_pembayaran. Dipanggil di transaksi yang sama setiap kali
+// cicilan atau nominal tagihan berubah.
+func sinkronPembayaran(q querier, pembayaranID interface{}) error {
+	var nominal, dibayar float64
+	err := q.QueryRow(`
+		SELECT pb.nominal,
+		       COALESCE((SELECT SUM(r.jumlah_dibayar - r.lebih_bayar) FROM riwayat_pembayaran r WHERE r.pembayaran_id = pb.id), 0)
+		FROM pembayaran pb WHERE pb.id=?`, pembayaranID).Scan(&nominal, &dibayar)
+	if err != nil {
+		return err
+	}
+	status := statusDariDibayar(nominal, dibayar)
+	_, err = q.Exec("UPDATE pembayaran SET uang_dibayar=?, status=? WHERE id=?", math.Round(dibayar*100)/100, status, pembayaranID)
+	return err
+}
+
+type rekonsiliasiItem struct {
+	PembayaranID int64   `json:"pembayaran_id"`
+	NamaPenyewa  string  `json:"nama_penyewa"`
+	Nominal      float64 `json:"nominal"`
+	UangDibayar  float64 `json:"uang_dibayar"`
+	Riwayat      float64 `json:"riwayat"`
+	Cicilan      float64 `json:"cicilan_awal"`
+	StatusLama   string  `json:"status_lama"`
+	StatusBaru   string  `json:"status_baru"`
+}
+
+type rekonsiliasiReport struct {
+	DryRun     bool               `json:"dry_run"`
+	Diperiksa  int                `json:"diperiksa"`
+	Diperbaiki int                `json:"diperbaiki"`
+	Tagihan    []rekonsiliasiItem `json:"tagihan"`
+}
+
+// rekonsiliasiPembayaran memperbaiki tagihan yang uang_dibayar atau
+// statusnya tidak cocok dengan riwayat. Uang yang tercatat di uang_dibayar
+// tetapi tidak ada di riwayat (uang muka lama, atau NULL yang dulu berarti
+// lunas) dicatat sebagai cicilan awal, sehingga total uang masuk tidak
+// berubah; setelah itu uang_dibayar dan status diturunkan dari riwayat.
+func rekonsiliasiPembayaran(dryRun bool) (*rekonsiliasiReport, error) {
+	report := &rekonsiliasiReport{DryRun: dryRun, Tagihan: []rekonsiliasiItem{}}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT pb.id, COALESCE(py.nama, ''), pb.nominal, pb.uang_dibayar, COALESCE(pb.status, 'pending'),
+		       COALESCE((SELECT SUM(r.jumlah_dibayar - r.lebih_bayar) FROM riwayat_pembayaran r WHERE r.pembayaran_id = pb.id), 0)
+		FROM pembayaran pb
+		LEFT JOIN penyewa py ON py.id = pb.penyewa_id
+		ORDER BY pb.id`)
+	if err != nil {
+		return nil, err
+	}
+	var list []rekonsiliasiItem
+	for rows.Next() {
+		var t rekonsiliasiItem
+		var uangDibayar sql.NullFloat64
+		if err := rows.Scan(&t.PembayaranID, &t.NamaPenyewa, &t.Nominal, &uangDibayar, &t.StatusLama, &t.Riwayat); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t.UangDibayar = t.Nominal
+		if uangDibayar.Valid {
+			t.UangDibayar = uangDibayar.Float64
+		}
+
+		if t.UangDibayar > t.Riwayat+0.005 {
+			t.Cicilan = math.Round((t.UangDibayar-t.Riwayat)*100) / 100
+		}
+		t.StatusBaru = statusDariDibayar(t.Nominal, t.Riwayat+t.Cicilan)
+
+		report.Diperiksa++
+		selisih := math.Abs(t.UangDibayar-(t.Riwayat+t.Cicilan)) > 0.005 || !uangDibayar.Valid
+		if t.Cicilan > 0 || selisih || t.StatusBaru != t.StatusLama {
+			list = append(list, t)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, t := range list {
+		report.Diperbaiki++
+		report.Tagihan = append(report.Tagihan, t)
+		if dryRun {
+			continue
+		}
+		if t.Cicilan > 0 {
+			if _, err := tx.Exec(`
+				INSERT INTO riwayat_pembayaran (pembayaran_id, kontrak_id, jumlah_dibayar, tanggal_bayar, metode_bayar, keterangan)
+				VALUES (?, (SELECT kontrak_id FROM pembayaran WHERE id=?), ?, (SELECT tanggal_bayar FROM pembayaran WHERE id=?),
+				        (SELECT metode_bayar FROM pembayaran WHERE id=?), 'Pembayaran awal (rekonsiliasi)')`,
+				t.PembayaranID, t.PembayaranID, t.Cicilan, t.PembayaranID, t.PembayaranID,
+			); err != nil {
+				return nil, fmt.Errorf("tagihan %d: %w", t.PembayaranID, err)
+			}
+		}
+		if err := sinkronPembayaran(tx, t.PembayaranID); err != nil {
+			return nil, fmt.Errorf("tagihan %d: %w", t.PembayaranID, err)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	return report, tx.Commit()
+}
+
+func runReconcileCommand(args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "tampilkan tagihan yang tidak cocok tanpa memperbaiki")
+	fs.Parse(args)
+
+	report, err := rekonsiliasiPembayaran(*dryRun)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TAGIHAN\tPENYEWA\tNOMINAL\tUANG DIBAYAR\tRIWAYAT\tCICILAN AWAL\tSTATUS")
+	for _, t := range report.Tagihan {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s -> %s\n", t.PembayaranID, t.NamaPenyewa, formatRupiah(t.Nominal),
+			formatRupiah(t.UangDibayar), formatRupiah(t.Riwayat), formatRupiah(t.Cicilan), t.StatusLama, t.StatusBaru)
+	}
+	w.Flush()
+	fmt.Printf("\n%d tagihan diperiksa, %d diperbaiki (dry-run: %v)\n", report.Diperiksa, report.Diperbaiki, report.DryRun)
+	return nil
+}
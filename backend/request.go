@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestInput menyatukan field dari body JSON maupun form multipart,
+// sehingga handler tidak perlu peduli Content-Type yang dikirim client.
+type requestInput struct {
+	values map[string]string
+	isJSON bool
+}
+
+// parseInput membaca body request. application/json di-decode menjadi
+// map field -> string, selain itu diperlakukan sebagai form (multipart
+// atau urlencoded) supaya upload file tetap jalan.
+func parseInput(c *gin.Context) (*requestInput, error) {
+	in := &requestInput{values: map[string]string{}}
+
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		in.isJSON = true
+
+		var raw map[string]interface{}
+		decoder := json.NewDecoder(c.Request.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+
+		for key, value := range raw {
+			switch v := value.(type) {
+			case nil:
+				in.values[key] = ""
+			case string:
+				in.values[key] = v
+			case json.Number:
+				in.values[key] = v.String()
+			case bool:
+				if v {
+					in.values[key] = "true"
+				} else {
+					in.values[key] = "false"
+				}
+			default:
+				return nil, fmt.Errorf("field %s must be a string, number or boolean", key)
+			}
+		}
+		return in, nil
+	}
+
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
+			return nil, err
+		}
+	} else if err := c.Request.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	for key, list := range c.Request.PostForm {
+		if len(list) > 0 {
+			in.values[key] = list[0]
+		}
+	}
+	return in, nil
+}
+
+// Get mengembalikan nilai field, atau string kosong jika tidak dikirim.
+func (in *requestInput) Get(key string) string {
+	return in.values[key]
+}
+
+// Has membedakan field yang tidak dikirim dengan field yang dikirim kosong.
+func (in *requestInput) Has(key string) bool {
+	_, ok := in.values[key]
+	return ok
+}
+
+// patchField memetakan nama field request ke kolom database.
+type patchField struct {
+	Field  string
+	Column string
+	// Convert opsional untuk menormalkan nilai sebelum disimpan
+	Convert func(string) string
+	// Nullable menyimpan nilai kosong sebagai NULL, bukan string kosong
+	Nullable bool
+}
+
+// buildPatch menyusun klausa "kolom=?" hanya untuk field yang dikirim,
+// dipakai oleh handler PATCH agar kolom lain tidak ikut tertimpa.
+func buildPatch(in *requestInput, fields []patchField) ([]string, []interface{}) {
+	var sets []string
+	var args []interface{}
+
+	for _, f := range fields {
+		if !in.Has(f.Field) {
+			continue
+		}
+		value := in.Get(f.Field)
+		if f.Convert != nil {
+			value = f.Convert(value)
+		}
+		sets = append(sets, f.Column+"=?")
+		if value == "" && f.Nullable {
+			args = append(args, nil)
+		} else {
+			args = append(args, value)
+		}
+	}
+
+	return sets, args
+}
+
+// dokumenDir menyimpan file pribadi (tanda tangan, surat perjanjian) di luar
+// ./uploads supaya tidak ikut tersaji lewat /uploads.
+const dokumenDir = "./dokumen"
+
+// saveUpload menyimpan file dari field form ke ./uploads/<subdir> dan
+// mengembalikan path publiknya. Jika field tidak ada, path kosong dan
+// error nil.
+func saveUpload(c *gin.Context, field, subdir string) (string, error) {
+	file, err := c.FormFile(field)
+	if err != nil {
+		return "", nil
+	}
+
+	uploadDir := filepath.Join("./uploads", subdir)
+	if err := os.MkdirAll(uploadDir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	filename := time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
+	savePath := filepath.Join(uploadDir, filename)
+	if err := c.SaveUploadedFile(file, savePath); err != nil {
+		return "", err
+	}
+
+	return "/uploads/" + subdir + "/" + filename, nil
+}
+
+// requiredFields mengembalikan FieldError untuk setiap field wajib yang
+// kosong atau tidak dikirim.
+func requiredFields(in *requestInput, fields ...string) []FieldError {
+	var fieldErrors []FieldError
+	for _, field := range fields {
+		if in.Get(field) == "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Message: field + " wajib diisi"})
+		}
+	}
+	return fieldErrors
+}
+
+// numericFields memastikan field yang dikirim berisi angka.
+func numericFields(in *requestInput, fields ...string) []FieldError {
+	var fieldErrors []FieldError
+	for _, field := range fields {
+		value := in.Get(field)
+		if value == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Message: field + " harus berupa angka"})
+		}
+	}
+	return fieldErrors
+}
+
+// dateFields memastikan field tanggal yang dikirim bisa dibaca
+// (YYYY-MM-DD atau ISO 8601).
+func dateFields(in *requestInput, fields ...string) []FieldError {
+	var fieldErrors []FieldError
+	for _, field := range fields {
+		value := in.Get(field)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", convertDateFormat(value)); err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Message: field + " harus berformat YYYY-MM-DD"})
+		}
+	}
+	return fieldErrors
+}
+
+// oneOfField memastikan nilai field (jika dikirim) ada di daftar pilihan.
+func oneOfField(in *requestInput, field string, allowed []string) []FieldError {
+	value := in.Get(field)
+	if value == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return []FieldError{{Field: field, Message: field + " harus salah satu dari: " + strings.Join(allowed, ", ")}}
+}
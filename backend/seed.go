@@ -0,0 +1,352 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// seedOptions mengatur generator data demo. Dengan Seed dan Anchor yang
+// sama, data yang dihasilkan selalu identik.
+type seedOptions struct {
+	Seed    int64
+	Units   int
+	Tenants int
+	Months  int
+	Anchor  time.Time
+	Reset   bool
+}
+
+// seedAnchorDefault adalah bulan terakhir data demo jika -anchor tidak
+// diisi. Tanggal tetap, bukan bulan ini, supaya seed yang sama tetap
+// menghasilkan data yang sama kapan pun dijalankan.
+const seedAnchorDefault = "2026-01-01"
+
+var seedTipe = []struct {
+	Nama     string
+	HargaMin int
+	HargaMax int
+}{
+	{"Studio", 1200000, 1600000},
+	{"1 Kamar", 1800000, 2300000},
+	{"2 Kamar", 2500000, 3200000},
+	{"Paviliun", 3500000, 4500000},
+}
+
+var seedNamaDepan = []string{
+	"Ahmad", "Budi", "Citra", "Dewi", "Eko", "Fitri", "Gilang", "Hendra", "Indah", "Joko",
+	"Kartika", "Lestari", "Muhammad", "Nur", "Putri", "Rizki", "Sari", "Teguh", "Wahyu", "Yuni",
+}
+
+var seedNamaBelakang = []string{
+	"Pratama", "Saputra", "Wijaya", "Lestari", "Hidayat", "Nugroho", "Santoso", "Kurniawan",
+	"Permata", "Rahmawati", "Setiawan", "Siregar", "Nasution", "Simanjuntak", "Wibowo", "Utami",
+}
+
+// Kode wilayah (provinsi+kabupaten/kota+kecamatan) untuk 6 digit awal NIK
+var seedWilayah = []struct {
+	Kode   string
+	Alamat string
+}{
+	{"317101", "Gambir, Jakarta Pusat"},
+	{"317401", "Tebet, Jakarta Selatan"},
+	{"327301", "Sukasari, Kota Bandung"},
+	{"320101", "Cibinong, Kabupaten Bogor"},
+	{"357801", "Genteng, Kota Surabaya"},
+	{"337401", "Semarang Tengah, Kota Semarang"},
+	{"340401", "Depok, Kabupaten Sleman"},
+	{"367101", "Tangerang, Kota Tangerang"},
+}
+
+var seedJalan = []string{"Merdeka", "Sudirman", "Diponegoro", "Gatot Subroto", "Ahmad Yani", "Pahlawan", "Kenanga", "Melati"}
+
+var seedPrefixHP = []string{"811", "812", "813", "821", "822", "852", "853", "856", "857", "877", "878", "881", "895", "896"}
+
+var seedMetodeBayar = []string{"Transfer", "Transfer", "Tunai", "QRIS"}
+
+func runSeedCommand(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	seed := fs.Int64("seed", 1, "nilai seed; seed dan anchor yang sama menghasilkan data yang sama")
+	units := fs.Int("units", 12, "jumlah unit properti")
+	tenants := fs.Int("tenants", 9, "jumlah penyewa (maksimal sebanyak unit)")
+	months := fs.Int("months", 12, "lama riwayat kontrak dan pembayaran dalam bulan")
+	anchor := fs.String("anchor", seedAnchorDefault, "bulan terakhir data (YYYY-MM-DD)")
+	reset := fs.Bool("reset", false, "hapus SEMUA data di database sebelum mengisi data demo")
+	confirm := fs.String("confirm", "", "nama database tujuan, wajib bersama -reset sebagai konfirmasi")
+	fs.Parse(args)
+
+	opts := seedOptions{
+		Seed:    *seed,
+		Units:   *units,
+		Tenants: *tenants,
+		Months:  *months,
+		Reset:   *reset,
+	}
+
+	t, err := time.Parse("2006-01-02", *anchor)
+	if err != nil {
+		return fmt.Errorf("invalid -anchor: %w", err)
+	}
+	opts.Anchor = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	if opts.Tenants > opts.Units {
+		opts.Tenants = opts.Units
+	}
+	if opts.Months < 2 {
+		return fmt.Errorf("-months minimal 2")
+	}
+	if opts.Reset {
+		if err := konfirmasiReset(*confirm); err != nil {
+			return err
+		}
+	}
+
+	return seedDemoData(opts)
+}
+
+// konfirmasiReset memastikan -reset tidak mengosongkan database yang salah:
+// -confirm harus sama dengan nama database yang sedang tersambung.
+func konfirmasiReset(confirm string) error {
+	query := "SELECT DATABASE()"
+	if db.isPostgres() {
+		query = "SELECT current_database()"
+	}
+	var nama string
+	if err := db.QueryRow(query).Scan(&nama); err != nil {
+		return err
+	}
+	if confirm != nama {
+		return fmt.Errorf("-reset menghapus semua data di database %q; ulangi dengan -confirm %s jika memang database demo", nama, nama)
+	}
+	return nil
+}
+
+// resetDatabase menghapus semua baris dari tabel aplikasi dan file upload
+// hasil seed sebelumnya.
+func resetDatabase() error {
+	for i := len(tableOrder) - 1; i >= 0; i-- {
+		if _, err := db.Exec("DELETE FROM " + tableOrder[i]); err != nil {
+			return fmt.Errorf("reset %s: %w", tableOrder[i], err)
+		}
+	}
+	return os.RemoveAll("./uploads/seed")
+}
+
+func seedDemoData(opts seedOptions) error {
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	if opts.Reset {
+		log.Printf("Menghapus semua data sebelum seed...")
+		if err := resetDatabase(); err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// 1. Unit properti, dikelompokkan per blok A, B, C, ...
+	type unit struct {
+		ID        int64
+		HargaSewa int
+	}
+	var units []unit
+	for i := 0; i < opts.Units; i++ {
+		tipe := seedTipe[rng.Intn(len(seedTipe))]
+		harga := tipe.HargaMin + rng.Intn((tipe.HargaMax-tipe.HargaMin)/50000+1)*50000
+		nama := fmt.Sprintf("Unit %c%d", 'A'+i/4, i%4+1)
+
+		status := "kosong"
+		if i >= opts.Tenants && rng.Intn(4) == 0 {
+			status = "maintenance"
+		}
+
+		id, err := tx.InsertID(
+			"INSERT INTO properti (nama_unit, tipe, harga_sewa, status) VALUES (?, ?, ?, ?)",
+			nama, tipe.Nama, harga, status,
+		)
+		if err != nil {
+			return fmt.Errorf("insert properti: %w", err)
+		}
+		units = append(units, unit{ID: id, HargaSewa: harga})
+	}
+
+	// 2. Penyewa, masing-masing menempati satu unit
+	kwitansiCount := 0
+	for i := 0; i < opts.Tenants; i++ {
+		depan := seedNamaDepan[rng.Intn(len(seedNamaDepan))]
+		belakang := seedNamaBelakang[rng.Intn(len(seedNamaBelakang))]
+		perempuan := rng.Intn(2) == 0
+		wilayah := seedWilayah[rng.Intn(len(seedWilayah))]
+		lahir := time.Date(1970+rng.Intn(35), time.Month(1+rng.Intn(12)), 1+rng.Intn(28), 0, 0, 0, 0, time.UTC)
+
+		nama := depan + " " + belakang
+		nik := seedNIK(rng, wilayah.Kode, lahir, perempuan)
+		telepon := fmt.Sprintf("+62%s%08d", seedPrefixHP[rng.Intn(len(seedPrefixHP))], rng.Intn(100000000))
+		email := fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(depan), strings.ToLower(belakang), rng.Intn(100))
+		alamat := fmt.Sprintf("Jl. %s No. %d, %s", seedJalan[rng.Intn(len(seedJalan))], 1+rng.Intn(200), wilayah.Alamat)
+
+		u := units[i]
+		// Kontrak dimulai antara awal periode seed dan 2 bulan sebelum anchor
+		startOffset := rng.Intn(opts.Months-1) + 2
+		mulai := opts.Anchor.AddDate(0, -startOffset+1, rng.Intn(28))
+		jatuhTempo := opts.Anchor.AddDate(0, 1, mulai.Day()-1)
+
+		penyewaID, err := tx.InsertID(`
+			INSERT INTO penyewa (nama, nik, email, telepon, alamat, properti_id, mulai_kontrak, jatuh_tempo, status_bayar)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'belum_bayar')`,
+			nama, nik, email, telepon, alamat, u.ID, mulai.Format("2006-01-02"), jatuhTempo.Format("2006-01-02"),
+		)
+		if err != nil {
+			return fmt.Errorf("insert penyewa: %w", err)
+		}
+		if _, err := tx.Exec("UPDATE properti SET status='terisi' WHERE id=?", u.ID); err != nil {
+			return err
+		}
+
+		// Kontrak setahun dengan deposit satu bulan sewa
+		kontrakID, err := tx.InsertID(`
+			INSERT INTO kontrak (penyewa_id, properti_id, tanggal_mulai, tanggal_akhir, periode_tagihan, harga_sewa, deposit, status)
+			VALUES (?, ?, ?, ?, 'bulanan', ?, ?, 'aktif')`,
+			penyewaID, u.ID, mulai.Format("2006-01-02"), mulai.AddDate(1, 0, -1).Format("2006-01-02"), u.HargaSewa, u.HargaSewa,
+		)
+		if err != nil {
+			return fmt.Errorf("insert kontrak: %w", err)
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO deposit_transaksi (kontrak_id, jenis, nominal, tanggal, metode_bayar, keterangan)
+			VALUES (?, 'terima', ?, ?, 'Transfer', 'Deposit awal (data demo)')`,
+			kontrakID, u.HargaSewa, mulai.Format("2006-01-02"),
+		); err != nil {
+			return fmt.Errorf("insert deposit: %w", err)
+		}
+		if err := sinkronHunian(tx, kontrakID, mulai.Format("2006-01-02")); err != nil {
+			return fmt.Errorf("insert riwayat hunian: %w", err)
+		}
+
+		// 3. Tagihan bulanan dari awal kontrak sampai bulan anchor, dengan
+		// sebagian tagihan dibayar dicicil atau belum dibayar sama sekali.
+		for periode := mulai; !periode.After(opts.Anchor.AddDate(0, 1, -1)); periode = periode.AddDate(0, 1, 0) {
+			akhir := periode.AddDate(0, 1, -1)
+			bulanTerakhir := periode.AddDate(0, 1, 0).After(opts.Anchor)
+
+			var cicilan []int
+			switch r := rng.Intn(10); {
+			case bulanTerakhir && r < 4:
+				// belum dibayar
+			case r < 2:
+				persen := 40 + rng.Intn(50)
+				cicilan = []int{u.HargaSewa * persen / 100 / 1000 * 1000}
+			case r < 4:
+				pertama := u.HargaSewa / 2 / 1000 * 1000
+				cicilan = []int{pertama, u.HargaSewa - pertama}
+			default:
+				cicilan = []int{u.HargaSewa}
+			}
+
+			dibayar := 0
+			for _, jumlah := range cicilan {
+				dibayar += jumlah
+			}
+			status := statusDariDibayar(float64(u.HargaSewa), float64(dibayar))
+			metode := seedMetodeBayar[rng.Intn(len(seedMetodeBayar))]
+
+			pembayaranID, err := tx.InsertID(`
+				INSERT INTO pembayaran (penyewa_id, kontrak_id, nominal, uang_dibayar, tanggal_bayar, tanggal_mulai, tanggal_akhir,
+				                        periode_mulai, jatuh_tempo, metode_bayar, status, keterangan)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				penyewaID, kontrakID, u.HargaSewa, dibayar, periode.Format("2006-01-02"), periode.Format("2006-01-02"), akhir.Format("2006-01-02"),
+				periode.Format("2006-01-02"), periode.Format("2006-01-02"), metode, status, fmt.Sprintf("Sewa %s (data demo)", formatBulan(periode)),
+			)
+			if err != nil {
+				return fmt.Errorf("insert pembayaran: %w", err)
+			}
+			if err := simpanItemSewa(tx, pembayaranID, deskripsiSewa(periode, 1), 1, float64(u.HargaSewa), float64(u.HargaSewa)); err != nil {
+				return fmt.Errorf("insert tagihan_item: %w", err)
+			}
+
+			for n, jumlah := range cicilan {
+				kwitansiCount++
+				kwitansiPath, err := writeSeedKwitansi(rng, kwitansiCount)
+				if err != nil {
+					return err
+				}
+				tanggal := periode.AddDate(0, 0, rng.Intn(7)+n*10)
+				if _, err := tx.Exec(`
+					INSERT INTO riwayat_pembayaran (pembayaran_id, kontrak_id, jumlah_dibayar, tanggal_bayar, metode_bayar, kwitansi_path, keterangan)
+					VALUES (?, ?, ?, ?, ?, ?, ?)`,
+					pembayaranID, kontrakID, jumlah, tanggal.Format("2006-01-02 15:04:05"), metode, kwitansiPath,
+					fmt.Sprintf("Cicilan ke-%d", n+1),
+				); err != nil {
+					return fmt.Errorf("insert riwayat_pembayaran: %w", err)
+				}
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Seed selesai: %d unit, %d penyewa, %d kwitansi (seed=%d, anchor=%s)",
+		opts.Units, opts.Tenants, kwitansiCount, opts.Seed, opts.Anchor.Format("2006-01"))
+	return nil
+}
+
+// seedNIK membuat NIK 16 digit dengan format resmi: kode wilayah (6),
+// tanggal lahir DDMMYY (tanggal +40 untuk perempuan), dan nomor urut (4).
+func seedNIK(rng *rand.Rand, kodeWilayah string, lahir time.Time, perempuan bool) string {
+	tanggal := lahir.Day()
+	if perempuan {
+		tanggal += 40
+	}
+	return fmt.Sprintf("%s%02d%02d%02d%04d", kodeWilayah, tanggal, int(lahir.Month()), lahir.Year()%100, 1+rng.Intn(9999))
+}
+
+// writeSeedKwitansi menyimpan gambar PNG sederhana sebagai pengganti foto
+// kwitansi, supaya halaman detail pembayaran punya gambar untuk ditampilkan.
+func writeSeedKwitansi(rng *rand.Rand, n int) (string, error) {
+	dir := "./uploads/seed/kwitansi"
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 320, 200))
+	paper := color.RGBA{250, 247, 235, 255}
+	ink := color.RGBA{40, 60, 140, 255}
+	accent := color.RGBA{uint8(150 + rng.Intn(100)), 60, 60, 255}
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 320; x++ {
+			switch {
+			case y < 30:
+				img.Set(x, y, accent)
+			case y%28 == 0 && x > 20 && x < 300:
+				img.Set(x, y, ink)
+			default:
+				img.Set(x, y, paper)
+			}
+		}
+	}
+
+	filename := fmt.Sprintf("kwitansi-%04d.png", n)
+	f, err := os.Create(filepath.Join(dir, filename))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		return "", err
+	}
+	return "/uploads/seed/kwitansi/" + filename, nil
+}
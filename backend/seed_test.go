@@ -0,0 +1,34 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSeedNIK(t *testing.T) {
+	lahir := time.Date(1992, time.March, 7, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		perempuan bool
+		prefix    string
+	}{
+		{"laki-laki", false, "327301070392"},
+		{"perempuan", true, "327301470392"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nik := seedNIK(rand.New(rand.NewSource(1)), "327301", lahir, tt.perempuan)
+			if len(nik) != 16 || nik[:12] != tt.prefix {
+				t.Fatalf("seedNIK = %s, want prefix %s and 16 digits", nik, tt.prefix)
+			}
+		})
+	}
+
+	// Seed yang sama menghasilkan NIK yang sama
+	a := seedNIK(rand.New(rand.NewSource(42)), "327301", lahir, false)
+	b := seedNIK(rand.New(rand.NewSource(42)), "327301", lahir, false)
+	if a != b {
+		t.Fatalf("seedNIK not deterministic: %s vs %s", a, b)
+	}
+}
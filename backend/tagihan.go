@@ -0,0 +1,499 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// periodeBulan adalah panjang satu periode tagihan dalam bulan.
+var periodeBulan = map[string]int{
+	"bulanan":  1,
+	"triwulan": 3,
+	"semester": 6,
+	"tahunan":  12,
+}
+
+// addMonths menambah n bulan dengan pembulatan ke akhir bulan:
+// 31 Jan + 1 bulan = 28/29 Feb, bukan 2/3 Maret seperti time.AddDate.
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+// dateOnly membuang jam dan zona waktu supaya tanggal dari MySQL (Local)
+// dan PostgreSQL (UTC) bisa dibandingkan langsung.
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// tagihanPeriode mengembalikan awal dan akhir periode ke-n sebuah kontrak.
+// Periode selalu dihitung dari tanggal mulai kontrak supaya tanggal tidak
+// bergeser (31 Jan -> 28 Feb -> 31 Mar, bukan 28 Mar).
+func tagihanPeriode(mulai time.Time, bulan, n int) (time.Time, time.Time) {
+	return addMonths(mulai, n*bulan), addMonths(mulai, (n+1)*bulan).AddDate(0, 0, -1)
+}
+
+// periodeKontrak seperti tagihanPeriode, tetapi untuk kontrak dengan
+// hari_tagihan (1-28) yang berbeda dari tanggal mulai: periode pertama
+// berjalan dari tanggal mulai sampai sehari sebelum tanggal tagih
+// berikutnya, lalu periode berikutnya dimulai di tanggal tagih. hariPenuh
+// adalah jumlah hari periode utuh, dasar prorata periode pertama.
+func periodeKontrak(mulai time.Time, hariTagihan, bulan, n int) (awal, akhir time.Time, hariPenuh int) {
+	if hariTagihan <= 0 || mulai.Day() == hariTagihan {
+		awal, akhir = tagihanPeriode(mulai, bulan, n)
+		return awal, akhir, selisihHari(awal, akhir) + 1
+	}
+
+	tagih := time.Date(mulai.Year(), mulai.Month(), hariTagihan, 0, 0, 0, 0, time.UTC)
+	if !tagih.After(mulai) {
+		tagih = addMonths(tagih, 1)
+	}
+	if n == 0 {
+		return mulai, tagih.AddDate(0, 0, -1), selisihHari(addMonths(tagih, -bulan), tagih)
+	}
+	awal, akhir = tagihanPeriode(tagih, bulan, n-1)
+	return awal, akhir, selisihHari(awal, akhir) + 1
+}
+
+// prorata menghitung sewa untuk hari terisi dari periode utuh.
+func prorata(hargaPeriode float64, hari, hariPenuh int) float64 {
+	if hariPenuh <= 0 || hari >= hariPenuh {
+		return hargaPeriode
+	}
+	return math.Round(hargaPeriode*float64(hari)/float64(hariPenuh)*100) / 100
+}
+
+type tagihanBaru struct {
+	KontrakID    int64   `json:"kontrak_id"`
+	PembayaranID int64   `json:"pembayaran_id,omitempty"`
+	NamaPenyewa  string  `json:"nama_penyewa"`
+	PeriodeMulai string  `json:"periode_mulai"`
+	PeriodeAkhir string  `json:"periode_akhir"`
+	Nominal      float64 `json:"nominal"`
+	Sewa         float64 `json:"sewa"`
+	HariProrata  int     `json:"hari_prorata,omitempty"`
+	HariPeriode  int     `json:"hari_periode,omitempty"`
+	Utilitas     float64 `json:"utilitas,omitempty"`
+	Kredit       float64 `json:"kredit,omitempty"`
+}
+
+type tagihanReport struct {
+	Tanggal  string        `json:"tanggal"`
+	DryRun   bool          `json:"dry_run"`
+	Kontrak  int           `json:"kontrak"`
+	Dibuat   int           `json:"dibuat"`
+	Dilewati int           `json:"dilewati"`
+	Tagihan  []tagihanBaru `json:"tagihan"`
+}
+
+type kontrakAktif struct {
+	id          int64
+	penyewaID   int64
+	propertiID  sql.NullInt64
+	namaPenyewa string
+	mulai       time.Time
+	akhir       sql.NullTime
+	bulan       int
+	hariTagihan int
+	hargaSewa   float64
+}
+
+// periodeTerisi adalah rentang tanggal yang sudah punya tagihan.
+type periodeTerisi struct {
+	periodeMulai sql.NullTime
+	mulai, akhir time.Time
+}
+
+// generateTagihan membuat tagihan untuk setiap periode kontrak aktif yang
+// sudah dimulai per tanggal asOf dan belum punya tagihan. Aman dijalankan
+// berulang: periode yang sudah ditagih dilewati, dan UNIQUE
+// (kontrak_id, periode_mulai) mencegah duplikat jika dua proses berjalan
+// bersamaan. Nominal memakai harga_sewa unit saat tagihan dibuat.
+func generateTagihan(asOf time.Time, dryRun bool) (*tagihanReport, error) {
+	asOf = dateOnly(asOf)
+	report := &tagihanReport{Tanggal: asOf.Format("2006-01-02"), DryRun: dryRun, Tagihan: []tagihanBaru{}}
+
+	kontrakList, err := loadKontrakAktif(asOf)
+	if err != nil {
+		return nil, err
+	}
+	report.Kontrak = len(kontrakList)
+
+	for _, k := range kontrakList {
+		terisi, err := loadPeriodeTerisi(k.id)
+		if err != nil {
+			return nil, err
+		}
+		dibuat := false
+
+		for n := 0; ; n++ {
+			mulai, akhir, hariPenuh := periodeKontrak(k.mulai, k.hariTagihan, k.bulan, n)
+			if mulai.After(asOf) {
+				break
+			}
+			if k.akhir.Valid {
+				akhirKontrak := dateOnly(k.akhir.Time)
+				if mulai.After(akhirKontrak) {
+					break
+				}
+				if akhir.After(akhirKontrak) {
+					akhir = akhirKontrak
+				}
+			}
+			if sudahDitagih(terisi, mulai) {
+				report.Dilewati++
+				continue
+			}
+
+			// Periode pertama yang terpotong tanggal tagih dan periode
+			// terakhir yang terpotong akhir kontrak diprorata per hari
+			tagihan := tagihanBaru{
+				KontrakID:    k.id,
+				NamaPenyewa:  k.namaPenyewa,
+				PeriodeMulai: mulai.Format("2006-01-02"),
+				PeriodeAkhir: akhir.Format("2006-01-02"),
+				Sewa:         k.hargaSewa * float64(k.bulan),
+			}
+			if hari := selisihHari(mulai, akhir) + 1; hari < hariPenuh {
+				tagihan.Sewa = prorata(tagihan.Sewa, hari, hariPenuh)
+				tagihan.HariProrata, tagihan.HariPeriode = hari, hariPenuh
+			}
+			tagihan.Nominal = tagihan.Sewa
+			if !dryRun {
+				err := insertTagihan(k, &tagihan)
+				if isUniqueViolation(err) {
+					report.Dilewati++
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("kontrak %d periode %s: %w", k.id, tagihan.PeriodeMulai, err)
+				}
+			}
+			report.Dibuat++
+			report.Tagihan = append(report.Tagihan, tagihan)
+			dibuat = true
+		}
+
+		if dibuat && !dryRun {
+			if err := recalcJatuhTempo(db, k.id); err != nil {
+				return nil, fmt.Errorf("kontrak %d: %w", k.id, err)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// loadKontrakAktif hanya mengambil kontrak berstatus aktif; kontrak yang
+// berakhir atau diputus tidak pernah ditagih lagi.
+func loadKontrakAktif(asOf time.Time) ([]kontrakAktif, error) {
+	rows, err := db.Query(`
+		SELECT k.id, k.penyewa_id, k.properti_id, COALESCE(py.nama, ''), k.tanggal_mulai, k.tanggal_akhir,
+		       k.periode_tagihan, COALESCE(k.hari_tagihan, 0), COALESCE(pr.harga_sewa, k.harga_sewa)
+		FROM kontrak k
+		LEFT JOIN penyewa py ON py.id = k.penyewa_id
+		LEFT JOIN properti pr ON pr.id = k.properti_id
+		WHERE k.status = 'aktif' AND k.tanggal_mulai <= ?
+		ORDER BY k.id`, asOf.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []kontrakAktif
+	for rows.Next() {
+		var k kontrakAktif
+		var periode string
+		if err := rows.Scan(&k.id, &k.penyewaID, &k.propertiID, &k.namaPenyewa, &k.mulai, &k.akhir, &periode, &k.hariTagihan, &k.hargaSewa); err != nil {
+			return nil, err
+		}
+		k.mulai = dateOnly(k.mulai)
+		k.bulan = periodeBulan[periode]
+		if k.bulan == 0 {
+			k.bulan = 1
+		}
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+func loadPeriodeTerisi(kontrakID int64) ([]periodeTerisi, error) {
+	rows, err := db.Query(`
+		SELECT periode_mulai, COALESCE(tanggal_mulai, tanggal_bayar), COALESCE(tanggal_akhir, tanggal_mulai, tanggal_bayar)
+		FROM pembayaran WHERE kontrak_id = ?`, kontrakID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []periodeTerisi
+	for rows.Next() {
+		var p periodeTerisi
+		if err := rows.Scan(&p.periodeMulai, &p.mulai, &p.akhir); err != nil {
+			return nil, err
+		}
+		p.mulai, p.akhir = dateOnly(p.mulai), dateOnly(p.akhir)
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// sudahDitagih: periode dianggap sudah ditagih jika ada tagihan generator
+// untuk periode itu, atau tagihan manual yang rentangnya mencakup awal
+// periode (misalnya kontrak lama yang dibayar sekaligus setahun).
+func sudahDitagih(terisi []periodeTerisi, mulai time.Time) bool {
+	for _, p := range terisi {
+		if p.periodeMulai.Valid {
+			if dateOnly(p.periodeMulai.Time).Equal(mulai) {
+				return true
+			}
+			continue
+		}
+		if !mulai.Before(p.mulai) && !mulai.After(p.akhir) {
+			return true
+		}
+	}
+	return false
+}
+
+// insertTagihan membuat tagihan beserta rinciannya: sewa, biaya tambahan
+// unit, diskon, dan bacaan meter yang belum ditagih sampai awal periode. Nominal
+// tagihan adalah jumlah rincian. Saldo kredit penyewa langsung dipakai untuk
+// membayar tagihan baru. PembayaranID, Nominal, Utilitas, dan Kredit t diisi
+// dari hasilnya.
+func insertTagihan(k kontrakAktif, t *tagihanBaru) error {
+	mulai, _ := time.Parse("2006-01-02", t.PeriodeMulai)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id, err := tx.InsertID(`
+		INSERT INTO pembayaran (penyewa_id, kontrak_id, nominal, uang_dibayar, tanggal_bayar, tanggal_mulai, tanggal_akhir,
+		                        periode_mulai, jatuh_tempo, status, keterangan)
+		VALUES (?, ?, ?, 0, ?, ?, ?, ?, ?, 'pending', ?)`,
+		k.penyewaID, k.id, t.Nominal, t.PeriodeMulai, t.PeriodeMulai, t.PeriodeAkhir,
+		t.PeriodeMulai, t.PeriodeMulai, "Tagihan sewa "+formatBulan(mulai),
+	)
+	if err != nil {
+		return err
+	}
+	if t.HariProrata > 0 {
+		err = simpanItemSewaProrata(tx, id, mulai, k.bulan, t.HariProrata, t.HariPeriode, t.Sewa)
+	} else {
+		err = simpanItemSewa(tx, id, deskripsiSewa(mulai, k.bulan), float64(k.bulan), k.hargaSewa, t.Sewa)
+	}
+	if err != nil {
+		return err
+	}
+	pertama, err := tagihanPertama(tx, k.id, id)
+	if err != nil {
+		return err
+	}
+	if err := tambahBiayaTagihan(tx, id, k.propertiID, k.bulan, pertama); err != nil {
+		return err
+	}
+	if err := terapkanDiskon(tx, id); err != nil {
+		return err
+	}
+
+	var utilitas float64
+	if k.propertiID.Valid {
+		if utilitas, err = tagihUtilitas(tx, id, k.propertiID.Int64, t.PeriodeMulai); err != nil {
+			return err
+		}
+	}
+	total, err := hitungTotalTagihan(tx, id)
+	if err != nil {
+		return err
+	}
+	kredit, err := pakaiSaldoKredit(tx, k.penyewaID, id, t.PeriodeMulai)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	t.PembayaranID, t.Nominal, t.Utilitas, t.Kredit = id, total, utilitas, kredit
+	return nil
+}
+
+// startTagihanScheduler menjalankan generateTagihan dan terapkanDenda saat
+// server start lalu setiap interval, sehingga tagihan dan denda muncul tidak
+// lama setelah periode baru dimulai atau jatuh tempo terlewati.
+func startTagihanScheduler(interval time.Duration) {
+	go func() {
+		for {
+			report, err := generateTagihan(time.Now(), false)
+			if err != nil {
+				log.Printf("Scheduler tagihan gagal: %v", err)
+			} else if report.Dibuat > 0 {
+				log.Printf("Scheduler tagihan: %d tagihan baru dari %d kontrak aktif", report.Dibuat, report.Kontrak)
+			}
+			denda, err := terapkanDenda(time.Now(), false)
+			if err != nil {
+				log.Printf("Scheduler denda gagal: %v", err)
+			} else if denda.Dibuat+denda.Diperbarui > 0 {
+				log.Printf("Scheduler denda: %d denda baru, %d diperbarui", denda.Dibuat, denda.Diperbarui)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// tagihanSchedulerInterval membaca TAGIHAN_INTERVAL (default 1h).
+// Scheduler jalan secara default dan dimatikan dengan TAGIHAN_SCHEDULER=off,
+// misalnya sambil memeriksa generate-bills -dry-run untuk kontrak hasil
+// backfill penyewa lama yang bisa punya banyak periode tanpa tagihan.
+func tagihanSchedulerInterval() (time.Duration, bool) {
+	if os.Getenv("TAGIHAN_SCHEDULER") == "off" {
+		return 0, false
+	}
+	interval := time.Hour
+	if raw := os.Getenv("TAGIHAN_INTERVAL"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < time.Minute {
+			log.Printf("TAGIHAN_INTERVAL %q tidak valid, memakai 1h", raw)
+		} else {
+			interval = parsed
+		}
+	}
+	return interval, true
+}
+
+func runGenerateBillsCommand(args []string) error {
+	fs := flag.NewFlagSet("generate-bills", flag.ExitOnError)
+	date := fs.String("date", time.Now().Format("2006-01-02"), "buat tagihan untuk periode yang sudah dimulai per tanggal ini (YYYY-MM-DD)")
+	dryRun := fs.Bool("dry-run", false, "tampilkan tagihan yang akan dibuat tanpa menyimpan")
+	fs.Parse(args)
+
+	asOf, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		return fmt.Errorf("-date harus berformat YYYY-MM-DD")
+	}
+
+	report, err := generateTagihan(asOf, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KONTRAK\tPENYEWA\tPERIODE\tNOMINAL\tID")
+	for _, t := range report.Tagihan {
+		id := "-"
+		if t.PembayaranID > 0 {
+			id = strconv.FormatInt(t.PembayaranID, 10)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s s/d %s\t%s\t%s\n", t.KontrakID, t.NamaPenyewa, t.PeriodeMulai, t.PeriodeAkhir, formatRupiah(t.Nominal), id)
+	}
+	w.Flush()
+	fmt.Printf("\n%d kontrak aktif, %d tagihan dibuat, %d periode sudah ditagih (dry-run: %v)\n",
+		report.Kontrak, report.Dibuat, report.Dilewati, report.DryRun)
+	return nil
+}
+
+// TAGIHAN HANDLERS
+func getTagihan(c *gin.Context) {
+	filter := tagihanFilter(c)
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT pb.id, COALESCE(pb.kontrak_id, 0), pb.penyewa_id, COALESCE(py.nama, ''), COALESCE(pr.nama_unit, ''),
+		       pb.periode_mulai, COALESCE(pb.tanggal_mulai, pb.tanggal_bayar), pb.tanggal_akhir, pb.jatuh_tempo,
+		       pb.nominal, COALESCE(pb.uang_dibayar, pb.nominal), pb.status, COALESCE(pb.keterangan, ''),
+		       (SELECT COALESCE(SUM(d.nominal), 0) FROM denda d WHERE d.pembayaran_id = pb.id AND d.status = 'aktif')
+		FROM pembayaran pb
+		LEFT JOIN kontrak k ON k.id = pb.kontrak_id
+		LEFT JOIN penyewa py ON py.id = pb.penyewa_id
+		LEFT JOIN properti pr ON pr.id = k.properti_id`+filter.where()+`
+		ORDER BY pb.jatuh_tempo DESC, pb.id DESC`, filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	tagihan := []gin.H{}
+	for rows.Next() {
+		var id, kontrakID, penyewaID int64
+		var nama, unit, status, keterangan string
+		var periodeMulai, mulai, akhir, jatuhTempo sql.NullTime
+		var nominal, dibayar, denda float64
+		if err := rows.Scan(&id, &kontrakID, &penyewaID, &nama, &unit, &periodeMulai, &mulai, &akhir, &jatuhTempo,
+			&nominal, &dibayar, &status, &keterangan, &denda); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		tagihan = append(tagihan, gin.H{
+			"id":            id,
+			"kontrak_id":    kontrakID,
+			"penyewa_id":    penyewaID,
+			"nama_penyewa":  nama,
+			"nama_unit":     unit,
+			"periode_mulai": dateString(periodeMulai),
+			"tanggal_mulai": dateString(mulai),
+			"tanggal_akhir": dateString(akhir),
+			"jatuh_tempo":   dateString(jatuhTempo),
+			"nominal":       nominal,
+			"uang_dibayar":  dibayar,
+			"sisa":          nominal - dibayar,
+			"denda":         denda,
+			"status":        status,
+			"keterangan":    keterangan,
+			"otomatis":      periodeMulai.Valid,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tagihan)
+}
+
+// POST /api/tagihan/generate menjalankan generator secara manual
+// (tanggal opsional, dry_run=true untuk preview).
+func generateTagihanHandler(c *gin.Context) {
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := dateFields(in, "tanggal"); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	asOf := time.Now()
+	if tanggal := in.Get("tanggal"); tanggal != "" {
+		asOf, _ = time.Parse("2006-01-02", convertDateFormat(tanggal))
+	}
+
+	report, err := generateTagihan(asOf, in.Get("dry_run") == "true")
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func tanggal(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		from string
+		n    int
+		want string
+	}{
+		{"2026-01-15", 1, "2026-02-15"},
+		{"2026-01-31", 1, "2026-02-28"},
+		{"2028-01-31", 1, "2028-02-29"},
+		{"2026-03-31", 1, "2026-04-30"},
+		{"2026-11-30", 3, "2027-02-28"},
+		{"2026-12-31", 12, "2027-12-31"},
+		{"2026-03-31", -1, "2026-02-28"},
+		{"2026-01-10", 0, "2026-01-10"},
+	}
+	for _, tt := range tests {
+		got := addMonths(tanggal(tt.from), tt.n).Format("2006-01-02")
+		if got != tt.want {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", tt.from, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestTagihanPeriode(t *testing.T) {
+	tests := []struct {
+		mulai       string
+		bulan, n    int
+		awal, akhir string
+	}{
+		{"2026-01-31", 1, 0, "2026-01-31", "2026-02-27"},
+		{"2026-01-31", 1, 1, "2026-02-28", "2026-03-30"},
+		{"2026-01-31", 1, 2, "2026-03-31", "2026-04-29"},
+		{"2026-01-01", 1, 11, "2026-12-01", "2026-12-31"},
+		{"2026-01-15", 3, 1, "2026-04-15", "2026-07-14"},
+		{"2026-02-01", 12, 0, "2026-02-01", "2027-01-31"},
+	}
+	for _, tt := range tests {
+		awal, akhir := tagihanPeriode(tanggal(tt.mulai), tt.bulan, tt.n)
+		if awal.Format("2006-01-02") != tt.awal || akhir.Format("2006-01-02") != tt.akhir {
+			t.Errorf("tagihanPeriode(%s, %d, %d) = %s..%s, want %s..%s",
+				tt.mulai, tt.bulan, tt.n, awal.Format("2006-01-02"), akhir.Format("2006-01-02"), tt.awal, tt.akhir)
+		}
+	}
+}
+
+func TestSudahDitagih(t *testing.T) {
+	terisi := []periodeTerisi{
+		{periodeMulai: sql.NullTime{Time: tanggal("2026-03-01"), Valid: true}, mulai: tanggal("2026-03-01"), akhir: tanggal("2026-03-31")},
+		// Tagihan manual setahun penuh tanpa periode_mulai
+		{mulai: tanggal("2025-01-01"), akhir: tanggal("2025-12-31")},
+	}
+	tests := []struct {
+		mulai string
+		want  bool
+	}{
+		{"2026-03-01", true},
+		{"2026-03-15", false},
+		{"2025-06-01", true},
+		{"2025-12-31", true},
+		{"2026-01-01", false},
+	}
+	for _, tt := range tests {
+		if got := sudahDitagih(terisi, tanggal(tt.mulai)); got != tt.want {
+			t.Errorf("sudahDitagih(%s) = %v, want %v", tt.mulai, got, tt.want)
+		}
+	}
+}
+
+func TestPeriodeKontrak(t *testing.T) {
+	tests := []struct {
+		name        string
+		mulai       string
+		hariTagihan int
+		bulan, n    int
+		awal, akhir string
+		hariPenuh   int
+	}{
+		{"tanpa hari tagihan", "2026-01-31", 0, 1, 0, "2026-01-31", "2026-02-27", 28},
+		{"hari tagihan sama dengan tanggal mulai", "2026-03-10", 10, 1, 1, "2026-04-10", "2026-05-09", 30},
+		{"periode pertama terpotong", "2026-01-20", 1, 1, 0, "2026-01-20", "2026-01-31", 31},
+		{"periode kedua mulai di tanggal tagih", "2026-01-20", 1, 1, 1, "2026-02-01", "2026-02-28", 28},
+		{"periode ketiga", "2026-01-20", 1, 1, 2, "2026-03-01", "2026-03-31", 31},
+		{"tanggal tagih di bulan yang sama", "2026-01-05", 25, 1, 0, "2026-01-05", "2026-01-24", 31},
+		{"triwulan terpotong", "2026-01-20", 1, 3, 0, "2026-01-20", "2026-01-31", 92},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			awal, akhir, hariPenuh := periodeKontrak(tanggal(tt.mulai), tt.hariTagihan, tt.bulan, tt.n)
+			if awal.Format("2006-01-02") != tt.awal || akhir.Format("2006-01-02") != tt.akhir || hariPenuh != tt.hariPenuh {
+				t.Fatalf("got %s..%s (%d hari), want %s..%s (%d hari)",
+					awal.Format("2006-01-02"), akhir.Format("2006-01-02"), hariPenuh, tt.awal, tt.akhir, tt.hariPenuh)
+			}
+		})
+	}
+}
+
+func TestProrata(t *testing.T) {
+	tests := []struct {
+		harga           float64
+		hari, hariPenuh int
+		want            float64
+	}{
+		{1000000, 12, 31, 387096.77},
+		{900000, 10, 30, 300000},
+		{1000000, 31, 31, 1000000},
+		{1000000, 40, 31, 1000000},
+		{1000000, 5, 0, 1000000},
+	}
+	for _, tt := range tests {
+		if got := prorata(tt.harga, tt.hari, tt.hariPenuh); got != tt.want {
+			t.Errorf("prorata(%v, %d, %d) = %v, want %v", tt.harga, tt.hari, tt.hariPenuh, got, tt.want)
+		}
+	}
+}
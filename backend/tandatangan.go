@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gambar tanda tangan perjanjian disimpan di dokumenDir (bukan ./uploads),
+// satu file per pihak per dokumen, dan hanya dikirim lewat
+// GET /api/kontrak/:id/perjanjian/:dokumenId/ttd/:pihak.
+var ttdPerjanjianDir = filepath.Join(dokumenDir, "ttd", "perjanjian")
+
+// Tanda tangan hasil gambar di canvas jarang lebih dari beberapa ratus KB.
+const maxUkuranTTD = 2 << 20
+
+var pihakTTDValid = []string{"pemilik", "penyewa"}
+
+func hashDokumen(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// bacaTTD membaca gambar tanda tangan dari file upload "ttd", atau dari
+// field "ttd" berisi data URL base64 (hasil canvas.toDataURL()). Hanya PNG
+// dan JPG yang diterima.
+func bacaTTD(c *gin.Context, in *requestInput) ([]byte, string, error) {
+	var raw []byte
+	if file, err := c.FormFile("ttd"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+		if raw, err = io.ReadAll(io.LimitReader(f, maxUkuranTTD+1)); err != nil {
+			return nil, "", err
+		}
+	} else if data := strings.TrimSpace(in.Get("ttd")); data != "" {
+		if i := strings.Index(data, ","); strings.HasPrefix(data, "data:") && i > 0 {
+			data = data[i+1:]
+		}
+		if raw, err = base64.StdEncoding.DecodeString(data); err != nil {
+			return nil, "", errors.New("ttd bukan data base64 yang valid")
+		}
+	} else {
+		return nil, "", errors.New("ttd wajib diisi")
+	}
+
+	if len(raw) > maxUkuranTTD {
+		return nil, "", errors.New("ttd maksimal 2 MB")
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(raw)); err == nil {
+		switch format {
+		case "png":
+			return raw, ".png", nil
+		case "jpeg":
+			return raw, ".jpg", nil
+		}
+	}
+	return nil, "", errors.New("ttd harus berupa gambar PNG atau JPG")
+}
+
+// dokumenTTD adalah dokumen perjanjian beserta tanda tangan yang sudah
+// masuk.
+type dokumenTTD struct {
+	ID       int64
+	FilePath string
+	SHA256   string
+	Dokumen  dokumenPerjanjian
+	Pihak    map[string]bool
+}
+
+// loadDokumenTTD mengunci baris dokumen sampai transaksi selesai supaya
+// dua pihak yang menandatangani bersamaan tidak saling menimpa PDF.
+func loadDokumenTTD(q querier, kontrakID, dokumenID string) (*dokumenTTD, error) {
+	dok := &dokumenTTD{Pihak: map[string]bool{}}
+	d := &dok.Dokumen
+	var created sql.NullTime
+	err := q.QueryRow(`
+		SELECT id, kontrak_id, COALESCE(file_path, ''), COALESCE(sha256, ''), COALESCE(judul, ''), COALESCE(isi, ''),
+		       COALESCE(nama_pemilik, ''), COALESCE(nama_penyewa, ''), created_at
+		FROM dokumen_kontrak
+		WHERE id=? AND kontrak_id=?
+		FOR UPDATE`, dokumenID, kontrakID).Scan(&dok.ID, &d.KontrakID, &dok.FilePath, &dok.SHA256, &d.Judul, &d.Isi,
+		&d.Pihak[0].Nama, &d.Pihak[1].Nama, &created)
+	if err != nil {
+		return nil, err
+	}
+	d.Tanggal = created.Time
+	d.Pihak[0].Sebutan = "PIHAK PERTAMA"
+	d.Pihak[1].Sebutan = "PIHAK KEDUA"
+
+	rows, err := q.Query(`
+		SELECT pihak, nama, ttd_path, ditandatangani_pada
+		FROM tanda_tangan_dokumen WHERE dokumen_id=?`, dok.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pihak, nama, path string
+		var waktu time.Time
+		if err := rows.Scan(&pihak, &nama, &path, &waktu); err != nil {
+			return nil, err
+		}
+		p := &d.Pihak[indexPihak(pihak)]
+		p.Nama, p.TTD, p.Waktu = nama, "."+path, waktu
+		dok.Pihak[pihak] = true
+	}
+	return dok, rows.Err()
+}
+
+// indexPihak: pemilik di kolom kiri (PIHAK PERTAMA), penyewa di kanan.
+func indexPihak(pihak string) int {
+	if pihak == "penyewa" {
+		return 1
+	}
+	return 0
+}
+
+// hashFile menghitung SHA-256 file upload dari path publiknya; string
+// kosong jika file tidak ada.
+func hashFile(path string) (string, error) {
+	raw, err := os.ReadFile("." + path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return hashDokumen(raw), nil
+}
+
+// POST /api/kontrak/:id/perjanjian/:dokumenId/ttd menambahkan tanda tangan
+// pemilik atau penyewa ke PDF perjanjian. PDF digambar ulang dari teks yang
+// disimpan saat dokumen dibuat, lalu hash, waktu, dan IP penanda tangan
+// dicatat. Setiap pihak hanya bisa menandatangani sekali.
+func tandaTanganiPerjanjian(c *gin.Context) {
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	fieldErrors := requiredFields(in, "pihak")
+	fieldErrors = append(fieldErrors, oneOfField(in, "pihak", pihakTTDValid)...)
+	ttd, ext, err := bacaTTD(c, in)
+	if err != nil {
+		fieldErrors = append(fieldErrors, FieldError{Field: "ttd", Message: err.Error()})
+	}
+	if len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	pihak := in.Get("pihak")
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	dok, err := loadDokumenTTD(tx, c.Param("id"), c.Param("dokumenId"))
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Dokumen perjanjian tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if dok.Dokumen.Isi == "" {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Perjanjian ini dibuat sebelum tanda tangan digital tersedia; buat ulang perjanjiannya", nil)
+		return
+	}
+	if dok.Pihak[pihak] {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Perjanjian sudah ditandatangani oleh "+pihak, nil)
+		return
+	}
+	// Tanda tangan hanya ditambahkan ke file yang belum diubah
+	if hash, err := hashFile(dok.FilePath); err != nil {
+		respondInternal(c, err)
+		return
+	} else if dok.SHA256 != "" && hash != dok.SHA256 {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "File perjanjian tidak cocok dengan hash yang tersimpan", nil)
+		return
+	}
+
+	if err := os.MkdirAll(ttdPerjanjianDir, os.ModePerm); err != nil {
+		respondInternal(c, err)
+		return
+	}
+	filename := fmt.Sprintf("dokumen-%d-%s%s", dok.ID, pihak, ext)
+	ttdPath := "/dokumen/ttd/perjanjian/" + filename
+	if err := os.WriteFile(filepath.Join(ttdPerjanjianDir, filename), ttd, 0o644); err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeUploadFailed, "Gagal menyimpan file", nil)
+		return
+	}
+	simpan := false
+	defer func() {
+		if !simpan {
+			os.Remove("." + ttdPath)
+		}
+	}()
+
+	waktu := time.Now()
+	ip := c.ClientIP()
+	p := &dok.Dokumen.Pihak[indexPihak(pihak)]
+	if nama := strings.TrimSpace(in.Get("nama")); nama != "" {
+		p.Nama = nama
+	}
+	p.TTD, p.Waktu = "."+ttdPath, waktu
+	pdf, err := renderPerjanjian(&dok.Dokumen)
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	hash := hashDokumen(pdf)
+
+	id, err := tx.InsertID(`
+		INSERT INTO tanda_tangan_dokumen (dokumen_id, pihak, nama, ttd_path, ip, sha256, ditandatangani_pada)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		dok.ID, pihak, p.Nama, ttdPath, ip, hash, waktu,
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if _, err := tx.Exec("UPDATE dokumen_kontrak SET sha256=? WHERE id=?", hash, dok.ID); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	// File baru ditulis di samping file lama dan baru menggantikannya
+	// setelah commit, supaya gagal simpan tidak merusak PDF sebelumnya
+	tmp := "." + dok.FilePath + ".tmp"
+	if err := os.WriteFile(tmp, pdf, 0o644); err != nil {
+		respondInternal(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		os.Remove(tmp)
+		respondDBError(c, err)
+		return
+	}
+	simpan = true
+	if err := os.Rename(tmp, "."+dok.FilePath); err != nil {
+		respondInternal(c, err)
+		return
+	}
+
+	dok.Pihak[pihak] = true
+	c.JSON(http.StatusCreated, gin.H{
+		"id":                  id,
+		"pihak":               pihak,
+		"nama":                p.Nama,
+		"ip":                  ip,
+		"sha256":              hash,
+		"ttd_url":             urlTTDPerjanjian(dok.Dokumen.KontrakID, dok.ID, pihak),
+		"ditandatangani_pada": waktu.Format(time.RFC3339),
+		"lengkap":             dok.Pihak["pemilik"] && dok.Pihak["penyewa"],
+		"file_path":           dok.FilePath,
+		"message":             "Tanda tangan berhasil disimpan",
+	})
+}
+
+// GET /api/kontrak/:id/perjanjian/:dokumenId/verifikasi membandingkan hash
+// file PDF sekarang dengan hash yang tersimpan.
+func verifikasiPerjanjian(c *gin.Context) {
+	var dokumenID int64
+	var path, tersimpan string
+	err := db.QueryRow(`
+		SELECT id, COALESCE(file_path, ''), COALESCE(sha256, '')
+		FROM dokumen_kontrak WHERE id=? AND kontrak_id=?`, c.Param("dokumenId"), c.Param("id")).Scan(&dokumenID, &path, &tersimpan)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Dokumen perjanjian tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT pihak, nama, ip, sha256, ditandatangani_pada
+		FROM tanda_tangan_dokumen WHERE dokumen_id=?
+		ORDER BY ditandatangani_pada, id`, dokumenID)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	tandaTangan := []gin.H{}
+	for rows.Next() {
+		var pihak, nama, ip, sha string
+		var waktu time.Time
+		if err := rows.Scan(&pihak, &nama, &ip, &sha, &waktu); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		tandaTangan = append(tandaTangan, gin.H{
+			"pihak":               pihak,
+			"nama":                nama,
+			"ip":                  ip,
+			"sha256":              sha,
+			"ditandatangani_pada": waktu.Format(time.RFC3339),
+			"ttd_url":             urlTTDPerjanjian(c.Param("id"), dokumenID, pihak),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dokumen_id":   dokumenID,
+		"file_path":    path,
+		"sha256":       tersimpan,
+		"sha256_file":  hash,
+		"utuh":         tersimpan != "" && hash == tersimpan,
+		"tanda_tangan": tandaTangan,
+	})
+}
+
+// urlTTDPerjanjian adalah endpoint untuk mengunduh gambar tanda tangan satu
+// pihak.
+func urlTTDPerjanjian(kontrakID interface{}, dokumenID int64, pihak string) string {
+	return fmt.Sprintf("/api/kontrak/%v/perjanjian/%d/ttd/%s", kontrakID, dokumenID, pihak)
+}
+
+// GET /api/kontrak/:id/perjanjian/:dokumenId/ttd/:pihak mengirim gambar
+// tanda tangan satu pihak.
+func unduhTTDPerjanjian(c *gin.Context) {
+	var path string
+	err := db.QueryRow(`
+		SELECT s.ttd_path FROM tanda_tangan_dokumen s
+		JOIN dokumen_kontrak d ON d.id = s.dokumen_id
+		WHERE s.dokumen_id=? AND d.kontrak_id=? AND s.pihak=?`,
+		c.Param("dokumenId"), c.Param("id"), c.Param("pihak")).Scan(&path)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Tanda tangan tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if _, err := os.Stat("." + path); err != nil {
+		respondNotFound(c, "File tanda tangan tidak ditemukan")
+		return
+	}
+
+	c.File("." + path)
+}
+
+// POST /api/perjanjian/verifikasi mencocokkan salinan PDF (field "file")
+// dengan dokumen yang pernah diterbitkan. Salinan dari tahap tanda tangan
+// sebelumnya tetap dikenali, tetapi ditandai bukan versi terakhir.
+func verifikasiSalinanPerjanjian(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		respondValidation(c, []FieldError{{Field: "file", Message: "File tidak ditemukan"}})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		respondInternal(c, err)
+		return
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	var dokumenID, kontrakID int64
+	err = db.QueryRow("SELECT id, kontrak_id FROM dokumen_kontrak WHERE sha256=?", hash).Scan(&dokumenID, &kontrakID)
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"sha256": hash, "utuh": true, "terbaru": true, "dokumen_id": dokumenID, "kontrak_id": kontrakID})
+		return
+	}
+	if err != sql.ErrNoRows {
+		respondDBError(c, err)
+		return
+	}
+	err = db.QueryRow(`
+		SELECT d.id, d.kontrak_id FROM tanda_tangan_dokumen s
+		JOIN dokumen_kontrak d ON d.id = s.dokumen_id
+		WHERE s.sha256=?`, hash).Scan(&dokumenID, &kontrakID)
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"sha256": hash, "utuh": true, "terbaru": false, "dokumen_id": dokumenID, "kontrak_id": kontrakID})
+		return
+	}
+	if err != sql.ErrNoRows {
+		respondDBError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sha256": hash, "utuh": false})
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TarifUtilitas adalah harga per kWh (listrik) atau per m³ (air) dengan
+// abonemen bulanan opsional. Tarif dengan properti_id berlaku untuk unit itu
+// saja; tarif tanpa properti_id berlaku global.
+type TarifUtilitas struct {
+	ID         int64   `json:"id"`
+	PropertiID int64   `json:"properti_id"`
+	NamaUnit   string  `json:"nama_unit"`
+	Jenis      string  `json:"jenis"`
+	Tarif      float64 `json:"tarif"`
+	Abonemen   float64 `json:"abonemen"`
+	Status     string  `json:"status"`
+	Keterangan string  `json:"keterangan"`
+}
+
+var (
+	jenisUtilitasValid = []string{"listrik", "air"}
+	namaUtilitas       = map[string]string{"listrik": "Listrik", "air": "Air"}
+	satuanUtilitas     = map[string]string{"listrik": "kWh", "air": "m³"}
+)
+
+// batasLonjakan: pemakaian lebih dari dua kali rata-rata tiga bacaan
+// terakhir ditandai sebagai lonjakan.
+const batasLonjakan = 2.0
+
+// Anomali bacaan meter. Bacaan mundur tidak punya pemakaian dan tidak
+// ditagih; anomali lain tetap ditagih tetapi perlu dicek admin.
+const (
+	anomaliMundur   = "mundur"
+	anomaliLonjakan = "lonjakan"
+	anomaliNol      = "nol"
+)
+
+// hitungPemakaian menghitung pemakaian dari bacaan sebelumnya. Bacaan
+// pertama sebuah meter hanya menjadi angka awal (pemakaian NULL).
+// sebelumnya berisi pemakaian bacaan-bacaan terakhir untuk deteksi lonjakan.
+func hitungPemakaian(angka float64, angkaLalu sql.NullFloat64, sebelumnya []float64) (sql.NullFloat64, string) {
+	if !angkaLalu.Valid {
+		return sql.NullFloat64{}, ""
+	}
+	if angka < angkaLalu.Float64 {
+		return sql.NullFloat64{}, anomaliMundur
+	}
+
+	pemakaian := sql.NullFloat64{Float64: angka - angkaLalu.Float64, Valid: true}
+	if pemakaian.Float64 == 0 {
+		return pemakaian, anomaliNol
+	}
+	if len(sebelumnya) > 0 {
+		total := 0.0
+		for _, p := range sebelumnya {
+			total += p
+		}
+		if rata := total / float64(len(sebelumnya)); rata > 0 && pemakaian.Float64 > rata*batasLonjakan {
+			return pemakaian, anomaliLonjakan
+		}
+	}
+	return pemakaian, ""
+}
+
+// cariTarifUtilitas mendahulukan tarif unit daripada tarif global.
+func cariTarifUtilitas(q querier, propertiID int64, jenis string) (tarif, abonemen float64, ok bool, err error) {
+	err = q.QueryRow(`
+		SELECT tarif, abonemen FROM tarif_utilitas
+		WHERE jenis=? AND status='aktif' AND (properti_id=? OR properti_id IS NULL)
+		ORDER BY properti_id IS NULL, id DESC LIMIT 1`, jenis, propertiID).Scan(&tarif, &abonemen)
+	if err == sql.ErrNoRows {
+		return 0, 0, false, nil
+	}
+	return tarif, abonemen, err == nil, err
+}
+
+// tagihanBerikutnya mencari tagihan kontrak aktif unit yang periodenya
+// dimulai pada atau setelah tanggal bacaan: pemakaian bulan ini ditagih di
+// tagihan bulan berikutnya. Tagihan yang sudah lunas tidak ditambah lagi.
+// Jika belum ada, bacaan menunggu generator.
+func tagihanBerikutnya(q querier, propertiID int64, tanggal string) (int64, bool, error) {
+	var id int64
+	err := q.QueryRow(`
+		SELECT pb.id FROM pembayaran pb
+		JOIN kontrak k ON k.id = pb.kontrak_id
+		WHERE k.properti_id=? AND k.status='aktif' AND COALESCE(pb.status, 'pending') <> 'lunas'
+		  AND COALESCE(pb.periode_mulai, pb.tanggal_mulai, pb.tanggal_bayar) >= ?
+		ORDER BY COALESCE(pb.periode_mulai, pb.tanggal_mulai, pb.tanggal_bayar), pb.id LIMIT 1`,
+		propertiID, tanggal).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	return id, err == nil, err
+}
+
+// deskripsiAbonemen juga dipakai untuk mengenali rincian abonemen yang
+// sudah ada di sebuah tagihan.
+func deskripsiAbonemen(jenis string) string {
+	return "Abonemen " + jenis
+}
+
+// adaAbonemen mengecek apakah tagihan sudah punya abonemen untuk jenis meter.
+func adaAbonemen(q querier, pembayaranID int64, jenis string) (bool, error) {
+	var n int
+	err := q.QueryRow(`
+		SELECT COUNT(*) FROM tagihan_item
+		WHERE pembayaran_id=? AND jenis=? AND deskripsi=? AND meter_bacaan_id IS NOT NULL`,
+		pembayaranID, jenis, deskripsiAbonemen(jenis)).Scan(&n)
+	return n > 0, err
+}
+
+// tagihUtilitas menambahkan bacaan meter unit yang belum ditagih (sampai
+// tanggal tertentu) sebagai rincian tagihan, lalu menghitung ulang total
+// tagihan. Abonemen ditagih sekali per tagihan dan jenis meter, berapa pun
+// jumlah bacaannya. Bacaan tanpa tarif aktif dibiarkan untuk ditagih kemudian.
+func tagihUtilitas(q querier, pembayaranID, propertiID int64, sampai string) (float64, error) {
+	rows, err := q.Query(`
+		SELECT id, jenis, tanggal, pemakaian FROM meter_bacaan
+		WHERE properti_id=? AND pembayaran_id IS NULL AND pemakaian IS NOT NULL AND tanggal <= ?
+		ORDER BY tanggal, id`, propertiID, sampai)
+	if err != nil {
+		return 0, err
+	}
+	type bacaan struct {
+		id        int64
+		jenis     string
+		tanggal   sql.NullTime
+		pemakaian float64
+	}
+	var list []bacaan
+	for rows.Next() {
+		var b bacaan
+		if err := rows.Scan(&b.id, &b.jenis, &b.tanggal, &b.pemakaian); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		list = append(list, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+	for _, b := range list {
+		tarif, abonemen, ok, err := cariTarifUtilitas(q, propertiID, b.jenis)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+
+		biaya := math.Round(b.pemakaian*tarif*100) / 100
+		deskripsi := fmt.Sprintf("%s %s %s (meter %s)", namaUtilitas[b.jenis], strconv.FormatFloat(b.pemakaian, 'f', -1, 64),
+			satuanUtilitas[b.jenis], formatTanggal(b.tanggal.Time))
+		if _, err := q.Exec(`
+			INSERT INTO tagihan_item (pembayaran_id, jenis, deskripsi, jumlah, harga_satuan, nominal, meter_bacaan_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			pembayaranID, b.jenis, deskripsi, b.pemakaian, tarif, biaya, b.id,
+		); err != nil {
+			return 0, err
+		}
+		total += biaya
+		if abonemen > 0 {
+			ada, err := adaAbonemen(q, pembayaranID, b.jenis)
+			if err != nil {
+				return 0, err
+			}
+			if !ada {
+				if _, err := q.Exec(`
+					INSERT INTO tagihan_item (pembayaran_id, jenis, deskripsi, jumlah, harga_satuan, nominal, meter_bacaan_id)
+					VALUES (?, ?, ?, 1, ?, ?, ?)`,
+					pembayaranID, b.jenis, deskripsiAbonemen(b.jenis), abonemen, abonemen, b.id,
+				); err != nil {
+					return 0, err
+				}
+				total += abonemen
+			}
+		}
+		if _, err := q.Exec("UPDATE meter_bacaan SET pembayaran_id=? WHERE id=?", pembayaranID, b.id); err != nil {
+			return 0, err
+		}
+	}
+
+	if total > 0 {
+		if _, err := hitungTotalTagihan(q, pembayaranID); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// UTILITAS HANDLERS
+func getTarifUtilitas(c *gin.Context) {
+	rows, err := db.Query(`
+		SELECT t.id, COALESCE(t.properti_id, 0), COALESCE(pr.nama_unit, ''), t.jenis, t.tarif, t.abonemen,
+		       t.status, COALESCE(t.keterangan, '')
+		FROM tarif_utilitas t
+		LEFT JOIN properti pr ON pr.id = t.properti_id
+		ORDER BY t.jenis, t.properti_id IS NULL DESC, t.id`)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	tarif := []TarifUtilitas{}
+	for rows.Next() {
+		var t TarifUtilitas
+		if err := rows.Scan(&t.ID, &t.PropertiID, &t.NamaUnit, &t.Jenis, &t.Tarif, &t.Abonemen, &t.Status, &t.Keterangan); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		tarif = append(tarif, t)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tarif)
+}
+
+func validateTarifUtilitas(in *requestInput, partial bool) []FieldError {
+	var fieldErrors []FieldError
+	for _, field := range []string{"jenis", "tarif"} {
+		if !partial || in.Has(field) {
+			fieldErrors = append(fieldErrors, requiredFields(in, field)...)
+		}
+	}
+	fieldErrors = append(fieldErrors, numericFields(in, "properti_id", "tarif", "abonemen")...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "jenis", jenisUtilitasValid)...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "status", statusAturanDendaValid)...)
+	return fieldErrors
+}
+
+func createTarifUtilitas(c *gin.Context) {
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateTarifUtilitas(in, false); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	abonemen := in.Get("abonemen")
+	if abonemen == "" {
+		abonemen = "0"
+	}
+	status := in.Get("status")
+	if status == "" {
+		status = "aktif"
+	}
+
+	id, err := db.InsertID(`
+		INSERT INTO tarif_utilitas (properti_id, jenis, tarif, abonemen, status, keterangan)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		nullIfEmpty(in.Get("properti_id")), in.Get("jenis"), in.Get("tarif"), abonemen, status, nullIfEmpty(in.Get("keterangan")),
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "message": "Tarif utilitas berhasil dibuat"})
+}
+
+func patchTarifUtilitas(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := validateTarifUtilitas(in, true); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+	if !ensureExists(c, "tarif_utilitas", id) {
+		return
+	}
+
+	sets, args := buildPatch(in, []patchField{
+		{Field: "properti_id", Column: "properti_id", Nullable: true},
+		{Field: "jenis", Column: "jenis"},
+		{Field: "tarif", Column: "tarif"},
+		{Field: "abonemen", Column: "abonemen"},
+		{Field: "status", Column: "status"},
+		{Field: "keterangan", Column: "keterangan", Nullable: true},
+	})
+	if len(sets) == 0 {
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Tidak ada field yang diubah", nil)
+		return
+	}
+
+	sets = append(sets, "updated_at=CURRENT_TIMESTAMP")
+	args = append(args, id)
+	if _, err := db.Exec("UPDATE tarif_utilitas SET "+strings.Join(sets, ", ")+" WHERE id=?", args...); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tarif utilitas berhasil diupdate"})
+}
+
+func deleteTarifUtilitas(c *gin.Context) {
+	result, err := db.Exec("DELETE FROM tarif_utilitas WHERE id=?", c.Param("id"))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	respondDeleted(c, result, "tarif utilitas", "Tarif utilitas berhasil dihapus")
+}
+
+func getMeterBacaan(c *gin.Context) {
+	filter := meterFilter(c)
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT m.id, m.properti_id, COALESCE(pr.nama_unit, ''), m.jenis, m.tanggal, m.angka, m.pemakaian,
+		       COALESCE(m.anomali, ''), COALESCE(m.foto_path, ''), COALESCE(m.pembayaran_id, 0), COALESCE(m.keterangan, '')
+		FROM meter_bacaan m
+		LEFT JOIN properti pr ON pr.id = m.properti_id`+filter.where()+`
+		ORDER BY m.tanggal DESC, m.id DESC`, filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	bacaan := []gin.H{}
+	for rows.Next() {
+		var id, propertiID, pembayaranID int64
+		var unit, jenis, anomali, foto, keterangan string
+		var tanggal sql.NullTime
+		var angka float64
+		var pemakaian sql.NullFloat64
+		if err := rows.Scan(&id, &propertiID, &unit, &jenis, &tanggal, &angka, &pemakaian,
+			&anomali, &foto, &pembayaranID, &keterangan); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		item := gin.H{
+			"id":            id,
+			"properti_id":   propertiID,
+			"nama_unit":     unit,
+			"jenis":         jenis,
+			"tanggal":       dateString(tanggal),
+			"angka":         angka,
+			"pemakaian":     nil,
+			"satuan":        satuanUtilitas[jenis],
+			"anomali":       anomali,
+			"foto_path":     foto,
+			"pembayaran_id": pembayaranID,
+			"keterangan":    keterangan,
+		}
+		if pemakaian.Valid {
+			item["pemakaian"] = pemakaian.Float64
+		}
+		bacaan = append(bacaan, item)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, bacaan)
+}
+
+// POST /api/utilitas/meter mencatat bacaan meter (multipart dengan foto
+// atau JSON). Bacaan harus lebih baru dari bacaan terakhir meter yang sama.
+func createMeterBacaan(c *gin.Context) {
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	fieldErrors := requiredFields(in, "properti_id", "jenis", "tanggal", "angka")
+	fieldErrors = append(fieldErrors, numericFields(in, "properti_id", "angka")...)
+	fieldErrors = append(fieldErrors, dateFields(in, "tanggal")...)
+	fieldErrors = append(fieldErrors, oneOfField(in, "jenis", jenisUtilitasValid)...)
+	if len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	propertiID, _ := strconv.ParseInt(in.Get("properti_id"), 10, 64)
+	angka, _ := strconv.ParseFloat(in.Get("angka"), 64)
+	jenis := in.Get("jenis")
+	tanggal := convertDateFormat(in.Get("tanggal"))
+	if !ensureExists(c, "properti", in.Get("properti_id")) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT tanggal, angka, pemakaian FROM meter_bacaan
+		WHERE properti_id=? AND jenis=?
+		ORDER BY tanggal DESC LIMIT 4`, propertiID, jenis)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	var angkaLalu sql.NullFloat64
+	var tanggalLalu string
+	var sebelumnya []float64
+	for rows.Next() {
+		var t sql.NullTime
+		var a float64
+		var p sql.NullFloat64
+		if err := rows.Scan(&t, &a, &p); err != nil {
+			rows.Close()
+			respondDBError(c, err)
+			return
+		}
+		if !angkaLalu.Valid {
+			angkaLalu = sql.NullFloat64{Float64: a, Valid: true}
+			tanggalLalu = dateString(t)
+		}
+		if p.Valid && len(sebelumnya) < 3 {
+			sebelumnya = append(sebelumnya, p.Float64)
+		}
+	}
+	rows.Close()
+	if tanggalLalu != "" && tanggal <= tanggalLalu {
+		respondValidation(c, []FieldError{{Field: "tanggal", Message: "tanggal harus setelah bacaan terakhir (" + tanggalLalu + ")"}})
+		return
+	}
+
+	pemakaian, anomali := hitungPemakaian(angka, angkaLalu, sebelumnya)
+
+	fotoPath, err := saveUpload(c, "foto", "meter")
+	if err != nil {
+		fmt.Printf("Failed to save foto meter: %v\n", err)
+	}
+
+	var nilaiPemakaian interface{}
+	if pemakaian.Valid {
+		nilaiPemakaian = pemakaian.Float64
+	}
+	id, err := tx.InsertID(`
+		INSERT INTO meter_bacaan (properti_id, jenis, tanggal, angka, pemakaian, anomali, foto_path, keterangan)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		propertiID, jenis, tanggal, angka, nilaiPemakaian, nullIfEmpty(anomali), nullIfEmpty(fotoPath), nullIfEmpty(in.Get("keterangan")),
+	)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	var biaya float64
+	pembayaranID, ok, err := tagihanBerikutnya(tx, propertiID, tanggal)
+	if err == nil && ok {
+		biaya, err = tagihUtilitas(tx, pembayaranID, propertiID, tanggal)
+		if err == nil && biaya > 0 {
+			err = recalcJatuhTempoPembayaran(tx, pembayaranID)
+		}
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if biaya == 0 {
+		pembayaranID = 0
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":            id,
+		"pemakaian":     nilaiPemakaian,
+		"anomali":       anomali,
+		"pembayaran_id": pembayaranID,
+		"biaya":         biaya,
+		"message":       "Bacaan meter berhasil dicatat",
+	})
+}
+
+// deleteMeterBacaan hanya mengizinkan bacaan terakhir yang belum ditagih,
+// supaya pemakaian bacaan lain tidak berubah.
+func deleteMeterBacaan(c *gin.Context) {
+	id := c.Param("id")
+
+	var propertiID int64
+	var jenis string
+	var tanggal sql.NullTime
+	var pembayaranID sql.NullInt64
+	err := db.QueryRow("SELECT properti_id, jenis, tanggal, pembayaran_id FROM meter_bacaan WHERE id=?", id).
+		Scan(&propertiID, &jenis, &tanggal, &pembayaranID)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data meter_bacaan tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if pembayaranID.Valid {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Bacaan meter sudah ditagih", nil)
+		return
+	}
+
+	var lebihBaru int
+	err = db.QueryRow("SELECT COUNT(*) FROM meter_bacaan WHERE properti_id=? AND jenis=? AND tanggal > ?",
+		propertiID, jenis, dateString(tanggal)).Scan(&lebihBaru)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if lebihBaru > 0 {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Hanya bacaan meter terakhir yang bisa dihapus", nil)
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM meter_bacaan WHERE id=?", id)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	respondDeleted(c, result, "meter_bacaan", "Bacaan meter berhasil dihapus")
+}
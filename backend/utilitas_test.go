@@ -0,0 +1,34 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestHitungPemakaian(t *testing.T) {
+	lalu := func(v float64) sql.NullFloat64 { return sql.NullFloat64{Float64: v, Valid: true} }
+	tests := []struct {
+		name        string
+		angka       float64
+		angkaLalu   sql.NullFloat64
+		sebelumnya  []float64
+		want        sql.NullFloat64
+		wantAnomali string
+	}{
+		{"bacaan pertama", 100, sql.NullFloat64{}, nil, sql.NullFloat64{}, ""},
+		{"normal", 150, lalu(100), []float64{40, 60}, lalu(50), ""},
+		{"mundur", 90, lalu(100), nil, sql.NullFloat64{}, anomaliMundur},
+		{"nol", 100, lalu(100), []float64{50}, lalu(0), anomaliNol},
+		{"tepat dua kali rata-rata", 200, lalu(100), []float64{50}, lalu(100), ""},
+		{"lonjakan", 201, lalu(100), []float64{40, 60}, lalu(101), anomaliLonjakan},
+		{"tanpa riwayat tidak dicek lonjakan", 1100, lalu(100), nil, lalu(1000), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, anomali := hitungPemakaian(tt.angka, tt.angkaLalu, tt.sebelumnya)
+			if got != tt.want || anomali != tt.wantAnomali {
+				t.Fatalf("got %+v %q, want %+v %q", got, anomali, tt.want, tt.wantAnomali)
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tagihan masuk antrean verifikasi selama belum diperiksa admin dan sudah
+// ada uang atau bukti bayar yang masuk. Cicilan baru mengembalikan tagihan
+// ke antrean.
+const kondisiMenungguVerifikasi = `p.diverifikasi_pada IS NULL
+	AND (COALESCE(p.uang_dibayar, 0) > 0 OR COALESCE(p.kwitansi_path, '') <> '')`
+
+// resetVerifikasi dipanggil saat penyewa menambah cicilan supaya uang yang
+// baru masuk diperiksa lagi.
+func resetVerifikasi(q querier, pembayaranID interface{}) error {
+	_, err := q.Exec("UPDATE pembayaran SET diverifikasi_oleh=NULL, diverifikasi_pada=NULL WHERE id=?", pembayaranID)
+	return err
+}
+
+// buatNotifikasi mencatat pesan untuk penyewa di tabel notifikasi. Pesan
+// dikirim di luar aplikasi (WhatsApp/email) lalu ditandai terkirim.
+func buatNotifikasi(q querier, penyewaID, pembayaranID int64, jenis, pesan string) error {
+	_, err := q.Exec(`
+		INSERT INTO notifikasi (penyewa_id, pembayaran_id, jenis, pesan)
+		VALUES (?, ?, ?, ?)`, penyewaID, pembayaranID, jenis, pesan)
+	return err
+}
+
+// GET /api/pembayaran/verifikasi mengembalikan tagihan yang menunggu
+// verifikasi, yang terlama lebih dulu, beserta kwitansi tagihan dan
+// kwitansi setiap cicilannya. Filter: penyewa_id dan q (nama penyewa).
+func getAntreanVerifikasi(c *gin.Context) {
+	filter := &listFilter{}
+	filter.add(kondisiMenungguVerifikasi)
+	filter.id(c, "penyewa_id", "p.penyewa_id")
+	filter.search(c, "q", "py.nama")
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT p.id, p.penyewa_id, COALESCE(p.kontrak_id, 0), COALESCE(py.nama, ''), COALESCE(py.telepon, ''),
+		       p.nominal, COALESCE(p.uang_dibayar, 0), COALESCE(p.tanggal_mulai, p.tanggal_bayar), p.tanggal_akhir,
+		       COALESCE(p.metode_bayar, ''), COALESCE(p.kwitansi_path, ''), COALESCE(p.status, 'pending'), COALESCE(p.alasan_penolakan, '')
+		FROM pembayaran p
+		LEFT JOIN penyewa py ON py.id = p.penyewa_id`+filter.where()+`
+		ORDER BY p.updated_at ASC, p.id ASC`, filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	antrean := []gin.H{}
+	byID := map[int64]gin.H{}
+	for rows.Next() {
+		var id, penyewaID, kontrakID int64
+		var nama, telepon, metode, kwitansi, status, alasan string
+		var nominal, dibayar float64
+		var mulai, akhir sql.NullTime
+		if err := rows.Scan(&id, &penyewaID, &kontrakID, &nama, &telepon, &nominal, &dibayar, &mulai, &akhir,
+			&metode, &kwitansi, &status, &alasan); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		item := gin.H{
+			"id":               id,
+			"penyewa_id":       penyewaID,
+			"kontrak_id":       kontrakID,
+			"nama_penyewa":     nama,
+			"telepon":          telepon,
+			"nominal":          nominal,
+			"uang_dibayar":     dibayar,
+			"tanggal_mulai":    dateString(mulai),
+			"tanggal_akhir":    dateString(akhir),
+			"metode_bayar":     metode,
+			"kwitansi_path":    kwitansi,
+			"status":           status,
+			"alasan_penolakan": alasan,
+			"cicilan":          []gin.H{},
+		}
+		antrean = append(antrean, item)
+		byID[id] = item
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if len(antrean) == 0 {
+		c.JSON(http.StatusOK, antrean)
+		return
+	}
+
+	// Cicilan semua tagihan di antrean diambil sekaligus
+	cicilan, err := db.Query(`
+		SELECT r.pembayaran_id, r.id, r.jumlah_dibayar, r.tanggal_bayar, COALESCE(r.metode_bayar, ''),
+		       COALESCE(r.kwitansi_path, ''), COALESCE(r.keterangan, ''),
+		       r.membatalkan_id IS NOT NULL OR EXISTS (SELECT 1 FROM riwayat_pembayaran b WHERE b.membatalkan_id = r.id)
+		FROM riwayat_pembayaran r
+		JOIN pembayaran p ON p.id = r.pembayaran_id
+		LEFT JOIN penyewa py ON py.id = p.penyewa_id`+filter.where()+`
+		ORDER BY r.tanggal_bayar ASC, r.id ASC`, filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer cicilan.Close()
+
+	for cicilan.Next() {
+		var pembayaranID, id int64
+		var jumlah float64
+		var tanggal sql.NullTime
+		var metode, kwitansi, keterangan string
+		var dibatalkan bool
+		if err := cicilan.Scan(&pembayaranID, &id, &jumlah, &tanggal, &metode, &kwitansi, &keterangan, &dibatalkan); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		item, ok := byID[pembayaranID]
+		if !ok {
+			continue
+		}
+		item["cicilan"] = append(item["cicilan"].([]gin.H), gin.H{
+			"id":             id,
+			"jumlah_dibayar": jumlah,
+			"tanggal_bayar":  dateString(tanggal),
+			"metode_bayar":   metode,
+			"kwitansi_path":  kwitansi,
+			"keterangan":     keterangan,
+			"dibatalkan":     dibatalkan,
+		})
+	}
+	if err := cicilan.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, antrean)
+}
+
+// tolakCicilan membatalkan semua cicilan tagihan yang belum diverifikasi
+// dengan baris pembalik, sama seperti pembatalan cicilan biasa, termasuk
+// lebih bayar yang sudah masuk saldo kredit. Mengembalikan jumlah cicilan
+// yang dibatalkan. Cicilan metode Kredit dan Deposit dicatat sistem, bukan
+// uang dari penyewa, sehingga tidak ikut ditolak.
+func tolakCicilan(q querier, pembayaranID interface{}, alasan, oleh, tanggal string) (int, error) {
+	rows, err := q.Query(`
+		SELECT r.id, r.kontrak_id, r.jumlah_dibayar, r.lebih_bayar, r.metode_bayar
+		FROM riwayat_pembayaran r
+		WHERE r.pembayaran_id = ? AND r.diverifikasi_pada IS NULL AND r.membatalkan_id IS NULL
+		  AND COALESCE(r.metode_bayar, '') NOT IN ('Kredit', 'Deposit')
+		  AND NOT EXISTS (SELECT 1 FROM riwayat_pembayaran b WHERE b.membatalkan_id = r.id)
+		ORDER BY r.id`, pembayaranID)
+	if err != nil {
+		return 0, err
+	}
+	type cicilan struct {
+		id            int64
+		kontrakID     sql.NullInt64
+		jumlah, lebih float64
+		metode        sql.NullString
+	}
+	var list []cicilan
+	for rows.Next() {
+		var r cicilan
+		if err := rows.Scan(&r.id, &r.kontrakID, &r.jumlah, &r.lebih, &r.metode); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		list = append(list, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range list {
+		pembatalanID, err := q.InsertID(`
+			INSERT INTO riwayat_pembayaran (pembayaran_id, kontrak_id, jumlah_dibayar, lebih_bayar, tanggal_bayar, metode_bayar, keterangan,
+			                                membatalkan_id, alasan, oleh, diverifikasi_pada)
+			VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+			pembayaranID, r.kontrakID, -r.jumlah, -r.lebih, r.metode,
+			"Pembayaran ditolak, cicilan #"+strconv.FormatInt(r.id, 10), r.id, alasan, nullIfEmpty(oleh),
+		)
+		if err != nil {
+			return 0, err
+		}
+		if err := batalkanKredit(q, r.id, pembatalanID, tanggal); err != nil {
+			return 0, err
+		}
+	}
+	return len(list), nil
+}
+
+// POST /api/pembayaran/:id/setujui menandai tagihan dan semua cicilannya
+// sudah diverifikasi.
+func setujuiPembayaran(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Baris tagihan dikunci supaya dua pemeriksa tidak memverifikasi
+	// tagihan yang sama bersamaan
+	var diverifikasi sql.NullTime
+	var dibayar float64
+	var menunggu int
+	err = tx.QueryRow(`
+		SELECT diverifikasi_pada, COALESCE(uang_dibayar, 0),
+		       (SELECT COUNT(*) FROM riwayat_pembayaran r
+		        WHERE r.pembayaran_id = pembayaran.id AND r.diverifikasi_pada IS NULL AND r.membatalkan_id IS NULL)
+		FROM pembayaran WHERE id=? FOR UPDATE`, id).Scan(&diverifikasi, &dibayar, &menunggu)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data pembayaran tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if diverifikasi.Valid {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Pembayaran sudah diverifikasi", nil)
+		return
+	}
+	if dibayar <= 0 && menunggu == 0 {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Belum ada pembayaran yang bisa disetujui", nil)
+		return
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE pembayaran SET alasan_penolakan=NULL, diverifikasi_oleh=?,
+		       diverifikasi_pada=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP
+		WHERE id=?`, nullIfEmpty(namaAktor(c, in)), id); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if _, err := tx.Exec(`
+		UPDATE riwayat_pembayaran SET diverifikasi_pada=CURRENT_TIMESTAMP
+		WHERE pembayaran_id=? AND diverifikasi_pada IS NULL`, id); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pembayaran berhasil disetujui"})
+}
+
+// POST /api/pembayaran/:id/tolak menolak uang yang menunggu verifikasi
+// dengan alasan wajib. Cicilan yang belum diverifikasi dibatalkan, sehingga
+// sisa tagihan kembali terutang dan tetap dihitung untuk jatuh tempo, denda,
+// tunggakan, dan potongan deposit. Penyewa mendapat notifikasi berisi
+// alasannya.
+func tolakPembayaran(c *gin.Context) {
+	id := c.Param("id")
+
+	in, err := parseInput(c)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	if fieldErrors := requiredFields(in, "alasan"); len(fieldErrors) > 0 {
+		respondValidation(c, fieldErrors)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		respondInternal(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var penyewaID, pembayaranID int64
+	var nominal float64
+	var mulai, akhir, diverifikasi sql.NullTime
+	err = tx.QueryRow(`
+		SELECT id, penyewa_id, nominal, COALESCE(tanggal_mulai, tanggal_bayar), tanggal_akhir, diverifikasi_pada
+		FROM pembayaran WHERE id=? FOR UPDATE`, id).Scan(&pembayaranID, &penyewaID, &nominal, &mulai, &akhir, &diverifikasi)
+	if err == sql.ErrNoRows {
+		respondNotFound(c, "Data pembayaran tidak ditemukan")
+		return
+	}
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if diverifikasi.Valid {
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Pembayaran sudah diverifikasi", nil)
+		return
+	}
+
+	alasan := in.Get("alasan")
+	oleh := namaAktor(c, in)
+	if _, err := tolakCicilan(tx, id, alasan, oleh, time.Now().Format("2006-01-02")); err != nil {
+		respondPembatalanError(c, err)
+		return
+	}
+	if _, err := tx.Exec(`
+		UPDATE pembayaran SET alasan_penolakan=?, diverifikasi_oleh=?,
+		       diverifikasi_pada=CURRENT_TIMESTAMP, updated_at=CURRENT_TIMESTAMP
+		WHERE id=?`, alasan, nullIfEmpty(oleh), id); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := sinkronPembayaran(tx, id); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	periode := formatTanggal(mulai.Time)
+	if akhir.Valid {
+		periode += " - " + formatTanggal(akhir.Time)
+	}
+	pesan := fmt.Sprintf("Pembayaran tagihan periode %s sebesar %s ditolak. Alasan: %s", periode, formatRupiah(nominal), alasan)
+	if err := buatNotifikasi(tx, penyewaID, pembayaranID, "pembayaran_ditolak", pesan); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := recalcJatuhTempoPembayaran(tx, id); err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pembayaran ditolak", "notifikasi": pesan})
+}
+
+// GET /api/notifikasi mengembalikan notifikasi penyewa beserta kontaknya.
+// Filter: status (menunggu/terkirim) dan penyewa_id.
+func getNotifikasi(c *gin.Context) {
+	filter := &listFilter{}
+	filter.equal(c, "status", "n.status")
+	filter.id(c, "penyewa_id", "n.penyewa_id")
+	if len(filter.errors) > 0 {
+		respondValidation(c, filter.errors)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT n.id, n.penyewa_id, COALESCE(py.nama, ''), COALESCE(py.telepon, ''), COALESCE(py.email, ''),
+		       COALESCE(n.pembayaran_id, 0), n.jenis, n.pesan, n.status, n.dikirim_pada, n.created_at
+		FROM notifikasi n
+		JOIN penyewa py ON py.id = n.penyewa_id`+filter.where()+`
+		ORDER BY n.created_at DESC, n.id DESC`, filter.args...)
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	notifikasi := []gin.H{}
+	for rows.Next() {
+		var id, penyewaID, pembayaranID int64
+		var nama, telepon, email, jenis, pesan, status string
+		var dikirim, dibuat sql.NullTime
+		if err := rows.Scan(&id, &penyewaID, &nama, &telepon, &email, &pembayaranID, &jenis, &pesan, &status,
+			&dikirim, &dibuat); err != nil {
+			respondDBError(c, err)
+			return
+		}
+		item := gin.H{
+			"id":            id,
+			"penyewa_id":    penyewaID,
+			"nama_penyewa":  nama,
+			"telepon":       telepon,
+			"email":         email,
+			"pembayaran_id": pembayaranID,
+			"jenis":         jenis,
+			"pesan":         pesan,
+			"status":        status,
+			"dikirim_pada":  "",
+			"created_at":    "",
+		}
+		if dikirim.Valid {
+			item["dikirim_pada"] = dikirim.Time.Format(time.RFC3339)
+		}
+		if dibuat.Valid {
+			item["created_at"] = dibuat.Time.Format(time.RFC3339)
+		}
+		notifikasi = append(notifikasi, item)
+	}
+	if err := rows.Err(); err != nil {
+		respondDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, notifikasi)
+}
+
+// POST /api/notifikasi/:id/terkirim menandai notifikasi sudah dikirim ke
+// penyewa.
+func tandaiNotifikasiTerkirim(c *gin.Context) {
+	result, err := db.Exec(`
+		UPDATE notifikasi SET status='terkirim', dikirim_pada=CURRENT_TIMESTAMP
+		WHERE id=? AND status='menunggu'`, c.Param("id"))
+	if err != nil {
+		respondDBError(c, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if !ensureExists(c, "notifikasi", c.Param("id")) {
+			return
+		}
+		respondError(c, http.StatusConflict, ErrCodeConflict, "Notifikasi sudah terkirim", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notifikasi ditandai terkirim"})
+}
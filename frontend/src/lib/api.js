@@ -12,7 +12,7 @@ const api = axios.create({
   },
 })
 
-// Request interceptor untuk menambahkan header role
+// Request interceptor untuk menambahkan header role dan nama user
 api.interceptors.request.use(
   (config) => {
     // Ambil user role dari localStorage
@@ -23,6 +23,10 @@ api.interceptors.request.use(
         if (userData.role && userData.role !== 'guest') {
           config.headers['X-User-Role'] = userData.role
         }
+        // Nama user dicatat backend sebagai pelaku koreksi (mis. pembatalan cicilan)
+        if (userData.nama) {
+          config.headers['X-User-Name'] = encodeURIComponent(userData.nama)
+        }
       }
     } catch (error) {
       console.error('Error parsing user data:', error)
@@ -49,5 +53,18 @@ api.interceptors.response.use(
   }
 )
 
+// Ambil pesan dari envelope error backend ({ code, message, details }).
+// Error validasi menyertakan pesan per field di details.
+export const pesanError = (error) => {
+  const body = error.response?.data
+  if (!body?.message) {
+    return error.message
+  }
+  if (Array.isArray(body.details) && body.details.length > 0) {
+    return body.message + '\n' + body.details.map((d) => `- ${d.field}: ${d.message}`).join('\n')
+  }
+  return body.message
+}
+
 export default api
 export { API_BASE_URL }
\ No newline at end of file
@@ -790,11 +790,13 @@ function Pembayaran() {
   const getStatusBadge = (status) => {
     const variants = {
       lunas: 'success',
+      sebagian: 'secondary',
       pending: 'warning',
       ditolak: 'destructive'
     }
     const labels = {
       lunas: 'Lunas',
+      sebagian: 'Sebagian',
       pending: 'Pending',
       ditolak: 'Ditolak'
     }
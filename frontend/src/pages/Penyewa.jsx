@@ -7,6 +7,7 @@ import { Dialog, DialogContent, DialogHeader, DialogTitle } from '../components/
 import { Input } from '../components/ui/Input'
 import { canCreate, canEdit, canDelete, isDemo } from '../lib/auth'
 import { db, storage } from '../lib/supabase'
+import { pesanError } from '../lib/api'
 
 function Penyewa() {
   const [showModal, setShowModal] = useState(false)
@@ -111,7 +112,7 @@ function Penyewa() {
       setFormData({ nama: '', nik: '', email: '', telepon: '', alamat: '' })
       fetchPenyewa()
     } catch (error) {
-      alert('Gagal menyimpan penyewa: ' + (error.response?.data?.error || error.message))
+      alert('Gagal menyimpan penyewa: ' + pesanError(error))
     }
   }
 
@@ -7,6 +7,7 @@ import { Dialog, DialogContent, DialogHeader, DialogTitle } from '../components/
 import { Input } from '../components/ui/Input'
 import { canCreate, canEdit, canDelete, isDemo } from '../lib/auth'
 import { db, storage } from '../lib/supabase'
+import { pesanError } from '../lib/api'
 
 function Properti() {
   const [showModal, setShowModal] = useState(false)
@@ -106,7 +107,7 @@ function Properti() {
       setFormData({ nama_unit: '', tipe: '', harga_sewa: '', status: 'kosong' })
       fetchProperti()
     } catch (error) {
-      alert('Gagal menyimpan properti: ' + (error.response?.data?.error || error.message))
+      alert('Gagal menyimpan properti: ' + pesanError(error))
     }
   }
 
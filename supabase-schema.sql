@@ -53,7 +53,7 @@ CREATE TABLE IF NOT EXISTS pembayaran (
     tanggal_akhir DATE NULL,
     metode_bayar VARCHAR(50) DEFAULT 'Transfer',
     kwitansi_path VARCHAR(255) NULL,
-    status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('lunas', 'pending', 'ditolak')),
+    status VARCHAR(20) DEFAULT 'pending' CHECK (status IN ('lunas', 'sebagian', 'pending', 'ditolak')),
     keterangan TEXT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),